@@ -1,41 +1,112 @@
 package cli
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
-	"net"
+	"io"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/we-be/tritium/pkg/tritium"
 )
 
+// linkScheme prefixes links printed by generate-link
+const linkScheme = "tritium://"
+
 func Run() {
+	var (
+		addr      = flag.String("addr", "localhost:8080", "tritium server address")
+		namespace = flag.String("namespace", "", "namespace to store links in")
+		reads     = flag.Int("reads", 1, "number of times a link can be opened")
+		ttl       = flag.Int("ttl", 86400, "seconds until an unopened link expires")
+	)
 	flag.Parse()
 
 	if flag.NArg() == 0 {
 		fmt.Println("Please provide a command. Available commands:")
-		fmt.Println("  generate-link: Generate a secure random link")
+		fmt.Println("  generate-link: Store a secret read from stdin behind a secure random link")
+		fmt.Println("  open-link <link>: Print the secret behind a link, using up one of its reads")
 		os.Exit(1)
 	}
 
 	command := flag.Arg(0)
-	conn := connGarnet()
+	client, err := tritium.NewClient(&tritium.ClientOptions{
+		Address:   *addr,
+		Timeout:   10 * time.Second,
+		Namespace: *namespace,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer client.Close()
 
 	switch command {
 	case "generate-link":
-		link := "ZELDA"
+		link, err := generateLink(client, *addr, *reads, *ttl)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 		fmt.Println(link)
+	case "open-link":
+		if flag.NArg() < 2 {
+			fmt.Println("Please provide the link to open")
+			os.Exit(1)
+		}
+		secret, err := openLink(client, flag.Arg(1))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(secret)
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		os.Exit(1)
 	}
-
-	conn.Close()
 }
 
-func connGarnet() net.Conn {
-	// Don't forget to close the connection
-	conn, err := net.Dial("tcp", "localhost:6379")
+// generateLink stores the secret read from stdin under a random token that
+// can be read reads times before it self-destructs, and returns a link to it
+func generateLink(client *tritium.Client, addr string, reads, ttl int) (string, error) {
+	if reads < 1 {
+		return "", fmt.Errorf("reads must be at least 1")
+	}
+
+	secret, err := io.ReadAll(os.Stdin)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	if len(secret) == 0 {
+		return "", fmt.Errorf("no secret given on stdin")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate link: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := client.SetMaxReads(token, secret, reads, &ttl); err != nil {
+		return "", err
+	}
+	return linkScheme + addr + "/" + token, nil
+}
+
+// openLink reads the secret behind a link or bare token
+func openLink(client *tritium.Client, link string) ([]byte, error) {
+	token := link
+	if rest, ok := strings.CutPrefix(link, linkScheme); ok {
+		token = rest[strings.LastIndex(rest, "/")+1:]
+	}
+
+	secret, err := client.Get(token)
+	if errors.Is(err, tritium.ErrConsumed) {
+		return nil, fmt.Errorf("link has already been opened")
 	}
-	return conn
+	return secret, err
 }
@@ -3,15 +3,62 @@ package config
 import (
 	"fmt"
 	"strconv"
+	"strings"
+
+	"github.com/we-be/tritium/pkg/storage"
 )
 
 const DEFAULT_MAX_CONN int = 4
 
+// Storage backends selectable with STORAGE_BACKEND
+const (
+	BackendRESP   = "resp"   // a Redis/Garnet-compatible server at MemStoreAddr
+	BackendMemory = "memory" // in-process maps for plain values; the node runs standalone
+)
+
 type Config struct {
+	Backend        string // storage engine; empty means BackendRESP
 	MemStoreAddr   string // address of the RESP memory backend
 	RPCAddr        string // address for RPC server
 	MaxConnections int
 	JoinAddr       string // optional address to join existing cluster
+	Namespaces     []NamespaceConfig
+	MemoryLimit    int64  // bytes the node may hold; 0 means unlimited
+	EvictionPolicy string // what to drop at MemoryLimit; empty rejects writes
+	EncryptValues  bool   // seal values before they reach the RESP backend
+	EncryptionKey  string // file holding the data key; empty generates one at startup
+	AllowUnsealed  bool   // return values stored unsealed instead of rejecting them
+	PipelineConns  int    // connections shared by auto-pipelined commands; 0 disables
+}
+
+// NamespaceConfig declares a namespace, its TTL policy and its quotas.
+// Zero values mean "server default" for DefaultTTL and "unlimited" otherwise.
+type NamespaceConfig struct {
+	Name       string
+	DefaultTTL int // seconds
+	MaxTTL     int // seconds
+	MaxKeys    int64
+	MaxBytes   int64
+	History    int // versions of each key kept by Set; 0 disables history
+}
+
+// ValidNamespaceName reports whether name can name a namespace: letters,
+// digits, '_' and '-'. Keys are prefixed with the name and a ':', and the
+// prefix goes into SCAN and PSUBSCRIBE patterns unescaped, so separators and
+// glob metacharacters are ruled out, as is a prefix that would put the keys
+// among Tritium's bookkeeping keys.
+func ValidNamespaceName(name string) bool {
+	if name == "" || storage.IsMetaKey(name+":") {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 func NewConfigFromDotenv(fp string) (Config, error) {
@@ -26,10 +73,100 @@ func NewConfigFromDotenv(fp string) (Config, error) {
 		maxConn = DEFAULT_MAX_CONN
 	}
 
+	namespaces, err := parseNamespaces(cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var memoryLimit int64
+	if raw := cfg["MEMORY_LIMIT"]; raw != "" {
+		memoryLimit, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || memoryLimit < 0 {
+			return Config{}, fmt.Errorf("invalid MEMORY_LIMIT: %q", raw)
+		}
+	}
+
+	var pipelineConns int
+	if raw := cfg["PIPELINE_CONNECTIONS"]; raw != "" {
+		pipelineConns, err = strconv.Atoi(raw)
+		if err != nil || pipelineConns < 0 {
+			return Config{}, fmt.Errorf("invalid PIPELINE_CONNECTIONS: %q", raw)
+		}
+	}
+
+	encrypt := false
+	if raw := cfg["ENCRYPT_VALUES"]; raw != "" {
+		encrypt, err = strconv.ParseBool(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ENCRYPT_VALUES: %q", raw)
+		}
+	}
+
+	allowUnsealed := false
+	if raw := cfg["ALLOW_UNSEALED_READS"]; raw != "" {
+		allowUnsealed, err = strconv.ParseBool(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ALLOW_UNSEALED_READS: %q", raw)
+		}
+	}
+
 	return Config{
+		Backend:        cfg["STORAGE_BACKEND"],
 		MemStoreAddr:   cfg["SECURE_STORE_ADDRESS"],
 		RPCAddr:        cfg["RPC_ADDRESS"],
 		MaxConnections: maxConn,
 		JoinAddr:       cfg["JOIN_ADDRESS"], // Optional
+		Namespaces:     namespaces,
+		MemoryLimit:    memoryLimit,
+		EvictionPolicy: cfg["EVICTION_POLICY"],
+		EncryptValues:  encrypt || cfg["ENCRYPTION_KEY_FILE"] != "",
+		EncryptionKey:  cfg["ENCRYPTION_KEY_FILE"],
+		AllowUnsealed:  allowUnsealed,
+		PipelineConns:  pipelineConns,
 	}, nil
 }
+
+// parseNamespaces reads the comma-separated NAMESPACES list and each
+// namespace's NAMESPACE_<NAME>_* settings
+func parseNamespaces(cfg map[string]string) ([]NamespaceConfig, error) {
+	var namespaces []NamespaceConfig
+	for _, name := range strings.Split(cfg["NAMESPACES"], ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !ValidNamespaceName(name) {
+			return nil, fmt.Errorf("invalid namespace name %q", name)
+		}
+
+		prefix := "NAMESPACE_" + strings.ToUpper(name) + "_"
+		ns := NamespaceConfig{Name: name}
+		settings := []struct {
+			key string
+			set func(int64)
+		}{
+			{"DEFAULT_TTL", func(v int64) { ns.DefaultTTL = int(v) }},
+			{"MAX_TTL", func(v int64) { ns.MaxTTL = int(v) }},
+			{"MAX_KEYS", func(v int64) { ns.MaxKeys = v }},
+			{"MAX_BYTES", func(v int64) { ns.MaxBytes = v }},
+			{"HISTORY", func(v int64) { ns.History = int(v) }},
+		}
+		for _, setting := range settings {
+			raw, ok := cfg[prefix+setting.key]
+			if !ok || raw == "" {
+				continue
+			}
+			v, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("invalid %s%s: %q", prefix, setting.key, raw)
+			}
+			setting.set(v)
+		}
+		if ns.MaxTTL > 0 && ns.DefaultTTL > ns.MaxTTL {
+			return nil, fmt.Errorf("namespace %s: default TTL exceeds max TTL", name)
+		}
+
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, nil
+}
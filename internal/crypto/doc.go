@@ -1,17 +1,19 @@
-package crypto // import "github.com/hunterjsb/tritium/pkg/crypto"
-
 /*
 Package crypto provides secure encryption primitives for Tritium.
 
-Basic usage:
+Values are sealed with AES-GCM under a data key held only by the node:
 
-    key := make([]byte, 32)
-    rand.Read(key)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer key.Free()
 
-    block, err := crypto.NewBlock(key, data)
-    if err != nil {
-        log.Fatal(err)
-    }
+	sealer, err := crypto.NewSealer(key.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
 
-    encrypted := block.Bytes()
+	sealed, err := sealer.Seal("name", data)
 */
+package crypto
@@ -0,0 +1,139 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/we-be/tritium/internal/secmem"
+)
+
+// KeySize is the size of a data key, which selects AES-256
+const KeySize = 32
+
+// ErrOpen is returned for sealed values that fail authentication, because
+// they were tampered with, moved to another key or sealed under another data key
+var ErrOpen = errors.New("sealed value failed authentication")
+
+// ErrUnsealed is returned by Open for values that were never sealed, unless
+// unsealed reads were allowed
+var ErrUnsealed = errors.New("value is not sealed")
+
+// sealMagic prefixes sealed values so they can be told apart from values
+// written before sealing was enabled
+var sealMagic = []byte{0, 'T', 'S', 1}
+
+// Sealer encrypts values with AES-GCM under a data key, binding each value to
+// a name given as associated data
+type Sealer struct {
+	aead          cipher.AEAD
+	allowUnsealed bool
+}
+
+// NewSealer creates a sealer for a KeySize data key. The key is expanded into
+// the cipher, so the caller may wipe it afterwards.
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("data key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts plaintext under a fresh random nonce, bound to name
+func (s *Sealer) Seal(name string, plaintext []byte) ([]byte, error) {
+	headerLen := len(sealMagic) + s.aead.NonceSize()
+	out := make([]byte, headerLen, headerLen+len(plaintext)+s.aead.Overhead())
+	copy(out, sealMagic)
+	nonce := out[len(sealMagic):headerLen]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return s.aead.Seal(out, nonce, plaintext, []byte(name)), nil
+}
+
+// Overhead returns how many bytes Seal adds to a value
+func (s *Sealer) Overhead() int {
+	return len(sealMagic) + s.aead.NonceSize() + s.aead.Overhead()
+}
+
+// AllowUnsealed makes Open return values that were never sealed unchanged,
+// so values written before sealing was enabled stay readable. Anyone who can
+// write to the RESP server can then plant plaintext values, so it is meant for
+// migrations only. It must be called before the sealer is used.
+func (s *Sealer) AllowUnsealed() {
+	s.allowUnsealed = true
+}
+
+// Open decrypts a value sealed under name. Values that were never sealed fail
+// with ErrUnsealed unless AllowUnsealed was called.
+func (s *Sealer) Open(name string, sealed []byte) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, sealMagic) {
+		if !s.allowUnsealed {
+			return nil, ErrUnsealed
+		}
+		return sealed, nil
+	}
+	headerLen := len(sealMagic) + s.aead.NonceSize()
+	if len(sealed) < headerLen+s.aead.Overhead() {
+		return nil, ErrOpen
+	}
+	plaintext, err := s.aead.Open(nil, sealed[len(sealMagic):headerLen], sealed[headerLen:], []byte(name))
+	if err != nil {
+		return nil, ErrOpen
+	}
+	return plaintext, nil
+}
+
+// GenerateKey returns a random data key in secure memory
+func GenerateKey() (*secmem.Buffer, error) {
+	key, err := secmem.Alloc(KeySize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(key.Bytes()); err != nil {
+		key.Free()
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return key, nil
+}
+
+// LoadKey reads a data key from a file holding either KeySize raw bytes or
+// their hex encoding, and returns it in secure memory
+func LoadKey(path string) (*secmem.Buffer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data key: %w", err)
+	}
+	defer secmem.Wipe(raw)
+
+	key, err := secmem.Alloc(KeySize)
+	if err != nil {
+		return nil, err
+	}
+	switch text := bytes.TrimSpace(raw); {
+	case len(raw) == KeySize:
+		copy(key.Bytes(), raw)
+	case len(text) == 2*KeySize:
+		if _, err := hex.Decode(key.Bytes(), text); err != nil {
+			key.Free()
+			return nil, fmt.Errorf("invalid data key in %s: %w", path, err)
+		}
+	default:
+		key.Free()
+		return nil, fmt.Errorf("data key in %s must be %d bytes or %d hex characters", path, KeySize, 2*KeySize)
+	}
+	return key, nil
+}
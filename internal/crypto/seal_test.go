@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSealer(t *testing.T) *Sealer {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey returned an error: %v", err)
+	}
+	defer key.Free()
+
+	sealer, err := NewSealer(key.Bytes())
+	if err != nil {
+		t.Fatalf("NewSealer returned an error: %v", err)
+	}
+	return sealer
+}
+
+func TestSealOpen(t *testing.T) {
+	sealer := newTestSealer(t)
+	plaintext := []byte("secret value")
+
+	sealed, err := sealer.Seal("key", plaintext)
+	if err != nil {
+		t.Fatalf("Seal returned an error: %v", err)
+	}
+	if bytes.Contains(sealed, plaintext) || len(sealed) != len(plaintext)+sealer.Overhead() {
+		t.Fatalf("Unexpected sealed value %q", sealed)
+	}
+
+	opened, err := sealer.Open("key", sealed)
+	if err != nil {
+		t.Fatalf("Open returned an error: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Expected %q, got %q", plaintext, opened)
+	}
+
+	// The name is bound to the value
+	if _, err := sealer.Open("other", sealed); err != ErrOpen {
+		t.Errorf("Expected ErrOpen for another name, got %v", err)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := sealer.Open("key", tampered); err != ErrOpen {
+		t.Errorf("Expected ErrOpen for a tampered value, got %v", err)
+	}
+
+	if _, err := newTestSealer(t).Open("key", sealed); err != ErrOpen {
+		t.Errorf("Expected ErrOpen under another data key, got %v", err)
+	}
+
+	// Values that were never sealed are rejected
+	if _, err := sealer.Open("key", []byte("42")); err != ErrUnsealed {
+		t.Errorf("Expected ErrUnsealed for an unsealed value, got %v", err)
+	}
+}
+
+func TestOpenAllowUnsealed(t *testing.T) {
+	sealer := newTestSealer(t)
+	sealer.AllowUnsealed()
+
+	// Values that were never sealed pass through
+	if opened, err := sealer.Open("key", []byte("42")); err != nil || string(opened) != "42" {
+		t.Errorf("Expected unsealed value to pass through, got %q, %v", opened, err)
+	}
+
+	// while sealed values are still authenticated
+	sealed, err := sealer.Seal("key", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Seal returned an error: %v", err)
+	}
+	if _, err := sealer.Open("other", sealed); err != ErrOpen {
+		t.Errorf("Expected ErrOpen for another name, got %v", err)
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xab}, KeySize)
+	dir := t.TempDir()
+
+	for name, contents := range map[string][]byte{
+		"raw": raw,
+		"hex": []byte(hex.EncodeToString(raw) + "\n"),
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, contents, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		key, err := LoadKey(path)
+		if err != nil {
+			t.Fatalf("LoadKey(%s) returned an error: %v", name, err)
+		}
+		if !bytes.Equal(key.Bytes(), raw) {
+			t.Errorf("LoadKey(%s) returned the wrong key", name)
+		}
+		key.Free()
+	}
+
+	short := filepath.Join(dir, "short")
+	if err := os.WriteFile(short, []byte("too short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKey(short); err == nil {
+		t.Errorf("Expected an error for a short key")
+	}
+}
@@ -177,6 +177,23 @@ func (m *Monitor) printNode(node *server.NodeInfo, respInfo map[string]map[strin
 		float64(node.Stats.BytesTransferred)/(1024*1024),
 		Reset)
 
+	if len(node.Stats.Pools) > 0 {
+		pool := node.Stats.Pools[0]
+		fmt.Printf("  %s%sPool:%s %s%d in use, %d idle of %d (%d dial failures)%s\n",
+			Dim, White, Reset,
+			BrightMagenta, pool.InUse, pool.Idle, pool.MaxConns, pool.DialFailures, Reset)
+	}
+
+	if node.Stats.MemoryLimit > 0 {
+		fmt.Printf("  %s%sMemory:%s %s%.2f / %.2f MB (%s, %d evicted)%s\n",
+			Dim, White, Reset,
+			BrightCyan,
+			float64(node.Stats.MemoryUsed)/(1024*1024),
+			float64(node.Stats.MemoryLimit)/(1024*1024),
+			node.Stats.EvictionPolicy, node.Stats.Evictions,
+			Reset)
+	}
+
 	fmt.Printf("  %s%sLast Seen:%s %s%s ago%s\n",
 		Dim, White, Reset,
 		BrightBlue, formatDuration(time.Since(node.LastSeen)), Reset)
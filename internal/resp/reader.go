@@ -12,6 +12,14 @@ type Reader struct {
 	r *bufio.Reader
 }
 
+// ReplyError is an error reply sent by the server. It is read in full, so
+// unlike other read errors it leaves the connection in step with the server.
+type ReplyError string
+
+func (e ReplyError) Error() string {
+	return string(e)
+}
+
 func NewReader(r io.Reader) *Reader {
 	return &Reader{r: bufio.NewReader(r)}
 }
@@ -23,20 +31,7 @@ func (r *Reader) ReadValue() (interface{}, error) {
 		return nil, fmt.Errorf("read type error: %w", err)
 	}
 
-	switch typ {
-	case SimpleString:
-		return r.readSimpleString()
-	case Error:
-		return nil, r.readError()
-	case Integer:
-		return r.readInteger()
-	case BulkString:
-		return r.readBulkString()
-	case Array:
-		return r.readArray()
-	default:
-		return nil, ErrInvalidResp
-	}
+	return r.readValueOfType(typ)
 }
 
 // ReadBulk reads a value expecting it to be a bulk string
@@ -78,6 +73,9 @@ func (r *Reader) IsOK() bool {
 // ReadInt reads an integer from the buffer
 func (r *Reader) ReadInt() (int64, error) {
 	typ, byteErr := r.r.ReadByte()
+	if byteErr == nil && typ == Error {
+		return 0, r.readError()
+	}
 	res, readErr := r.readInteger()
 	if byteErr != nil || readErr != nil || typ != Integer {
 		return 0, fmt.Errorf("could not read int (as %x); BE: %s; RE: %s", typ, byteErr, readErr)
@@ -87,6 +85,23 @@ func (r *Reader) ReadInt() (int64, error) {
 
 // internal parsing functions
 
+func (r *Reader) readValueOfType(typ byte) (interface{}, error) {
+	switch typ {
+	case SimpleString:
+		return r.readSimpleString()
+	case Error:
+		return nil, r.readError()
+	case Integer:
+		return r.readInteger()
+	case BulkString:
+		return r.readBulkString()
+	case Array:
+		return r.readArray()
+	default:
+		return nil, ErrInvalidResp
+	}
+}
+
 func (r *Reader) readLine() ([]byte, error) {
 	line, err := r.r.ReadBytes('\n')
 	if err != nil {
@@ -111,7 +126,7 @@ func (r *Reader) readError() error {
 	if err != nil {
 		return err
 	}
-	return errors.New(string(line))
+	return ReplyError(line)
 }
 
 func (r *Reader) readSimpleString() (string, error) {
@@ -164,10 +179,20 @@ func (r *Reader) readArray() ([]interface{}, error) {
 		return nil, nil // Null array
 	}
 
-	// Read array elements
+	// Read array elements. Error replies inside an array (e.g. from EXEC) are
+	// stored as error values so the rest of the array is still consumed.
 	array := make([]interface{}, length)
 	for i := int64(0); i < length; i++ {
-		value, err := r.ReadValue()
+		typ, err := r.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("read type error: %w", err)
+		}
+		if typ == Error {
+			array[i] = r.readError()
+			continue
+		}
+
+		value, err := r.readValueOfType(typ)
 		if err != nil {
 			return nil, err
 		}
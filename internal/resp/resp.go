@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
+
+	"github.com/we-be/tritium/internal/secmem"
 )
 
 var (
@@ -29,23 +32,139 @@ type RespCommand []byte
 // NewCommand creates a new RESP command with variadic string arguments
 func NewCommand(args ...string) *RespCommand {
 	// Pre-calculate total length to avoid multiple allocations
-	totalLen := 1 + len(strconv.Itoa(len(args))) + 2 // *<len>\r\n
-	for _, arg := range args {
-		totalLen += 1 + len(strconv.Itoa(len(arg))) + 2 + len(arg) + 2 // $<len>\r\n<data>\r\n
+	cmd := RespCommand(appendCommand(make([]byte, 0, commandLen(args)), args))
+	return &cmd
+}
+
+// NewPipeline encodes several commands back to back so they can be written to
+// the connection in a single call. Replies must be read once per command, in order.
+func NewPipeline(cmds ...[]string) *RespCommand {
+	pipeline := make(RespCommand, 0, pipelineLen(cmds))
+	for _, args := range cmds {
+		pipeline = appendCommand(pipeline, args)
+	}
+	return &pipeline
+}
+
+// WritePipeline encodes cmds into secure memory, writes them to the
+// connection in a single call and wipes the encoding, so the values in them
+// are never copied to the heap. Replies must be read once per command, in order.
+func WritePipeline(conn net.Conn, cmds ...[]string) (int, error) {
+	if conn == nil {
+		return 0, ErrInvalidConn
+	}
+
+	buf, err := secmem.Alloc(pipelineLen(cmds))
+	if err != nil {
+		return 0, err
+	}
+	defer buf.Free()
+
+	encoded := buf.Bytes()[:0]
+	for _, args := range cmds {
+		encoded = appendCommand(encoded, args)
+	}
+	return conn.Write(encoded)
+}
+
+// maxWriterBuffer is the largest buffer a Writer keeps between writes. Larger
+// buffers are freed once their write is done, so one large command does not
+// pin secure memory for the life of the connection.
+const maxWriterBuffer = 64 << 10
+
+// Writer is WritePipeline for a single connection. It keeps its secure
+// buffer between writes, growing it as needed up to maxWriterBuffer, so a
+// busy connection neither contends on the shared arena nor maps memory for
+// every command. A Writer is safe for concurrent use; the zero value is
+// ready to use.
+type Writer struct {
+	mu     sync.Mutex
+	buf    *secmem.Buffer
+	closed bool
+}
+
+// WritePipeline encodes cmds into the writer's buffer, writes them to the
+// connection in a single call and wipes the encoding
+func (w *Writer) WritePipeline(conn net.Conn, cmds ...[]string) (int, error) {
+	if conn == nil {
+		return 0, ErrInvalidConn
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrInvalidConn
 	}
 
-	// Initialize with capacity
-	cmd := make(RespCommand, 0, totalLen)
+	n := pipelineLen(cmds)
+	if w.buf == nil || w.buf.Len() < n {
+		size := n
+		if w.buf != nil {
+			size = max(n, min(2*w.buf.Len(), maxWriterBuffer))
+		}
+		buf, err := secmem.Alloc(size)
+		if err != nil {
+			return 0, err
+		}
+		w.buf.Free()
+		w.buf = buf
+	}
 
-	// Append array header
-	cmd = append(cmd, []byte(fmt.Sprintf("*%d\r\n", len(args)))...)
+	encoded := w.buf.Bytes()[:0]
+	for _, args := range cmds {
+		encoded = appendCommand(encoded, args)
+	}
+	written, err := conn.Write(encoded)
+	secmem.Wipe(encoded)
+	if w.buf.Len() > maxWriterBuffer {
+		w.buf.Free()
+		w.buf = nil
+	}
+	return written, err
+}
 
-	// Append each argument as a bulk string
+// Free releases the writer's buffer once its connection is closed; later
+// writes fail with ErrInvalidConn
+func (w *Writer) Free() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Free()
+	w.buf = nil
+	w.closed = true
+}
+
+// commandLen returns the encoded length of a command
+func commandLen(args []string) int {
+	n := 1 + len(strconv.Itoa(len(args))) + 2 // *<len>\r\n
 	for _, arg := range args {
-		cmd = append(cmd, []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg))...)
+		n += 1 + len(strconv.Itoa(len(arg))) + 2 + len(arg) + 2 // $<len>\r\n<data>\r\n
 	}
+	return n
+}
 
-	return &cmd
+// pipelineLen returns the encoded length of several commands
+func pipelineLen(cmds [][]string) int {
+	n := 0
+	for _, args := range cmds {
+		n += commandLen(args)
+	}
+	return n
+}
+
+// appendCommand appends the encoding of a command to dst, copying arguments
+// directly so no intermediate strings hold them
+func appendCommand(dst []byte, args []string) []byte {
+	dst = append(dst, Array)
+	dst = strconv.AppendInt(dst, int64(len(args)), 10)
+	dst = append(dst, '\r', '\n')
+	for _, arg := range args {
+		dst = append(dst, BulkString)
+		dst = strconv.AppendInt(dst, int64(len(arg)), 10)
+		dst = append(dst, '\r', '\n')
+		dst = append(dst, arg...)
+		dst = append(dst, '\r', '\n')
+	}
+	return dst
 }
 
 // Execute writes the command to the connection and returns the number of bytes written
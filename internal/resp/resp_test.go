@@ -266,3 +266,80 @@ func TestIntegration_BulkStringReply(t *testing.T) {
 		t.Errorf("expected to delete 1, actually %d", numDel)
 	}
 }
+
+func TestIntegration_Pipeline(t *testing.T) {
+	conn := setupConnection(t)
+	defer conn.Close()
+
+	reader := NewReader(conn)
+
+	pipeline := NewPipeline(
+		[]string{"MULTI"},
+		[]string{"SET", "pipeline_key", "not_a_number"},
+		[]string{"INCR", "pipeline_key"},
+		[]string{"DEL", "pipeline_key"},
+		[]string{"EXEC"},
+	)
+	if _, err := pipeline.Execute(conn); err != nil {
+		t.Fatalf("failed to write pipeline: %v", err)
+	}
+
+	// MULTI reply followed by one QUEUED per command
+	for i := 0; i < 4; i++ {
+		if _, err := reader.ReadValue(); err != nil {
+			t.Fatalf("reply %d: unexpected error %v", i, err)
+		}
+	}
+
+	resp, err := reader.ReadValue()
+	if err != nil {
+		t.Fatalf("EXEC failed: %v", err)
+	}
+	arr, ok := resp.([]interface{})
+	if !ok || len(arr) != 3 {
+		t.Fatalf("expected 3 EXEC results, got %#v", resp)
+	}
+	if _, ok := arr[1].(error); !ok {
+		t.Errorf("expected INCR on a string to produce an error element, got %T", arr[1])
+	}
+	if num, ok := arr[2].(int64); !ok || num != 1 {
+		t.Errorf("expected DEL to remove 1 key, got %v", arr[2])
+	}
+}
+
+func TestWriter(t *testing.T) {
+	conn := setupConnection(t)
+	defer conn.Close()
+
+	reader := NewReader(conn)
+	var w Writer
+	defer w.Free()
+
+	// A small command, then one that outgrows the buffer, then a small one again
+	large := string(make([]byte, 64*1024))
+	for _, value := range []string{"small", large, "again"} {
+		if _, err := w.WritePipeline(conn, []string{"SET", "writer_key", value}, []string{"GET", "writer_key"}); err != nil {
+			t.Fatalf("failed to write pipeline: %v", err)
+		}
+		if !reader.IsOK() {
+			t.Fatalf("SET was not OK")
+		}
+		res, err := reader.ReadBulk()
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		if string(res) != value {
+			t.Errorf("expected %d bytes back, got %d", len(value), len(res))
+		}
+		// Only a buffer within the cap is kept for the next write
+		if w.buf != nil && w.buf.Len() > maxWriterBuffer {
+			t.Errorf("expected at most %d bytes kept, got %d", maxWriterBuffer, w.buf.Len())
+		}
+	}
+	NewCommand("DEL", "writer_key").ExecuteWithResponse(conn, reader)
+
+	w.Free()
+	if _, err := w.WritePipeline(conn, []string{"PING"}); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn after Free, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package secmem
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// madvDontDump is MADV_DONTDUMP, which package syscall does not define
+const madvDontDump = 0x10
+
+// mapLocked maps size bytes, a multiple of the page size, of read-write
+// memory between two inaccessible guard pages, excluded from core dumps and
+// locked into RAM. locked is false if the lock failed, usually because of
+// RLIMIT_MEMLOCK; the memory is still usable.
+func mapLocked(size int) (region, data []byte, locked bool, err error) {
+	page := syscall.Getpagesize()
+	region, err = syscall.Mmap(-1, 0, size+2*page, syscall.PROT_NONE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("mmap: %w", err)
+	}
+
+	data = region[page : page+size : page+size]
+	if err := syscall.Mprotect(data, syscall.PROT_READ|syscall.PROT_WRITE); err != nil {
+		syscall.Munmap(region)
+		return nil, nil, false, fmt.Errorf("mprotect: %w", err)
+	}
+	// Kernels before 3.4 do not know the advice; the memory is still locked
+	syscall.Madvise(data, madvDontDump)
+
+	return region, data, syscall.Mlock(data) == nil, nil
+}
+
+// unmap releases a mapping made by mapLocked
+func unmap(region, data []byte, locked bool) {
+	if locked {
+		syscall.Munlock(data)
+	}
+	syscall.Munmap(region)
+}
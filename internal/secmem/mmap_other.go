@@ -0,0 +1,12 @@
+//go:build !linux
+
+package secmem
+
+// mapLocked falls back to heap memory, which cannot be locked or guarded
+func mapLocked(size int) (region, data []byte, locked bool, err error) {
+	data = make([]byte, size)
+	return data, data, false, nil
+}
+
+// unmap leaves heap memory to the garbage collector
+func unmap(region, data []byte, locked bool) {}
@@ -0,0 +1,216 @@
+// Package secmem keeps sensitive bytes out of the Go heap. Buffers come from
+// memory mapped outside the garbage collector, locked into RAM so it is never
+// swapped, excluded from core dumps and fenced by inaccessible guard pages,
+// and are wiped as soon as they are freed.
+//
+// On platforms other than Linux buffers fall back to ordinary heap memory
+// that is still wiped on free.
+package secmem
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// minClass is the smallest block handed out; smaller requests round up
+	minClass = 32
+	// slabPages is how many pages each slab of small blocks spans
+	slabPages = 16
+)
+
+// Arena hands out buffers in secure memory. Blocks up to a page come from
+// shared slabs, with guard pages around each slab rather than each block, and
+// are recycled after being wiped. Larger buffers get a mapping of their own
+// that is unmapped when they are freed. An Arena is safe for concurrent use.
+type Arena struct {
+	mu    sync.Mutex
+	page  int
+	free  [][][]byte // wiped blocks for each size class
+	slabs [][]byte   // slab mappings, kept for the life of the arena
+
+	unlocked bool // some memory could not be locked into RAM
+	warn     sync.Once
+}
+
+// NewArena creates an empty arena; memory is mapped as buffers are allocated
+func NewArena() *Arena {
+	a := &Arena{page: os.Getpagesize()}
+	for class := minClass; class <= a.page; class <<= 1 {
+		a.free = append(a.free, nil)
+	}
+	return a
+}
+
+var defaultArena = NewArena()
+
+// Alloc returns a zeroed buffer of n bytes from the default arena
+func Alloc(n int) (*Buffer, error) {
+	return defaultArena.Alloc(n)
+}
+
+// Copy returns a buffer from the default arena holding a copy of p
+func Copy(p []byte) (*Buffer, error) {
+	return defaultArena.Copy(p)
+}
+
+// CopyString returns a buffer from the default arena holding a copy of s
+func CopyString(s string) (*Buffer, error) {
+	return defaultArena.CopyString(s)
+}
+
+// Buffer is a block of secure memory. Its contents stay valid until Free.
+type Buffer struct {
+	arena  *Arena
+	block  []byte // the whole block, wiped on free
+	n      int    // bytes in use
+	class  int    // size class of slab blocks, -1 for a dedicated mapping
+	region []byte // a dedicated mapping and its guard pages
+	locked bool
+}
+
+// Alloc returns a zeroed buffer of n bytes
+func (a *Arena) Alloc(n int) (*Buffer, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid buffer size %d", n)
+	}
+	if n > a.page {
+		return a.allocMapped(n)
+	}
+
+	class, size := 0, minClass
+	for size < n {
+		class, size = class+1, size<<1
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.free[class]) == 0 {
+		if err := a.grow(class, size); err != nil {
+			return nil, err
+		}
+	}
+	last := len(a.free[class]) - 1
+	block := a.free[class][last]
+	a.free[class] = a.free[class][:last]
+	return &Buffer{arena: a, block: block, n: n, class: class}, nil
+}
+
+// grow maps a slab and splits it into free blocks of one size class; callers
+// must hold a.mu
+func (a *Arena) grow(class, size int) error {
+	region, data, locked, err := mapLocked(slabPages * a.page)
+	if err != nil {
+		return fmt.Errorf("failed to map secure memory: %w", err)
+	}
+	a.noteLocked(locked)
+	a.slabs = append(a.slabs, region)
+	for off := 0; off+size <= len(data); off += size {
+		a.free[class] = append(a.free[class], data[off:off+size:off+size])
+	}
+	return nil
+}
+
+// allocMapped gives a buffer larger than a page a mapping of its own, so
+// guard pages sit directly around it
+func (a *Arena) allocMapped(n int) (*Buffer, error) {
+	size := (n + a.page - 1) / a.page * a.page
+	region, data, locked, err := mapLocked(size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map secure memory: %w", err)
+	}
+	a.mu.Lock()
+	a.noteLocked(locked)
+	a.mu.Unlock()
+	return &Buffer{arena: a, block: data, n: n, class: -1, region: region, locked: locked}, nil
+}
+
+// noteLocked warns once if memory could not be locked, which usually means
+// RLIMIT_MEMLOCK is too low; callers must hold a.mu
+func (a *Arena) noteLocked(locked bool) {
+	if locked {
+		return
+	}
+	a.unlocked = true
+	a.warn.Do(func() {
+		fmt.Println("[warning] secure memory could not be locked into RAM and may be swapped; raise RLIMIT_MEMLOCK")
+	})
+}
+
+// Locked reports whether every buffer the arena has mapped is locked into RAM
+func (a *Arena) Locked() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return !a.unlocked
+}
+
+// Copy returns a buffer holding a copy of p
+func (a *Arena) Copy(p []byte) (*Buffer, error) {
+	b, err := a.Alloc(len(p))
+	if err != nil {
+		return nil, err
+	}
+	copy(b.block, p)
+	return b, nil
+}
+
+// CopyString returns a buffer holding a copy of s
+func (a *Arena) CopyString(s string) (*Buffer, error) {
+	b, err := a.Alloc(len(s))
+	if err != nil {
+		return nil, err
+	}
+	copy(b.block, s)
+	return b, nil
+}
+
+// Bytes returns the buffer's contents, which must not be used after Free.
+// An empty buffer returns an empty, non-nil slice.
+func (b *Buffer) Bytes() []byte {
+	if b.block == nil {
+		return []byte{}
+	}
+	return b.block[:b.n:b.n]
+}
+
+// String returns the contents as a string sharing the buffer's memory, so no
+// copy of the value lands on the heap. The string must not be used after
+// Free, when it reads as zero bytes or faults.
+func (b *Buffer) String() string {
+	if b.n == 0 {
+		return ""
+	}
+	return unsafe.String(&b.block[0], b.n)
+}
+
+// Len returns the number of bytes in the buffer
+func (b *Buffer) Len() int {
+	return b.n
+}
+
+// Free wipes the buffer and returns its memory to the arena. Freeing a
+// buffer twice is a no-op.
+func (b *Buffer) Free() {
+	if b == nil || b.block == nil {
+		return
+	}
+	Wipe(b.block)
+	if b.class < 0 {
+		unmap(b.region, b.block, b.locked)
+	} else {
+		b.arena.mu.Lock()
+		b.arena.free[b.class] = append(b.arena.free[b.class], b.block)
+		b.arena.mu.Unlock()
+	}
+	b.block, b.region, b.n = nil, nil, 0
+}
+
+// Wipe zeroes p in place
+func Wipe(p []byte) {
+	clear(p)
+	// Keep the compiler from treating the writes as dead
+	runtime.KeepAlive(p)
+}
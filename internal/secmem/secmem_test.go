@@ -0,0 +1,82 @@
+package secmem
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufferZeroedAfterFree(t *testing.T) {
+	arena := NewArena()
+	secret := []byte("correct horse battery staple")
+
+	buf, err := arena.Copy(secret)
+	if err != nil {
+		t.Fatalf("Copy returned an error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), secret) || buf.String() != string(secret) {
+		t.Fatalf("Expected %q, got %q", secret, buf.Bytes())
+	}
+
+	// Keep a view of the whole block to inspect it after release
+	block := buf.block
+	buf.Free()
+	for i, b := range block {
+		if b != 0 {
+			t.Fatalf("Byte %d not zeroed after Free: %#x", i, b)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected freed buffer to be empty, got %d bytes", buf.Len())
+	}
+	buf.Free() // a second free is a no-op
+
+	// The block is recycled and comes back zeroed
+	reused, err := arena.Alloc(len(secret))
+	if err != nil {
+		t.Fatalf("Alloc returned an error: %v", err)
+	}
+	defer reused.Free()
+	if &reused.block[0] != &block[0] {
+		t.Errorf("Expected the freed block to be reused")
+	}
+	if !bytes.Equal(reused.Bytes(), make([]byte, len(secret))) {
+		t.Errorf("Expected a zeroed buffer, got %q", reused.Bytes())
+	}
+}
+
+func TestLargeBuffer(t *testing.T) {
+	arena := NewArena()
+	secret := bytes.Repeat([]byte("s"), 3*arena.page+1)
+
+	buf, err := arena.Copy(secret)
+	if err != nil {
+		t.Fatalf("Copy returned an error: %v", err)
+	}
+	if buf.class != -1 || len(buf.block) != 4*arena.page {
+		t.Errorf("Expected a dedicated mapping of 4 pages, got class %d and %d bytes", buf.class, len(buf.block))
+	}
+	if !bytes.Equal(buf.Bytes(), secret) {
+		t.Errorf("Buffer does not hold the copied value")
+	}
+
+	// The mapping is gone after Free, so check the wipe on a live block
+	Wipe(buf.block)
+	if !bytes.Equal(buf.block, make([]byte, len(buf.block))) {
+		t.Errorf("Expected Wipe to zero the buffer")
+	}
+	buf.Free()
+}
+
+func TestEmptyBuffer(t *testing.T) {
+	buf, err := Alloc(0)
+	if err != nil {
+		t.Fatalf("Alloc returned an error: %v", err)
+	}
+	defer buf.Free()
+	if buf.Bytes() == nil || len(buf.Bytes()) != 0 || buf.String() != "" {
+		t.Errorf("Expected an empty, non-nil value, got %#v", buf.Bytes())
+	}
+	if _, err := Alloc(-1); err == nil {
+		t.Errorf("Expected an error for a negative size")
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"net/rpc"
+
+	"github.com/we-be/tritium/internal/secmem"
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// secureCodec is net/rpc's gob codec, except that values in replies are wiped
+// once they have been written to the client so they do not linger in the
+// heap until the next collection
+type secureCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func newSecureCodec(conn io.ReadWriteCloser) *secureCodec {
+	buf := bufio.NewWriter(conn)
+	return &secureCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+	}
+}
+
+func (c *secureCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *secureCodec) ReadRequestBody(body interface{}) error {
+	return c.dec.Decode(body)
+}
+
+func (c *secureCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	defer wipeReply(body)
+
+	if err := c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Gob couldn't encode the header; shut down the connection
+			c.Close()
+		}
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			// Was a gob problem encoding the body but the header has been
+			// written; shut down the connection to signal that it is broken
+			c.Close()
+		}
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *secureCodec) Close() error {
+	if c.closed {
+		// Only call c.rwc.Close once; otherwise the semantics are undefined
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
+
+// wipeReply zeroes the values carried by a reply: string values, hash
+// fields, queue items, set members and stream chunks
+func wipeReply(body interface{}) {
+	switch reply := body.(type) {
+	case *storage.GetReply:
+		secmem.Wipe(reply.Value)
+	case *storage.MGetReply:
+		for _, v := range reply.Values {
+			secmem.Wipe(v.Value)
+		}
+	case *storage.GetVersionReply:
+		secmem.Wipe(reply.Value)
+	case *storage.HGetReply:
+		secmem.Wipe(reply.Value)
+	case *storage.HGetAllReply:
+		for _, v := range reply.Fields {
+			secmem.Wipe(v)
+		}
+	case *storage.PopReply:
+		secmem.Wipe(reply.Value)
+	case *storage.LRangeReply:
+		for _, v := range reply.Values {
+			secmem.Wipe(v)
+		}
+	case *storage.SMembersReply:
+		for _, m := range reply.Members {
+			secmem.Wipe(m)
+		}
+	case *storage.ZRangeReply:
+		for _, m := range reply.Members {
+			secmem.Wipe(m.Member)
+		}
+	case *storage.StreamReadReply:
+		secmem.Wipe(reply.Data)
+	}
+}
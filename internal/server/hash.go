@@ -0,0 +1,211 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// HSet handles the HSet RPC call
+func (s *Server) HSet(args *storage.HSetArgs, reply *storage.HSetReply) error {
+	hashes, ok := s.store.(storage.HashBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || len(args.Fields) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Use the namespace or server default TTL if none provided
+	ttl, err := ns.resolveTTL(args.TTL, DefaultTTL)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	fields := make(map[string]string, len(args.Fields))
+	sizes := make(map[string]int64, len(args.Fields))
+	size := int64(0)
+	for field, value := range args.Fields {
+		fields[field] = string(value)
+		sizes[field] = int64(len(field) + len(value))
+		size += sizes[field]
+	}
+
+	undo, err := ns.reserveMembers(key, sizes, ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	added, err := hashes.HSet(key, fields, ttl)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Added = int(added)
+	atomic.AddInt64(&s.stats.BytesTransferred, size)
+	s.notify(storage.EventSet, key)
+	return nil
+}
+
+// HGet handles the HGet RPC call
+func (s *Server) HGet(args *storage.HGetArgs, reply *storage.HGetReply) error {
+	hashes, ok := s.store.(storage.HashBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	value, err := hashes.HGet(key, args.Field)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	v, errMsg := valueBytes(value)
+	if errMsg != "" {
+		reply.Error = errMsg
+		return nil
+	}
+
+	reply.Value = v
+	atomic.AddInt64(&s.stats.BytesTransferred, int64(len(v)))
+	return nil
+}
+
+// HGetAll handles the HGetAll RPC call
+func (s *Server) HGetAll(args *storage.HGetAllArgs, reply *storage.HGetAllReply) error {
+	hashes, ok := s.store.(storage.HashBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	fields, err := hashes.HGetAll(key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if len(fields) == 0 {
+		reply.Error = "key not found"
+		return nil
+	}
+
+	reply.Fields = fields
+	for field, value := range fields {
+		atomic.AddInt64(&s.stats.BytesTransferred, int64(len(field)+len(value)))
+	}
+	return nil
+}
+
+// HDel handles the HDel RPC call
+func (s *Server) HDel(args *storage.HDelArgs, reply *storage.HDelReply) error {
+	hashes, ok := s.store.(storage.HashBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || len(args.Fields) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	deleted, err := hashes.HDel(key, args.Fields...)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Deleted = int(deleted)
+	if deleted > 0 {
+		ns.releaseMembers(key, args.Fields...)
+		s.notify(storage.EventSet, key)
+	}
+	return nil
+}
+
+// HIncrBy handles the HIncrBy RPC call
+func (s *Server) HIncrBy(args *storage.HIncrByArgs, reply *storage.IncrByReply) error {
+	hashes, ok := s.store.(storage.HashBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || (args.TTL != nil && *args.TTL <= 0) {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Hashes created by an increment without an explicit or namespace TTL never expire
+	ttl, err := ns.resolveTTL(args.TTL, 0)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Only a new field is charged; incrementing an existing one is free
+	undo, err := ns.reserveMembers(key, map[string]int64{args.Field: int64(len(args.Field)) + counterSize}, ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	value, err := hashes.HIncrBy(key, args.Field, args.Delta, ttl)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Value = value
+	s.notify(storage.EventSet, key)
+	return nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// errHistoryDisabled is returned for version history calls in namespaces that
+// do not keep versions
+var errHistoryDisabled = errors.New("version history is not enabled for this namespace")
+
+// GetVersion handles the GetVersion RPC call, returning a kept version of a key
+func (s *Server) GetVersion(args *storage.GetVersionArgs, reply *storage.GetVersionReply) error {
+	versions, ok := s.store.(storage.HistoryBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || args.Version < 1 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if ns.history() == 0 {
+		reply.Error = errHistoryDisabled.Error()
+		return nil
+	}
+
+	entry, err := versions.GetVersion(key, args.Version)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Value = entry.Value
+	reply.Timestamp = entry.Timestamp.UnixMilli()
+	reply.TTL = entry.TTL
+	atomic.AddInt64(&s.stats.BytesTransferred, int64(len(entry.Value)))
+	return nil
+}
+
+// ListVersions handles the ListVersions RPC call
+func (s *Server) ListVersions(args *storage.GetArgs, reply *storage.ListVersionsReply) error {
+	versions, ok := s.store.(storage.HistoryBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if ns.history() == 0 {
+		reply.Error = errHistoryDisabled.Error()
+		return nil
+	}
+
+	entries, err := versions.ListVersions(key, ns.history())
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Versions = make([]storage.VersionInfo, len(entries))
+	for i, entry := range entries {
+		reply.Versions[i] = storage.VersionInfo{
+			Version:   entry.Version,
+			Timestamp: entry.Timestamp.UnixMilli(),
+			TTL:       entry.TTL,
+		}
+	}
+	return nil
+}
+
+// Rollback handles the Rollback RPC call, writing a kept version's value as
+// a new version so the history leading up to it is preserved
+func (s *Server) Rollback(args *storage.RollbackArgs, reply *storage.SetReply) error {
+	versions, ok := s.store.(storage.HistoryBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || args.Version < 1 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	keep := ns.history()
+	if keep == 0 {
+		reply.Error = errHistoryDisabled.Error()
+		return nil
+	}
+
+	ttl, err := ns.resolveTTL(args.TTL, DefaultTTL)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	entry, err := versions.GetVersion(key, args.Version)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	undo, err := ns.reserve(key, ns.keptSize(int64(len(entry.Value))), ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	version, err := versions.SetExKeep(key, ttl, string(entry.Value), storage.Condition{}, keep)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Version = version
+	s.notify(storage.EventSet, key)
+	return nil
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+const (
+	// bpopMinInterval and bpopMaxInterval bound how often BPop polls an empty queue
+	bpopMinInterval = 10 * time.Millisecond
+	bpopMaxInterval = 250 * time.Millisecond
+)
+
+// Push handles the Push RPC call
+func (s *Server) Push(args *storage.PushArgs, reply *storage.PushReply) error {
+	lists, ok := s.store.(storage.ListBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || len(args.Values) == 0 || (args.TTL != nil && *args.TTL <= 0) {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Queues without an explicit or namespace TTL never expire
+	ttl, err := ns.resolveTTL(args.TTL, 0)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	values, size := stringValues(args.Values)
+
+	undo, err := ns.reserve(key, ns.sizeOf(key)+size, ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	length, err := lists.Push(key, args.Front, values, ttl)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Length = int(length)
+	atomic.AddInt64(&s.stats.BytesTransferred, size)
+	s.notify(storage.EventSet, key)
+	return nil
+}
+
+// Pop handles the Pop RPC call, returning immediately if the queue is empty
+func (s *Server) Pop(args *storage.PopArgs, reply *storage.PopReply) error {
+	if args == nil || args.VisibilityTimeout < 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	if err := s.pop(key, ns, args, reply); err != nil {
+		reply.Error = err.Error()
+	}
+	return nil
+}
+
+// BPop handles the BPop RPC call, waiting up to args.Timeout seconds for an item
+func (s *Server) BPop(args *storage.PopArgs, reply *storage.PopReply) error {
+	if args == nil || args.Timeout <= 0 || args.VisibilityTimeout < 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Poll rather than BLPOP so a waiting client never pins a pooled connection
+	deadline := time.Now().Add(time.Duration(args.Timeout) * time.Second)
+	interval := bpopMinInterval
+	for {
+		err := s.pop(key, ns, args, reply)
+		if err != storage.ErrQueueEmpty {
+			if err != nil {
+				reply.Error = err.Error()
+			}
+			return nil
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			reply.Error = err.Error()
+			return nil
+		}
+		if interval < wait {
+			wait = interval
+		}
+
+		select {
+		case <-s.stopCh:
+			reply.Error = "server shutting down"
+			return nil
+		case <-time.After(wait):
+		}
+
+		if interval *= 2; interval > bpopMaxInterval {
+			interval = bpopMaxInterval
+		}
+	}
+}
+
+// pop takes one item from the queue at key, first returning any items whose
+// visibility timeout has expired. Items popped with a visibility timeout stay
+// charged to the namespace until they are acked.
+func (s *Server) pop(key string, ns *namespace, args *storage.PopArgs, reply *storage.PopReply) error {
+	lists, ok := s.store.(storage.ListBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if _, err := lists.RequeueExpired(key); err != nil {
+		return err
+	}
+
+	var (
+		value []byte
+		err   error
+	)
+	if args.VisibilityTimeout > 0 {
+		visibility := time.Duration(args.VisibilityTimeout) * time.Second
+		value, reply.Receipt, err = lists.PopReliable(key, args.Back, visibility)
+	} else {
+		value, err = lists.Pop(key, args.Back)
+		if err == nil {
+			ns.shrink(key, int64(len(value)))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	reply.Value = value
+	atomic.AddInt64(&s.stats.BytesTransferred, int64(len(value)))
+	s.notify(storage.EventPop, key)
+	return nil
+}
+
+// Ack handles the Ack RPC call
+func (s *Server) Ack(args *storage.AckArgs, reply *storage.AckReply) error {
+	lists, ok := s.store.(storage.ListBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || args.Receipt == "" {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	acked, err := lists.Ack(key, args.Receipt)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if acked == nil {
+		reply.Error = "receipt not found or lease expired"
+		return nil
+	}
+	ns.shrink(key, int64(len(acked)))
+	return nil
+}
+
+// LRange handles the LRange RPC call
+func (s *Server) LRange(args *storage.LRangeArgs, reply *storage.LRangeReply) error {
+	lists, ok := s.store.(storage.ListBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	values, err := lists.LRange(key, args.Start, args.Stop)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Values = values
+	for _, v := range values {
+		atomic.AddInt64(&s.stats.BytesTransferred, int64(len(v)))
+	}
+	return nil
+}
+
+// LLen handles the LLen RPC call
+func (s *Server) LLen(args *storage.LLenArgs, reply *storage.LLenReply) error {
+	lists, ok := s.store.(storage.ListBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	length, err := lists.LLen(key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Length = int(length)
+	return nil
+}
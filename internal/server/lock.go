@@ -0,0 +1,114 @@
+package server
+
+import (
+	"time"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// leaseDuration converts a lease in milliseconds, rejecting leases the
+// namespace does not allow
+func (ns *namespace) leaseDuration(ms int) (time.Duration, error) {
+	lease := time.Duration(ms) * time.Millisecond
+	seconds := int((lease + time.Second - 1) / time.Second)
+	if err := ns.checkTTL(seconds); err != nil {
+		return 0, err
+	}
+	return lease, nil
+}
+
+// Lock handles the Lock RPC call, trying once to acquire the lock
+func (s *Server) Lock(args *storage.LockArgs, reply *storage.LockReply) error {
+	locks, ok := s.store.(storage.LockBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || args.Lease <= 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	lease, err := ns.leaseDuration(args.Lease)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	owner, fence, err := locks.Lock(key, lease)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Owner = owner
+	reply.Fence = fence
+	s.notify(storage.EventSet, key)
+	return nil
+}
+
+// Renew handles the Renew RPC call, extending a lock held by args.Owner
+func (s *Server) Renew(args *storage.RenewArgs, reply *storage.RenewReply) error {
+	locks, ok := s.store.(storage.LockBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || args.Owner == "" || args.Lease <= 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	lease, err := ns.leaseDuration(args.Lease)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	if err := locks.Renew(key, args.Owner, lease); err != nil {
+		reply.Error = err.Error()
+	}
+	return nil
+}
+
+// Unlock handles the Unlock RPC call, releasing a lock held by args.Owner
+func (s *Server) Unlock(args *storage.UnlockArgs, reply *storage.UnlockReply) error {
+	locks, ok := s.store.(storage.LockBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || args.Owner == "" {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	if err := locks.Unlock(key, args.Owner); err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	s.notify(storage.EventDelete, key)
+	return nil
+}
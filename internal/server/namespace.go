@@ -0,0 +1,514 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/we-be/tritium/internal/config"
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// counterSize is the approximate size charged to a namespace for a counter
+const counterSize int64 = 8
+
+// namespace tracks the keys written through this node into a declared
+// namespace so its quotas can be enforced. Usage is per node: writes made
+// through other cluster nodes are not counted here.
+type namespace struct {
+	config.NamespaceConfig
+
+	mu      sync.Mutex
+	keys    map[string]nsEntry
+	uploads map[upload]nsEntry // staged stream chunks, charged to bytes but not keys
+	bytes   int64
+}
+
+// upload identifies a stream upload being staged for a key
+type upload struct {
+	key, id string
+}
+
+type nsEntry struct {
+	size    int64
+	expires time.Time        // zero if the key never expires
+	members map[string]int64 // sizes of a hash's fields or a set's members
+}
+
+func newNamespaces(configs []config.NamespaceConfig) (map[string]*namespace, error) {
+	namespaces := make(map[string]*namespace, len(configs))
+	for _, cfg := range configs {
+		if !config.ValidNamespaceName(cfg.Name) {
+			return nil, fmt.Errorf("invalid namespace name %q", cfg.Name)
+		}
+		if _, exists := namespaces[cfg.Name]; exists {
+			return nil, fmt.Errorf("duplicate namespace %q", cfg.Name)
+		}
+		namespaces[cfg.Name] = &namespace{
+			NamespaceConfig: cfg,
+			keys:            make(map[string]nsEntry),
+			uploads:         make(map[upload]nsEntry),
+		}
+	}
+	return namespaces, nil
+}
+
+// resolveKey maps a client key in the given namespace to the key stored in
+// the backend. The default namespace "" stores keys unprefixed, so it may not
+// use Tritium's bookkeeping keys or keys that begin with a declared
+// namespace's prefix.
+func (s *Server) resolveKey(name, key string) (string, *namespace, error) {
+	if name == "" {
+		if storage.IsMetaKey(key) {
+			return "", nil, fmt.Errorf("key %q is reserved", key)
+		}
+		if owner := s.owner(key); owner != nil {
+			return "", nil, fmt.Errorf("key %q is reserved for namespace %q", key, owner.Name)
+		}
+		return key, nil, nil
+	}
+
+	ns, ok := s.namespaces[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown namespace %q", name)
+	}
+	return ns.prefix() + key, ns, nil
+}
+
+// resolveKeys maps several client keys in the same namespace
+func (s *Server) resolveKeys(name string, keys []string) ([]string, *namespace, error) {
+	_, ns, err := s.resolveKey(name, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved := make([]string, len(keys))
+	for i, key := range keys {
+		if resolved[i], _, err = s.resolveKey(name, key); err != nil {
+			return nil, nil, err
+		}
+	}
+	return resolved, ns, nil
+}
+
+// owner returns the declared namespace whose prefix key begins with, or nil
+// if key belongs to the default namespace
+func (s *Server) owner(key string) *namespace {
+	name, _, found := strings.Cut(key, ":")
+	if !found {
+		return nil
+	}
+	return s.namespaces[name]
+}
+
+// defaultOnly drops messages a filter passes when their channel, or the key
+// an event is about, belongs to a declared namespace, so subscribers in the
+// default namespace do not see other namespaces' traffic through patterns
+func (s *Server) defaultOnly(filter messageFilter) messageFilter {
+	return func(msg storage.Message) (storage.Message, bool) {
+		msg, ok := filter(msg)
+		return msg, ok && s.owner(msg.Channel) == nil
+	}
+}
+
+func (ns *namespace) prefix() string {
+	return ns.Name + ":"
+}
+
+// resolveTTL picks the TTL for a write, applying the namespace default when the
+// caller did not supply one and rejecting TTLs above the namespace maximum
+func (ns *namespace) resolveTTL(ttl *int, fallback int) (int, error) {
+	if ttl == nil {
+		if ns != nil && ns.DefaultTTL > 0 {
+			return ns.DefaultTTL, nil
+		}
+		if ns != nil && fallback == 0 && ns.MaxTTL > 0 {
+			// Keys in a namespace with a maximum TTL must expire
+			return ns.MaxTTL, nil
+		}
+		return fallback, nil
+	}
+
+	if err := ns.checkTTL(*ttl); err != nil {
+		return 0, err
+	}
+	return *ttl, nil
+}
+
+// history returns how many versions Set keeps for keys in the namespace
+func (ns *namespace) history() int {
+	if ns == nil {
+		return 0
+	}
+	return ns.History
+}
+
+// keptSize returns what a value of size bytes written by Set costs the
+// namespace: the value itself and the copies its history keeps
+func (ns *namespace) keptSize(size int64) int64 {
+	return size * int64(1+ns.history())
+}
+
+// checkTTL rejects TTLs the namespace does not allow
+func (ns *namespace) checkTTL(ttl int) error {
+	if ns != nil && ns.MaxTTL > 0 && ttl > ns.MaxTTL {
+		return fmt.Errorf("ttl exceeds namespace maximum of %d seconds", ns.MaxTTL)
+	}
+	return nil
+}
+
+// reserve records a write of size bytes to key, failing if it would exceed the
+// namespace quotas. The returned function undoes the reservation if the write
+// does not go through.
+func (ns *namespace) reserve(key string, size int64, ttl int) (func(), error) {
+	if ns == nil {
+		return func() {}, nil
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	prev, existed := ns.keys[key]
+	if err := ns.checkQuota(existed, size-prev.size); err != nil {
+		// Expired keys may still be counted; drop them and check again
+		ns.pruneExpired(time.Now())
+		prev, existed = ns.keys[key]
+		if err := ns.checkQuota(existed, size-prev.size); err != nil {
+			return nil, err
+		}
+	}
+
+	ns.keys[key] = nsEntry{size: size, expires: expiryFromTTL(ttl)}
+	ns.bytes += size - prev.size
+
+	return func() {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+
+		ns.bytes -= size - prev.size
+		if existed {
+			ns.keys[key] = prev
+		} else {
+			delete(ns.keys, key)
+		}
+	}, nil
+}
+
+func (ns *namespace) checkQuota(existed bool, delta int64) error {
+	if ns.MaxKeys > 0 && !existed && int64(len(ns.keys)) >= ns.MaxKeys {
+		return fmt.Errorf("namespace %s key quota of %d exceeded", ns.Name, ns.MaxKeys)
+	}
+	if ns.MaxBytes > 0 && ns.bytes+delta > ns.MaxBytes {
+		return fmt.Errorf("namespace %s byte quota of %d exceeded", ns.Name, ns.MaxBytes)
+	}
+	return nil
+}
+
+// sizeOf returns the tracked size of key, so writes that grow a collection
+// can be charged incrementally
+func (ns *namespace) sizeOf(key string) int64 {
+	if ns == nil {
+		return 0
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	return ns.keys[key].size
+}
+
+// reserveMembers records a write that sets members of the container at key to
+// the given sizes, failing if it would exceed the namespace quotas. Only what
+// the members grow by is charged, so overwriting a member with one of the
+// same size is free. The returned function undoes the reservation.
+func (ns *namespace) reserveMembers(key string, sizes map[string]int64, ttl int) (func(), error) {
+	if ns == nil {
+		return func() {}, nil
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	growth := func(entry nsEntry) int64 {
+		var delta int64
+		for member, size := range sizes {
+			delta += size - entry.members[member]
+		}
+		return delta
+	}
+	entry, existed := ns.keys[key]
+	if err := ns.checkQuota(existed, growth(entry)); err != nil {
+		// Expired keys may still be counted; drop them and check again
+		ns.pruneExpired(time.Now())
+		entry, existed = ns.keys[key]
+		if err := ns.checkQuota(existed, growth(entry)); err != nil {
+			return nil, err
+		}
+	}
+
+	delta := growth(entry)
+	prev := make(map[string]int64, len(sizes))
+	if entry.members == nil {
+		entry.members = make(map[string]int64, len(sizes))
+	}
+	for member, size := range sizes {
+		if old, ok := entry.members[member]; ok {
+			prev[member] = old
+		}
+		entry.members[member] = size
+	}
+	entry.size += delta
+	entry.expires = expiryFromTTL(ttl)
+	ns.keys[key] = entry
+	ns.bytes += delta
+
+	return func() {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+
+		entry, ok := ns.keys[key]
+		if !ok {
+			return
+		}
+		for member := range sizes {
+			if old, ok := prev[member]; ok {
+				entry.members[member] = old
+			} else {
+				delete(entry.members, member)
+			}
+		}
+		entry.size -= delta
+		ns.bytes -= delta
+		if existed {
+			ns.keys[key] = entry
+		} else {
+			delete(ns.keys, key)
+		}
+	}, nil
+}
+
+// releaseMembers stops tracking members removed from the container at key,
+// and the key itself once it has none left
+func (ns *namespace) releaseMembers(key string, members ...string) {
+	if ns == nil {
+		return
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	entry, ok := ns.keys[key]
+	if !ok {
+		return
+	}
+	for _, member := range members {
+		if size, ok := entry.members[member]; ok {
+			entry.size -= size
+			ns.bytes -= size
+			delete(entry.members, member)
+		}
+	}
+	if len(entry.members) == 0 {
+		ns.bytes -= entry.size
+		delete(ns.keys, key)
+		return
+	}
+	ns.keys[key] = entry
+}
+
+// shrink releases size bytes removed from the list at key, and the key itself
+// once nothing is left of it
+func (ns *namespace) shrink(key string, size int64) {
+	if ns == nil {
+		return
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	entry, ok := ns.keys[key]
+	if !ok {
+		return
+	}
+	if size >= entry.size {
+		ns.bytes -= entry.size
+		delete(ns.keys, key)
+		return
+	}
+	entry.size -= size
+	ns.bytes -= size
+	ns.keys[key] = entry
+}
+
+// release stops tracking deleted keys
+func (ns *namespace) release(keys ...string) {
+	if ns == nil {
+		return
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	for _, key := range keys {
+		if entry, ok := ns.keys[key]; ok {
+			ns.bytes -= entry.size
+			delete(ns.keys, key)
+		}
+	}
+}
+
+// stage records a chunk of size bytes staged at index of an upload, failing if
+// it would exceed the byte quota. Restaging an index only charges what it
+// grows by. The charge lasts until the upload is committed or its chunks
+// expire. The returned function undoes the charge if the chunk is not staged.
+func (ns *namespace) stage(up upload, index int, size int64, ttl int) (func(), error) {
+	if ns == nil {
+		return func() {}, nil
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	member := strconv.Itoa(index)
+	entry := ns.uploads[up]
+	if err := ns.checkQuota(true, size-entry.members[member]); err != nil {
+		// Expired keys and uploads may still be counted; drop them and check again
+		ns.pruneExpired(time.Now())
+		entry = ns.uploads[up]
+		if err := ns.checkQuota(true, size-entry.members[member]); err != nil {
+			return nil, err
+		}
+	}
+
+	if entry.members == nil {
+		entry.members = make(map[string]int64)
+	}
+	prev, existed := entry.members[member]
+	delta := size - prev
+	entry.members[member] = size
+	entry.size += delta
+	entry.expires = expiryFromTTL(ttl)
+	ns.uploads[up] = entry
+	ns.bytes += delta
+
+	return func() {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+
+		entry, ok := ns.uploads[up]
+		if !ok {
+			return
+		}
+		if existed {
+			entry.members[member] = prev
+		} else {
+			delete(entry.members, member)
+		}
+		entry.size -= delta
+		ns.bytes -= delta
+		if len(entry.members) == 0 {
+			delete(ns.uploads, up)
+			return
+		}
+		ns.uploads[up] = entry
+	}, nil
+}
+
+// unstage releases the chunks staged for an upload once they become a value.
+// The returned function restores the charge if the commit does not go through.
+func (ns *namespace) unstage(up upload) func() {
+	if ns == nil {
+		return func() {}
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	entry, ok := ns.uploads[up]
+	if !ok {
+		return func() {}
+	}
+	delete(ns.uploads, up)
+	ns.bytes -= entry.size
+
+	return func() {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+
+		if _, ok := ns.uploads[up]; !ok {
+			ns.uploads[up] = entry
+			ns.bytes += entry.size
+		}
+	}
+}
+
+// setExpiry records a changed expiry for a tracked key
+func (ns *namespace) setExpiry(key string, expires time.Time) {
+	if ns == nil {
+		return
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if entry, ok := ns.keys[key]; ok {
+		entry.expires = expires
+		ns.keys[key] = entry
+	}
+}
+
+// pruneExpired drops expired keys and staged uploads; callers must hold ns.mu
+func (ns *namespace) pruneExpired(now time.Time) {
+	for key, entry := range ns.keys {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			ns.bytes -= entry.size
+			delete(ns.keys, key)
+		}
+	}
+	for up, entry := range ns.uploads {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			ns.bytes -= entry.size
+			delete(ns.uploads, up)
+		}
+	}
+}
+
+// info reports the namespace configuration and current usage
+func (ns *namespace) info() storage.NamespaceInfo {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	ns.pruneExpired(time.Now())
+	return storage.NamespaceInfo{
+		Name:       ns.Name,
+		DefaultTTL: ns.DefaultTTL,
+		MaxTTL:     ns.MaxTTL,
+		MaxKeys:    ns.MaxKeys,
+		MaxBytes:   ns.MaxBytes,
+		History:    ns.History,
+		Keys:       int64(len(ns.keys)),
+		Bytes:      ns.bytes,
+	}
+}
+
+func expiryFromTTL(ttl int) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(ttl) * time.Second)
+}
+
+// Namespaces handles the Namespaces RPC call
+func (s *Server) Namespaces(args struct{}, reply *storage.NamespacesReply) error {
+	reply.Namespaces = make([]storage.NamespaceInfo, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		reply.Namespaces = append(reply.Namespaces, ns.info())
+	}
+	sort.Slice(reply.Namespaces, func(i, j int) bool {
+		return reply.Namespaces[i].Name < reply.Namespaces[j].Name
+	})
+	return nil
+}
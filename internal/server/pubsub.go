@@ -0,0 +1,503 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+const (
+	// subscriptionBuffer is how many undelivered messages a subscription holds
+	// before the oldest are dropped
+	subscriptionBuffer = 1024
+	// maxReceiveWait caps how long a single Receive call may block
+	maxReceiveWait = 60 * time.Second
+	// subscriptionIdleTimeout drops subscriptions whose client stopped polling
+	subscriptionIdleTimeout = 2 * time.Minute
+	// resubscribeInterval is the delay before reopening a failed subscriber connection
+	resubscribeInterval = time.Second
+)
+
+var (
+	errSubscriptionNotFound = errors.New("subscription not found")
+	errShuttingDown         = errors.New("server shutting down")
+)
+
+// pubsub fans messages from a single dedicated backend subscriber connection
+// out to the subscriptions of every client on this node. Clients collect their
+// messages by long-polling Receive.
+type pubsub struct {
+	store  storage.PubSubBackend // nil if the backend has no pub/sub
+	stopCh <-chan struct{}
+
+	mu       sync.Mutex // guards sub and patterns
+	sub      *storage.Subscriber
+	patterns map[string]int // backend patterns and how many subscriptions use them
+
+	subsMu sync.RWMutex
+	subs   map[string]*subscription
+}
+
+type subscription struct {
+	prefix   string   // namespace prefix stripped from delivered channels
+	patterns []string // backend patterns, including the namespace prefix
+	filter   messageFilter
+
+	mu       sync.Mutex
+	queue    []storage.Message
+	notify   chan struct{}
+	polling  int
+	lastPoll time.Time
+	closed   bool
+}
+
+// messageFilter rewrites a message matching a subscription's patterns before
+// delivery, or drops it by returning false
+type messageFilter func(storage.Message) (storage.Message, bool)
+
+func newPubSub(store storage.PubSubBackend, stopCh <-chan struct{}) *pubsub {
+	ps := &pubsub{
+		store:    store,
+		stopCh:   stopCh,
+		patterns: make(map[string]int),
+		subs:     make(map[string]*subscription),
+	}
+	go ps.reapLoop()
+	return ps
+}
+
+// subscribe registers a subscription to the given backend patterns and returns
+// its ID. Messages are passed through filter before delivery.
+func (ps *pubsub) subscribe(prefix string, patterns []string, filter messageFilter) (string, error) {
+	id, err := newSubscriptionID()
+	if err != nil {
+		return "", err
+	}
+
+	sub := &subscription{
+		prefix:   prefix,
+		patterns: patterns,
+		filter:   filter,
+		notify:   make(chan struct{}, 1),
+		lastPoll: time.Now(),
+	}
+
+	// Register before subscribing so no message after the confirmation is missed
+	ps.subsMu.Lock()
+	ps.subs[id] = sub
+	ps.subsMu.Unlock()
+
+	if err := ps.addPatterns(patterns); err != nil {
+		ps.subsMu.Lock()
+		delete(ps.subs, id)
+		ps.subsMu.Unlock()
+		return "", err
+	}
+	return id, nil
+}
+
+// unsubscribe removes a subscription, waking any Receive waiting on it
+func (ps *pubsub) unsubscribe(id string) error {
+	ps.subsMu.Lock()
+	sub, ok := ps.subs[id]
+	delete(ps.subs, id)
+	ps.subsMu.Unlock()
+	if !ok {
+		return errSubscriptionNotFound
+	}
+
+	sub.close()
+	return ps.removePatterns(sub.patterns)
+}
+
+func (ps *pubsub) addPatterns(patterns []string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.store == nil {
+		return storage.ErrUnsupported
+	}
+	if ps.sub == nil {
+		sub, err := ps.store.NewSubscriber()
+		if err != nil {
+			return err
+		}
+		ps.sub = sub
+		go ps.dispatchLoop(sub)
+	}
+
+	var added []string
+	for _, pattern := range patterns {
+		if ps.patterns[pattern] == 0 {
+			added = append(added, pattern)
+		}
+		ps.patterns[pattern]++
+	}
+
+	if err := ps.sub.PSubscribe(added...); err != nil {
+		for _, pattern := range patterns {
+			ps.decrement(pattern)
+		}
+		return fmt.Errorf("failed to subscribe: %w", err)
+	}
+	return nil
+}
+
+func (ps *pubsub) removePatterns(patterns []string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	var removed []string
+	for _, pattern := range patterns {
+		if ps.decrement(pattern) {
+			removed = append(removed, pattern)
+		}
+	}
+
+	if ps.sub == nil {
+		return nil
+	}
+	if err := ps.sub.PUnsubscribe(removed...); err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+	return nil
+}
+
+// decrement drops one use of pattern, reporting whether it is no longer used;
+// callers must hold ps.mu
+func (ps *pubsub) decrement(pattern string) bool {
+	if ps.patterns[pattern]--; ps.patterns[pattern] > 0 {
+		return false
+	}
+	delete(ps.patterns, pattern)
+	return true
+}
+
+// dispatchLoop delivers messages from sub until its connection fails, then
+// reopens the connection and resubscribes every active pattern
+func (ps *pubsub) dispatchLoop(sub *storage.Subscriber) {
+	for msg := range sub.Messages() {
+		ps.dispatch(msg)
+	}
+
+	for {
+		select {
+		case <-ps.stopCh:
+			return
+		case <-time.After(resubscribeInterval):
+		}
+
+		err := ps.reconnect(sub)
+		if err == nil {
+			return
+		}
+		fmt.Printf("[warning] failed to reopen subscriber connection: %v\n", err)
+	}
+}
+
+func (ps *pubsub) reconnect(old *storage.Subscriber) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.sub != old {
+		// Closed or already replaced
+		return nil
+	}
+
+	sub, err := ps.store.NewSubscriber()
+	if err != nil {
+		return err
+	}
+
+	patterns := make([]string, 0, len(ps.patterns))
+	for pattern := range ps.patterns {
+		patterns = append(patterns, pattern)
+	}
+	if err := sub.PSubscribe(patterns...); err != nil {
+		sub.Close()
+		return err
+	}
+
+	ps.sub = sub
+	go ps.dispatchLoop(sub)
+	return nil
+}
+
+func (ps *pubsub) dispatch(msg storage.Message) {
+	ps.subsMu.RLock()
+	defer ps.subsMu.RUnlock()
+
+	for _, sub := range ps.subs {
+		for _, pattern := range sub.patterns {
+			if pattern == msg.Pattern {
+				sub.push(msg)
+				break
+			}
+		}
+	}
+}
+
+// reapLoop drops subscriptions whose clients have gone away without unsubscribing
+func (ps *pubsub) reapLoop() {
+	ticker := time.NewTicker(subscriptionIdleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ps.stopCh:
+			return
+		case now := <-ticker.C:
+			var idle []string
+			ps.subsMu.RLock()
+			for id, sub := range ps.subs {
+				if sub.idleSince(now) > subscriptionIdleTimeout {
+					idle = append(idle, id)
+				}
+			}
+			ps.subsMu.RUnlock()
+
+			for _, id := range idle {
+				if err := ps.unsubscribe(id); err != nil && err != errSubscriptionNotFound {
+					fmt.Printf("[warning] failed to drop idle subscription: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+func (ps *pubsub) get(id string) (*subscription, bool) {
+	ps.subsMu.RLock()
+	defer ps.subsMu.RUnlock()
+
+	sub, ok := ps.subs[id]
+	return sub, ok
+}
+
+// close shuts the backend subscriber connection
+func (ps *pubsub) close() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.sub != nil {
+		ps.sub.Close()
+		ps.sub = nil
+	}
+}
+
+func (sub *subscription) push(msg storage.Message) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	msg, ok := sub.filter(msg)
+	if !ok {
+		return
+	}
+	if len(sub.queue) >= subscriptionBuffer {
+		sub.queue = sub.queue[1:]
+	}
+
+	msg.Pattern = strings.TrimPrefix(msg.Pattern, sub.prefix)
+	msg.Channel = strings.TrimPrefix(msg.Channel, sub.prefix)
+	sub.queue = append(sub.queue, msg)
+
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+// receive returns the queued messages, waiting up to wait for the first one
+func (sub *subscription) receive(wait time.Duration, stopCh <-chan struct{}) ([]storage.Message, error) {
+	sub.mu.Lock()
+	sub.polling++
+	sub.mu.Unlock()
+
+	defer func() {
+		sub.mu.Lock()
+		sub.polling--
+		sub.lastPoll = time.Now()
+		sub.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		sub.mu.Lock()
+		if sub.closed {
+			sub.mu.Unlock()
+			return nil, errSubscriptionNotFound
+		}
+		if len(sub.queue) > 0 {
+			msgs := sub.queue
+			sub.queue = nil
+			sub.mu.Unlock()
+			return msgs, nil
+		}
+		sub.mu.Unlock()
+
+		select {
+		case <-sub.notify:
+		case <-timer.C:
+			return nil, nil
+		case <-stopCh:
+			return nil, errShuttingDown
+		}
+	}
+}
+
+func (sub *subscription) idleSince(now time.Time) time.Duration {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.polling > 0 {
+		return 0
+	}
+	return now.Sub(sub.lastPoll)
+}
+
+func (sub *subscription) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.closed = true
+	sub.queue = nil
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+// publicMessages hides the internal event channels from pattern subscriptions
+func publicMessages(msg storage.Message) (storage.Message, bool) {
+	return msg, !isInternalChannel(msg.Channel)
+}
+
+func newSubscriptionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate subscription id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Publish handles the Publish RPC call
+func (s *Server) Publish(args *storage.PublishArgs, reply *storage.PublishReply) error {
+	if args == nil || args.Channel == "" {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	channel, _, err := s.resolveKey(args.Namespace, args.Channel)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if isInternalChannel(channel) {
+		reply.Error = "channel name is reserved"
+		return nil
+	}
+
+	store, ok := s.store.(storage.PubSubBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	receivers, err := store.Publish(channel, string(args.Message))
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Receivers = int(receivers)
+	return nil
+}
+
+// Subscribe handles the Subscribe RPC call, registering a subscription whose
+// messages are collected with Receive
+func (s *Server) Subscribe(args *storage.SubscribeArgs, reply *storage.SubscribeReply) error {
+	if args == nil || len(args.Patterns) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+	for _, pattern := range args.Patterns {
+		if pattern == "" {
+			reply.Error = "invalid arguments"
+			return nil
+		}
+	}
+
+	patterns, ns, err := s.resolveKeys(args.Namespace, args.Patterns)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	var prefix string
+	filter := s.defaultOnly(publicMessages)
+	if ns != nil {
+		prefix, filter = ns.prefix(), publicMessages
+	}
+
+	id, err := s.pubsub.subscribe(prefix, patterns, filter)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.SubscriptionID = id
+	return nil
+}
+
+// Receive handles the Receive RPC call, waiting up to args.Timeout seconds for
+// messages on a subscription
+func (s *Server) Receive(args *storage.ReceiveArgs, reply *storage.ReceiveReply) error {
+	if args == nil || args.Timeout < 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	sub, ok := s.pubsub.get(args.SubscriptionID)
+	if !ok {
+		reply.Error = errSubscriptionNotFound.Error()
+		return nil
+	}
+
+	wait := time.Duration(args.Timeout) * time.Second
+	if wait > maxReceiveWait {
+		wait = maxReceiveWait
+	}
+
+	msgs, err := sub.receive(wait, s.stopCh)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Messages = msgs
+	return nil
+}
+
+// Unsubscribe handles the Unsubscribe RPC call
+func (s *Server) Unsubscribe(args *storage.UnsubscribeArgs, reply *storage.UnsubscribeReply) error {
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	if err := s.pubsub.unsubscribe(args.SubscriptionID); err != nil {
+		reply.Error = err.Error()
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"time"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// RateLimit handles the RateLimit RPC call
+func (s *Server) RateLimit(args *storage.RateLimitArgs, reply *storage.RateLimitReply) error {
+	limiter, ok := s.store.(storage.RateLimitBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || args.Limit <= 0 || args.Window <= 0 || args.Cost < 0 || args.Cost > args.Limit {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	cost := args.Cost
+	if cost == 0 {
+		cost = 1
+	}
+
+	window := time.Duration(args.Window) * time.Millisecond
+	result, err := limiter.RateLimit(key, int64(args.Limit), window, int64(cost))
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Allowed = result.Allowed
+	reply.Remaining = int(result.Remaining)
+	reply.ResetAfter = int(result.ResetAfter.Milliseconds())
+	reply.RetryAfter = int(result.RetryAfter.Milliseconds())
+	return nil
+}
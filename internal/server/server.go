@@ -1,48 +1,150 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/rpc"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/we-be/tritium/internal/config"
+	"github.com/we-be/tritium/internal/crypto"
+	"github.com/we-be/tritium/internal/secmem"
 	"github.com/we-be/tritium/pkg/storage"
 )
 
 const DefaultTTL int = 17600
 
 type Server struct {
-	store    *storage.RespServer
-	listener net.Listener
-	rpc      *rpc.Server
-	stats    ServerStats
-	stopCh   chan struct{}
-	cluster  *ClusterInfo // New field
+	store      storage.Backend
+	listener   net.Listener
+	rpc        *rpc.Server
+	stats      ServerStats
+	stopCh     chan struct{}
+	cluster    *ClusterInfo // New field
+	namespaces map[string]*namespace
+	pubsub     *pubsub
+	notifier   *notifier // nil if the backend has no pub/sub
+
+	expiryEvents sync.Once
 }
 
 type ServerStats struct {
 	ActiveConnections int64
 	BytesTransferred  int64
+
+	// Memory use as reported by the backend; zero if it does not report it
+	MemoryUsed     int64
+	MemoryLimit    int64
+	Evictions      int64
+	EvictionPolicy string
+
+	// Connection pools to the backend's servers, primary first
+	Pools []storage.PoolStats
 }
 
-// NewServer creates a new Tritium server
+// NewServer creates a new Tritium server using the backend selected by the config
 func NewServer(config config.Config) (*Server, error) {
-	// Initialize with empty replica list - we'll add replicas through the cluster
-	store, err := storage.NewRespServer(
-		config.MemStoreAddr,
-		config.MaxConnections,
-		[]string{}, // Start with no replicas
-	)
+	store, err := newBackend(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewServerWithBackend(config, store)
+}
+
+// newBackend creates the storage engine named by config.Backend
+func newBackend(cfg config.Config) (storage.Backend, error) {
+	switch cfg.Backend {
+	case "", config.BackendRESP:
+		// Initialize with empty replica list - we'll add replicas through the cluster
+		store, err := storage.NewRespServer(
+			cfg.MemStoreAddr,
+			cfg.MaxConnections,
+			[]string{}, // Start with no replicas
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create RESP server: %w", err)
+		}
+		if cfg.MemoryLimit > 0 || cfg.EvictionPolicy != "" {
+			policy, err := storage.ParseEvictionPolicy(cfg.EvictionPolicy)
+			if err != nil {
+				store.Close()
+				return nil, err
+			}
+			if err := store.SetMemoryLimit(cfg.MemoryLimit, policy); errors.Is(err, storage.ErrUnsupported) {
+				store.Close()
+				return nil, err
+			} else if err != nil {
+				fmt.Printf("[warning] memory limit not applied: %v\n", err)
+			}
+		}
+		if cfg.EncryptValues {
+			sealer, err := newSealer(cfg.EncryptionKey)
+			if err != nil {
+				store.Close()
+				return nil, err
+			}
+			if cfg.AllowUnsealed {
+				fmt.Println("[warning] ALLOW_UNSEALED_READS is set; values stored without sealing are returned as they are")
+				sealer.AllowUnsealed()
+			}
+			store.SetSealer(sealer)
+		}
+		store.EnablePipelining(cfg.PipelineConns)
+		return store, nil
+	case config.BackendMemory:
+		policy, err := storage.ParseEvictionPolicy(cfg.EvictionPolicy)
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewMemoryBackend(cfg.MemoryLimit, policy), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// newSealer creates the sealer for values written to a RESP backend, with the
+// data key from keyFile or a fresh one if keyFile is empty. The key only ever
+// lives in this process.
+func newSealer(keyFile string) (*crypto.Sealer, error) {
+	var key *secmem.Buffer
+	var err error
+	if keyFile != "" {
+		key, err = crypto.LoadKey(keyFile)
+	} else {
+		fmt.Println("[warning] no ENCRYPTION_KEY_FILE; values are sealed under a key generated for this run")
+		key, err = crypto.GenerateKey()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create RESP server: %w", err)
+		return nil, err
+	}
+	defer key.Free()
+
+	return crypto.NewSealer(key.Bytes())
+}
+
+// NewServerWithBackend creates a new Tritium server that stores values in the
+// given backend, which the server closes when stopped. Operations the backend
+// does not implement fail with storage.ErrUnsupported.
+func NewServerWithBackend(config config.Config, store storage.Backend) (*Server, error) {
+	namespaces, err := newNamespaces(config.Namespaces)
+	if err != nil {
+		store.Close()
+		return nil, err
 	}
 
 	srv := &Server{
-		store:  store,
-		rpc:    rpc.NewServer(),
-		stopCh: make(chan struct{}),
+		store:      store,
+		rpc:        rpc.NewServer(),
+		stopCh:     make(chan struct{}),
+		namespaces: namespaces,
 	}
+	pubsubStore, _ := store.(storage.PubSubBackend)
+	srv.pubsub = newPubSub(pubsubStore, srv.stopCh)
+	srv.notifier = newNotifier(pubsubStore, srv.stopCh)
 
 	// Register RPC methods
 	if err := srv.rpc.RegisterName("Store", srv); err != nil {
@@ -102,30 +204,86 @@ func (s *Server) serveConn(conn net.Conn) {
 		conn.Close()
 		atomic.AddInt64(&s.stats.ActiveConnections, -1)
 	}()
-	s.rpc.ServeConn(conn)
+	s.rpc.ServeCodec(newSecureCodec(conn))
 }
 
 // Set handles the Set RPC call
 func (s *Server) Set(args *storage.SetArgs, reply *storage.SetReply) error {
-	if args == nil {
+	if args == nil || args.MaxReads < 0 {
 		reply.Error = "invalid arguments"
 		return nil
 	}
 
-	// Use default TTL if none provided
-	ttl := DefaultTTL
-	if args.TTL != nil {
-		ttl = *args.TTL
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
 	}
 
-	value := string(args.Value)
-	_, err := s.store.SetEx(args.Key, ttl, value)
+	// Use the namespace or server default TTL if none provided
+	ttl, err := ns.resolveTTL(args.TTL, DefaultTTL)
 	if err != nil {
 		reply.Error = err.Error()
 		return nil
 	}
 
+	keep := ns.history()
+	if keep > 0 && args.MaxReads > 0 {
+		// History would keep copies of a value meant to self-destruct
+		reply.Error = "read-limited values cannot be kept in version history"
+		return nil
+	}
+	versions, ok := s.store.(storage.HistoryBackend)
+	if keep > 0 && !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	undo, err := ns.reserve(key, ns.keptSize(int64(len(args.Value))), ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	cond := storage.Condition{
+		Mode:      args.Condition,
+		IfVersion: args.IfVersion,
+	}
+	if args.IfValue != nil {
+		ifValue := string(args.IfValue)
+		cond.IfValue = &ifValue
+	}
+
+	// Hold the value in secure memory and wipe the decoded copy
+	buf, err := secmem.Copy(args.Value)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+	defer buf.Free()
+	secmem.Wipe(args.Value)
+
+	value := buf.String()
+	var version int64
+	if keep > 0 {
+		version, err = versions.SetExKeep(key, ttl, value, cond, keep)
+	} else {
+		version, err = s.store.SetExIf(key, ttl, value, cond, args.MaxReads)
+	}
+	if errors.Is(err, storage.ErrMemoryLimit) {
+		// Drop backend context so clients can match the error
+		err = storage.ErrMemoryLimit
+	}
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Version = version
 	atomic.AddInt64(&s.stats.BytesTransferred, int64(len(args.Value)))
+	s.notify(storage.EventSet, key)
 	return nil
 }
 
@@ -136,42 +294,452 @@ func (s *Server) Get(args *storage.GetArgs, reply *storage.GetReply) error {
 		return nil
 	}
 
-	value, err := s.store.Get(args.Key)
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	item, err := s.store.Get(key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	v, errMsg := valueBytes(item.Value)
+	if errMsg != "" {
+		reply.Error = errMsg
+		return nil
+	}
+
+	reply.Value = v
+	reply.Version = item.Version
+	s.spendRead(key, ns, item, reply)
+	atomic.AddInt64(&s.stats.BytesTransferred, int64(len(v)))
+	return nil
+}
+
+// spendRead accounts for a read of a read-limited value, releasing the key
+// from its namespace once the last read deleted it, and reports the reads
+// left to the client
+func (s *Server) spendRead(key string, ns *namespace, item storage.Item, reply *storage.GetReply) {
+	if !item.Limited {
+		return
+	}
+	if item.ReadsLeft == 0 {
+		ns.release(key)
+		s.notify(storage.EventDelete, key)
+	}
+	reply.Limited = true
+	reply.ReadsLeft = item.ReadsLeft
+}
+
+// MGet handles the MGet RPC call
+func (s *Server) MGet(args *storage.MGetArgs, reply *storage.MGetReply) error {
+	if args == nil || len(args.Keys) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	keys, ns, err := s.resolveKeys(args.Namespace, args.Keys)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	items, err := s.store.MGet(keys...)
 	if err != nil {
 		reply.Error = err.Error()
 		return nil
 	}
 
+	reply.Values = make([]storage.GetReply, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			reply.Values[i].Error = item.Err.Error()
+			continue
+		}
+		v, errMsg := valueBytes(item.Value)
+		reply.Values[i] = storage.GetReply{Value: v, Error: errMsg}
+		if errMsg == "" {
+			reply.Values[i].Version = item.Version
+			s.spendRead(keys[i], ns, item, &reply.Values[i])
+		}
+		atomic.AddInt64(&s.stats.BytesTransferred, int64(len(v)))
+	}
+
+	return nil
+}
+
+// MSet handles the MSet RPC call
+func (s *Server) MSet(args *storage.MSetArgs, reply *storage.MSetReply) error {
+	if args == nil || len(args.Entries) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	reply.Results = make([]storage.SetReply, len(args.Entries))
+
+	// Invalid entries are reported individually and left out of the batch
+	entries := make([]storage.Entry, 0, len(args.Entries))
+	indexes := make([]int, 0, len(args.Entries))
+	undos := make([]func(), 0, len(args.Entries))
+	bufs := make([]*secmem.Buffer, 0, len(args.Entries))
+	defer func() {
+		for _, buf := range bufs {
+			buf.Free()
+		}
+	}()
+	for i, e := range args.Entries {
+		// Read limits are only supported by Set
+		if e.Key == "" || e.MaxReads != 0 {
+			reply.Results[i].Error = "invalid arguments"
+			continue
+		}
+
+		key, ns, err := s.resolveKey(e.Namespace, e.Key)
+		if err != nil {
+			reply.Results[i].Error = err.Error()
+			continue
+		}
+
+		// Use the namespace or server default TTL if none provided
+		ttl, err := ns.resolveTTL(e.TTL, DefaultTTL)
+		if err == nil && ttl <= 0 {
+			err = fmt.Errorf("invalid arguments")
+		}
+		if err != nil {
+			reply.Results[i].Error = err.Error()
+			continue
+		}
+
+		undo, err := ns.reserve(key, int64(len(e.Value)), ttl)
+		if err != nil {
+			reply.Results[i].Error = err.Error()
+			continue
+		}
+
+		buf, err := secmem.Copy(e.Value)
+		if err != nil {
+			undo()
+			reply.Results[i].Error = err.Error()
+			continue
+		}
+		bufs = append(bufs, buf)
+		secmem.Wipe(e.Value)
+
+		entries = append(entries, storage.Entry{Key: key, Value: buf.String(), TTL: ttl})
+		indexes = append(indexes, i)
+		undos = append(undos, undo)
+	}
+
+	writes, err := s.store.MSetEx(entries)
+	if err != nil {
+		for _, undo := range undos {
+			undo()
+		}
+		reply.Error = err.Error()
+		return nil
+	}
+
+	written := make([]string, 0, len(writes))
+	for j, w := range writes {
+		i := indexes[j]
+		if w.Err != nil {
+			undos[j]()
+			reply.Results[i].Error = w.Err.Error()
+			continue
+		}
+		reply.Results[i].Version = w.Version
+		written = append(written, entries[j].Key)
+		atomic.AddInt64(&s.stats.BytesTransferred, int64(len(args.Entries[i].Value)))
+	}
+
+	s.notify(storage.EventSet, written...)
+	return nil
+}
+
+// valueBytes converts a value read from the store into the bytes returned to
+// clients, or the error message to report instead
+func valueBytes(value interface{}) ([]byte, string) {
 	switch v := value.(type) {
 	case []byte:
 		if len(v) == 0 {
-			reply.Error = "key not found"
-			return nil
+			return nil, "key not found"
 		}
-		reply.Value = v
-		atomic.AddInt64(&s.stats.BytesTransferred, int64(len(v)))
+		return v, ""
 	case string:
 		if v == "" {
-			reply.Error = "key not found"
-			return nil
+			return nil, "key not found"
 		}
-		reply.Value = []byte(v)
-		atomic.AddInt64(&s.stats.BytesTransferred, int64(len(v)))
+		return []byte(v), ""
 	case nil:
-		reply.Error = "key not found"
+		return nil, "key not found"
 	default:
-		reply.Error = "unexpected value type"
+		return nil, "unexpected value type"
+	}
+}
+
+// stringValues converts values sent by clients into the strings written to the
+// store and returns their total size in bytes
+func stringValues(values [][]byte) ([]string, int64) {
+	strs := make([]string, len(values))
+	size := int64(0)
+	for i, v := range values {
+		strs[i] = string(v)
+		size += int64(len(v))
+	}
+	return strs, size
+}
+
+// IncrBy handles the IncrBy RPC call
+func (s *Server) IncrBy(args *storage.IncrByArgs, reply *storage.IncrByReply) error {
+	if args == nil || (args.TTL != nil && *args.TTL <= 0) {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Counters without an explicit or namespace TTL never expire
+	ttl, err := ns.resolveTTL(args.TTL, 0)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	undo, err := ns.reserve(key, counterSize, ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	value, err := s.store.IncrBy(key, args.Delta, ttl)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Value = value
+	s.notify(storage.EventSet, key)
+	return nil
+}
+
+// Delete handles the Delete RPC call
+func (s *Server) Delete(args *storage.DeleteArgs, reply *storage.DeleteReply) error {
+	if args == nil || len(args.Keys) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	keys, ns, err := s.resolveKeys(args.Namespace, args.Keys)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	deleted, err := s.store.Delete(keys...)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	ns.release(keys...)
+	reply.Deleted = len(deleted)
+	s.notify(storage.EventDelete, deleted...)
+	return nil
+}
+
+// Scan handles the Scan RPC call
+func (s *Server) Scan(args *storage.ScanArgs, reply *storage.ScanReply) error {
+	if args == nil || args.Count < 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	pattern := args.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	// Scan within the namespace and hand back unprefixed keys
+	pattern, ns, err := s.resolveKey(args.Namespace, pattern)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	cursor, keys, err := s.store.Scan(args.Cursor, pattern, args.Count)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	if ns != nil {
+		for i, key := range keys {
+			keys[i] = strings.TrimPrefix(key, ns.prefix())
+		}
+	} else {
+		// A pattern in the default namespace can match namespaced keys
+		visible := keys[:0]
+		for _, key := range keys {
+			if s.owner(key) == nil {
+				visible = append(visible, key)
+			}
+		}
+		keys = visible
+	}
+
+	reply.Cursor = cursor
+	reply.Keys = keys
+	return nil
+}
+
+// TTL handles the TTL RPC call
+func (s *Server) TTL(args *storage.TTLArgs, reply *storage.TTLReply) error {
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	ttl, err := s.store.TTL(key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if ttl == -2 {
+		reply.Error = "key not found"
+		return nil
+	}
+
+	reply.TTL = int(ttl)
+	return nil
+}
+
+// Expire handles the Expire RPC call
+func (s *Server) Expire(args *storage.ExpireArgs, reply *storage.ExpireReply) error {
+	if args == nil || args.TTL <= 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err == nil {
+		err = ns.checkTTL(args.TTL)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	updated, err := s.store.Expire(key, args.TTL)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if !updated {
+		reply.Error = "key not found"
+		return nil
 	}
 
+	ns.setExpiry(key, expiryFromTTL(args.TTL))
+	reply.Updated = true
+	s.notify(storage.EventTTL, key)
+	return nil
+}
+
+// ExpireAt handles the ExpireAt RPC call
+func (s *Server) ExpireAt(args *storage.ExpireAtArgs, reply *storage.ExpireReply) error {
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	expires := time.Unix(args.Timestamp, 0)
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err == nil {
+		err = ns.checkTTL(int(time.Until(expires).Seconds()))
+	}
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	updated, err := s.store.ExpireAt(key, args.Timestamp)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if !updated {
+		reply.Error = "key not found"
+		return nil
+	}
+
+	ns.setExpiry(key, expires)
+	reply.Updated = true
+	s.notify(storage.EventTTL, key)
+	return nil
+}
+
+// Persist handles the Persist RPC call
+func (s *Server) Persist(args *storage.PersistArgs, reply *storage.ExpireReply) error {
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err == nil && ns != nil && ns.MaxTTL > 0 {
+		err = fmt.Errorf("keys in namespace %s must expire", ns.Name)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	updated, err := s.store.Persist(key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	ns.setExpiry(key, time.Time{})
+	reply.Updated = updated
+	if updated {
+		s.notify(storage.EventTTL, key)
+	}
 	return nil
 }
 
 // Stats returns current server statistics
 func (s *Server) Stats() ServerStats {
-	return ServerStats{
+	stats := ServerStats{
 		ActiveConnections: atomic.LoadInt64(&s.stats.ActiveConnections),
 		BytesTransferred:  atomic.LoadInt64(&s.stats.BytesTransferred),
 	}
+	if reporter, ok := s.store.(storage.MemoryReporter); ok {
+		if mem, err := reporter.MemoryStats(); err == nil {
+			stats.MemoryUsed = mem.Used
+			stats.MemoryLimit = mem.Limit
+			stats.Evictions = mem.Evicted
+			stats.EvictionPolicy = string(mem.Policy)
+		}
+	}
+	if reporter, ok := s.store.(storage.PoolReporter); ok {
+		stats.Pools = reporter.PoolStats()
+	}
+	return stats
 }
 
 // Stop gracefully shuts down the server
@@ -191,7 +759,12 @@ func (s *Server) Stop() error {
 		}
 	}
 
-	// Close RESP store
+	// Close the subscriber connection before the pooled ones, which are still
+	// needed to publish the last change events
+	s.pubsub.close()
+	s.notifier.wait()
+
+	// Close the storage backend
 	if err := s.store.Close(); err != nil {
 		return fmt.Errorf("failed to close store: %w", err)
 	}
@@ -1,10 +1,25 @@
 package server
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/rpc"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/we-be/tritium/internal/config"
+	"github.com/we-be/tritium/internal/crypto"
+	"github.com/we-be/tritium/internal/resp"
 	"github.com/we-be/tritium/pkg/storage"
 )
 
@@ -139,3 +154,2532 @@ func TestServerReadWrite(t *testing.T) {
 		t.Errorf("Expected %d bytes transferred, got %d", expectedBytes, srv.stats.BytesTransferred)
 	}
 }
+
+// testConfig returns the configuration of a test server backed by the RESP
+// server the tests expect on localhost
+func testConfig() config.Config {
+	return config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 10,
+	}
+}
+
+// startTestServer creates and starts a server backed by the local RESP store
+// and returns an RPC client connected to it
+func startTestServer(t *testing.T) (*Server, *rpc.Client) {
+	t.Helper()
+
+	return startTestServerWithConfig(t, testConfig())
+}
+
+// forEachBackend runs test as a subtest against a server started from cfg on
+// each storage engine that supports the key/value operations it exercises
+func forEachBackend(t *testing.T, cfg config.Config, test func(t *testing.T, client *rpc.Client)) {
+	for _, backend := range []string{config.BackendRESP, config.BackendMemory} {
+		t.Run(backend, func(t *testing.T) {
+			cfg.Backend = backend
+			_, client := startTestServerWithConfig(t, cfg)
+			test(t, client)
+		})
+	}
+}
+
+// startTestServerWithConfig is startTestServer for cfg. The server is stopped
+// and the client closed when the test ends.
+func startTestServerWithConfig(t *testing.T, cfg config.Config) (*Server, *rpc.Client) {
+	t.Helper()
+
+	srv, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := srv.Start(testAddr); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := srv.Stop(); err != nil {
+			t.Errorf("Failed to stop server: %v", err)
+		}
+	})
+
+	client, err := rpc.Dial("tcp", srv.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return srv, client
+}
+
+func TestServerDelete(t *testing.T) {
+	forEachBackend(t, testConfig(), testServerDelete)
+}
+
+func testServerDelete(t *testing.T, client *rpc.Client) {
+
+	for _, key := range []string{"test-del-1", "test-del-2"} {
+		setReply := &storage.SetReply{}
+		if err := client.Call("Store.Set", &storage.SetArgs{Key: key, Value: []byte("secret")}, setReply); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+		if setReply.Error != "" {
+			t.Fatalf("Set operation failed: %v", setReply.Error)
+		}
+	}
+
+	delReply := &storage.DeleteReply{}
+	err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{"test-del-1", "test-del-2", "test-del-missing"}}, delReply)
+	if err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+	if delReply.Error != "" {
+		t.Fatalf("Delete operation failed: %v", delReply.Error)
+	}
+	if delReply.Deleted != 2 {
+		t.Errorf("Expected 2 keys deleted, got %d", delReply.Deleted)
+	}
+
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-del-1"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if getReply.Error != "key not found" {
+		t.Errorf("Expected 'key not found' error, got: %v", getReply.Error)
+	}
+}
+
+func TestServerTTL(t *testing.T) {
+	forEachBackend(t, testConfig(), testServerTTL)
+}
+
+func testServerTTL(t *testing.T, client *rpc.Client) {
+
+	ttl := 100
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-ttl", Value: []byte("session"), TTL: &ttl}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != "" {
+		t.Fatalf("Set operation failed: %v", setReply.Error)
+	}
+
+	ttlReply := &storage.TTLReply{}
+	if err := client.Call("Store.TTL", &storage.TTLArgs{Key: "test-ttl"}, ttlReply); err != nil {
+		t.Fatalf("TTL RPC call failed: %v", err)
+	}
+	if ttlReply.TTL <= 0 || ttlReply.TTL > ttl {
+		t.Errorf("Expected TTL in (0, %d], got %d", ttl, ttlReply.TTL)
+	}
+
+	expireReply := &storage.ExpireReply{}
+	if err := client.Call("Store.Expire", &storage.ExpireArgs{Key: "test-ttl", TTL: 5000}, expireReply); err != nil {
+		t.Fatalf("Expire RPC call failed: %v", err)
+	}
+	if !expireReply.Updated {
+		t.Errorf("Expected Expire to update the key, got error %q", expireReply.Error)
+	}
+
+	ttlReply = &storage.TTLReply{}
+	if err := client.Call("Store.TTL", &storage.TTLArgs{Key: "test-ttl"}, ttlReply); err != nil {
+		t.Fatalf("TTL RPC call failed: %v", err)
+	}
+	if ttlReply.TTL <= ttl {
+		t.Errorf("Expected TTL to be extended past %d, got %d", ttl, ttlReply.TTL)
+	}
+
+	persistReply := &storage.ExpireReply{}
+	if err := client.Call("Store.Persist", &storage.PersistArgs{Key: "test-ttl"}, persistReply); err != nil {
+		t.Fatalf("Persist RPC call failed: %v", err)
+	}
+	if !persistReply.Updated {
+		t.Errorf("Expected Persist to remove the TTL")
+	}
+
+	ttlReply = &storage.TTLReply{}
+	if err := client.Call("Store.TTL", &storage.TTLArgs{Key: "test-ttl"}, ttlReply); err != nil {
+		t.Fatalf("TTL RPC call failed: %v", err)
+	}
+	if ttlReply.TTL != -1 {
+		t.Errorf("Expected TTL -1 after Persist, got %d", ttlReply.TTL)
+	}
+
+	expireReply = &storage.ExpireReply{}
+	if err := client.Call("Store.Expire", &storage.ExpireArgs{Key: "test-ttl-missing", TTL: 10}, expireReply); err != nil {
+		t.Fatalf("Expire RPC call failed: %v", err)
+	}
+	if expireReply.Error != "key not found" {
+		t.Errorf("Expected 'key not found' error, got: %v", expireReply.Error)
+	}
+
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{"test-ttl"}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerMSetMGet(t *testing.T) {
+	forEachBackend(t, testConfig(), testServerMSetMGet)
+}
+
+func testServerMSetMGet(t *testing.T, client *rpc.Client) {
+
+	badTTL := -1
+	msetArgs := &storage.MSetArgs{
+		Entries: []storage.SetArgs{
+			{Key: "test-batch-1", Value: []byte("one")},
+			{Key: "test-batch-2", Value: []byte("two"), TTL: &badTTL},
+			{Key: "test-batch-3", Value: []byte("three")},
+		},
+	}
+	msetReply := &storage.MSetReply{}
+	if err := client.Call("Store.MSet", msetArgs, msetReply); err != nil {
+		t.Fatalf("MSet RPC call failed: %v", err)
+	}
+	if msetReply.Error != "" {
+		t.Fatalf("MSet operation failed: %v", msetReply.Error)
+	}
+	if len(msetReply.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(msetReply.Results))
+	}
+	if msetReply.Results[0].Error != "" || msetReply.Results[2].Error != "" {
+		t.Errorf("Expected valid entries to succeed, got %+v", msetReply.Results)
+	}
+	if msetReply.Results[1].Error == "" {
+		t.Errorf("Expected entry with invalid TTL to fail")
+	}
+
+	mgetReply := &storage.MGetReply{}
+	mgetArgs := &storage.MGetArgs{Keys: []string{"test-batch-1", "test-batch-2", "test-batch-3"}}
+	if err := client.Call("Store.MGet", mgetArgs, mgetReply); err != nil {
+		t.Fatalf("MGet RPC call failed: %v", err)
+	}
+	if mgetReply.Error != "" {
+		t.Fatalf("MGet operation failed: %v", mgetReply.Error)
+	}
+	if len(mgetReply.Values) != 3 {
+		t.Fatalf("Expected 3 values, got %d", len(mgetReply.Values))
+	}
+	if string(mgetReply.Values[0].Value) != "one" || string(mgetReply.Values[2].Value) != "three" {
+		t.Errorf("Unexpected values %+v", mgetReply.Values)
+	}
+	if mgetReply.Values[1].Error != "key not found" {
+		t.Errorf("Expected 'key not found' error, got: %v", mgetReply.Values[1].Error)
+	}
+
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: mgetArgs.Keys}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerIncrBy(t *testing.T) {
+	forEachBackend(t, testConfig(), testServerIncrBy)
+}
+
+func testServerIncrBy(t *testing.T, client *rpc.Client) {
+
+	key := "test-counter"
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+
+	ttl := 60
+	incrReply := &storage.IncrByReply{}
+	if err := client.Call("Store.IncrBy", &storage.IncrByArgs{Key: key, Delta: 5, TTL: &ttl}, incrReply); err != nil {
+		t.Fatalf("IncrBy RPC call failed: %v", err)
+	}
+	if incrReply.Error != "" || incrReply.Value != 5 {
+		t.Fatalf("Expected counter 5, got %d (error %q)", incrReply.Value, incrReply.Error)
+	}
+
+	incrReply = &storage.IncrByReply{}
+	if err := client.Call("Store.IncrBy", &storage.IncrByArgs{Key: key, Delta: -2}, incrReply); err != nil {
+		t.Fatalf("IncrBy RPC call failed: %v", err)
+	}
+	if incrReply.Value != 3 {
+		t.Errorf("Expected counter 3, got %d", incrReply.Value)
+	}
+
+	// The TTL set on creation must survive later increments
+	ttlReply := &storage.TTLReply{}
+	if err := client.Call("Store.TTL", &storage.TTLArgs{Key: key}, ttlReply); err != nil {
+		t.Fatalf("TTL RPC call failed: %v", err)
+	}
+	if ttlReply.TTL <= 0 || ttlReply.TTL > ttl {
+		t.Errorf("Expected TTL in (0, %d], got %d", ttl, ttlReply.TTL)
+	}
+
+	// Increments bump the version, so a compare-and-swap on an older one fails
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: key}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if getReply.Error != "" || getReply.Version < 2 {
+		t.Fatalf("Expected a versioned counter, got %+v", getReply)
+	}
+	before := getReply.Version
+	if err := client.Call("Store.IncrBy", &storage.IncrByArgs{Key: key, Delta: 1}, incrReply); err != nil {
+		t.Fatalf("IncrBy RPC call failed: %v", err)
+	}
+	getReply = &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: key}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if getReply.Version <= before {
+		t.Errorf("Expected the increment to bump version %d, got %d", before, getReply.Version)
+	}
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: key, Value: []byte("0"), IfVersion: &before}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure for a version from before the increment, got %q", setReply.Error)
+	}
+
+	setReply = &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: key, Value: []byte("not a number")}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	incrReply = &storage.IncrByReply{}
+	if err := client.Call("Store.IncrBy", &storage.IncrByArgs{Key: key, Delta: 1}, incrReply); err != nil {
+		t.Fatalf("IncrBy RPC call failed: %v", err)
+	}
+	if incrReply.Error == "" {
+		t.Errorf("Expected an error incrementing a non-integer value")
+	}
+
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerConditionalSet(t *testing.T) {
+	forEachBackend(t, testConfig(), testServerConditionalSet)
+}
+
+func testServerConditionalSet(t *testing.T, client *rpc.Client) {
+
+	key := "test-cas"
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+
+	set := func(args *storage.SetArgs) *storage.SetReply {
+		t.Helper()
+		reply := &storage.SetReply{}
+		if err := client.Call("Store.Set", args, reply); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+		return reply
+	}
+
+	// Only-if-present must fail on a missing key
+	if reply := set(&storage.SetArgs{Key: key, Value: []byte("v0"), Condition: storage.SetIfPresent}); reply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure for SetIfPresent, got %q", reply.Error)
+	}
+
+	// Only-if-absent creates the key once. Versions continue from earlier
+	// runs that deleted the key.
+	first := set(&storage.SetArgs{Key: key, Value: []byte("v1"), Condition: storage.SetIfAbsent})
+	if first.Error != "" || first.Version < 1 {
+		t.Fatalf("Expected a version, got %d (error %q)", first.Version, first.Error)
+	}
+	if reply := set(&storage.SetArgs{Key: key, Value: []byte("v1"), Condition: storage.SetIfAbsent}); reply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure for second SetIfAbsent, got %q", reply.Error)
+	}
+
+	// Compare-and-swap by value
+	if reply := set(&storage.SetArgs{Key: key, Value: []byte("v2"), IfValue: []byte("wrong")}); reply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure for stale value, got %q", reply.Error)
+	}
+	second := set(&storage.SetArgs{Key: key, Value: []byte("v2"), IfValue: []byte("v1")})
+	if second.Error != "" || second.Version != first.Version+1 {
+		t.Fatalf("Expected version %d, got %d (error %q)", first.Version+1, second.Version, second.Error)
+	}
+
+	// Compare-and-swap by version
+	stale := first.Version
+	if reply := set(&storage.SetArgs{Key: key, Value: []byte("v3"), IfVersion: &stale}); reply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure for stale version, got %q", reply.Error)
+	}
+	current := second.Version
+	if reply := set(&storage.SetArgs{Key: key, Value: []byte("v3"), IfVersion: &current}); reply.Error != "" {
+		t.Errorf("Expected CAS on current version to succeed, got %q", reply.Error)
+	}
+
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: key}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if string(getReply.Value) != "v3" || getReply.Version != first.Version+2 {
+		t.Errorf("Expected v3 at version %d, got %q at version %d", first.Version+2, getReply.Value, getReply.Version)
+	}
+
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+	if delReply.Deleted != 1 {
+		t.Errorf("Expected 1 key deleted, got %d", delReply.Deleted)
+	}
+
+	// A re-created key does not reissue versions held from before the delete
+	if reply := set(&storage.SetArgs{Key: key, Value: []byte("v4"), IfVersion: &stale}); reply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure for a version from before the delete, got %q", reply.Error)
+	}
+	never := int64(0)
+	recreated := set(&storage.SetArgs{Key: key, Value: []byte("v4"), IfVersion: &never})
+	if recreated.Error != "" || recreated.Version <= getReply.Version {
+		t.Errorf("Expected a version above %d, got %d (error %q)", getReply.Version, recreated.Version, recreated.Error)
+	}
+	client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply)
+}
+
+func TestServerMetaKeys(t *testing.T) {
+	_, client := startTestServer(t)
+
+	key := "test-meta"
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: key, Value: []byte("v1")}, setReply); err != nil || setReply.Error != "" {
+		t.Fatalf("Set failed: %v %s", err, setReply.Error)
+	}
+	version := setReply.Version
+
+	// Versions, history, queue leases and the other bookkeeping keys are out of reach
+	for _, meta := range []string{"ver:", "hist:", "leases:", "inflight:", "deadlines:", "reads:", "fence:", "lock:"} {
+		metaKey := "__tritium:" + meta + key
+		forged := &storage.SetReply{}
+		if err := client.Call("Store.Set", &storage.SetArgs{Key: metaKey, Value: []byte("1000")}, forged); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+		incrReply := &storage.IncrByReply{}
+		if err := client.Call("Store.IncrBy", &storage.IncrByArgs{Key: metaKey, Delta: 1000}, incrReply); err != nil {
+			t.Fatalf("IncrBy RPC call failed: %v", err)
+		}
+		getReply := &storage.GetReply{}
+		if err := client.Call("Store.Get", &storage.GetArgs{Key: metaKey}, getReply); err != nil {
+			t.Fatalf("Get RPC call failed: %v", err)
+		}
+		delReply := &storage.DeleteReply{}
+		if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{metaKey}}, delReply); err != nil {
+			t.Fatalf("Delete RPC call failed: %v", err)
+		}
+		expireReply := &storage.ExpireReply{}
+		if err := client.Call("Store.Expire", &storage.ExpireArgs{Key: metaKey, TTL: 1}, expireReply); err != nil {
+			t.Fatalf("Expire RPC call failed: %v", err)
+		}
+		txnReply := &storage.TxnReply{}
+		txnArgs := &storage.TxnArgs{
+			Watch: []storage.TxnWatchArgs{{Key: metaKey}},
+			Ops:   []storage.TxnOpArgs{{Type: storage.TxnSet, Key: key, Value: []byte("v")}},
+		}
+		if err := client.Call("Store.Txn", txnArgs, txnReply); err != nil {
+			t.Fatalf("Txn RPC call failed: %v", err)
+		}
+		txnOpReply := &storage.TxnReply{}
+		txnArgs = &storage.TxnArgs{Ops: []storage.TxnOpArgs{{Type: storage.TxnIncrBy, Key: metaKey, Delta: 1000}}}
+		if err := client.Call("Store.Txn", txnArgs, txnOpReply); err != nil {
+			t.Fatalf("Txn RPC call failed: %v", err)
+		}
+		for method, msg := range map[string]string{
+			"Set": forged.Error, "IncrBy": incrReply.Error, "Get": getReply.Error,
+			"Delete": delReply.Error, "Expire": expireReply.Error, "Txn": txnReply.Error,
+			"Txn op": txnOpReply.Error,
+		} {
+			if !strings.Contains(msg, "reserved") {
+				t.Errorf("Expected %s on %s to be rejected, got %q", method, metaKey, msg)
+			}
+		}
+	}
+
+	// The version compare-and-swap checks against is the real one, not the forged one
+	forgedVersion := int64(1000)
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: key, Value: []byte("v2"), IfVersion: &forgedVersion}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure for the forged version, got %q", setReply.Error)
+	}
+	setReply = &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: key, Value: []byte("v2"), IfVersion: &version}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != "" || setReply.Version != version+1 {
+		t.Errorf("Expected version %d, got %+v", version+1, setReply)
+	}
+	client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, &storage.DeleteReply{})
+}
+
+func TestServerScan(t *testing.T) {
+	forEachBackend(t, testConfig(), testServerScan)
+}
+
+func testServerScan(t *testing.T, client *rpc.Client) {
+
+	keys := []string{"test-scan:a", "test-scan:b", "test-scan:c"}
+	for _, key := range keys {
+		setReply := &storage.SetReply{}
+		if err := client.Call("Store.Set", &storage.SetArgs{Key: key, Value: []byte("x")}, setReply); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+	}
+
+	found := make(map[string]bool)
+	cursor := uint64(0)
+	for {
+		scanReply := &storage.ScanReply{}
+		if err := client.Call("Store.Scan", &storage.ScanArgs{Pattern: "test-scan:*", Cursor: cursor, Count: 1}, scanReply); err != nil {
+			t.Fatalf("Scan RPC call failed: %v", err)
+		}
+		if scanReply.Error != "" {
+			t.Fatalf("Scan operation failed: %v", scanReply.Error)
+		}
+		for _, key := range scanReply.Keys {
+			found[key] = true
+		}
+		cursor = scanReply.Cursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(found) != len(keys) {
+		t.Errorf("Expected %d keys, got %v", len(keys), found)
+	}
+	for _, key := range keys {
+		if !found[key] {
+			t.Errorf("Expected %s to be scanned", key)
+		}
+	}
+
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: keys}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerNamespaces(t *testing.T) {
+	cfg := testConfig()
+	cfg.Namespaces = []config.NamespaceConfig{
+		{Name: "test-tenant", DefaultTTL: 30, MaxTTL: 60, MaxKeys: 2, MaxBytes: 64},
+	}
+	forEachBackend(t, cfg, testServerNamespaces)
+}
+
+func testServerNamespaces(t *testing.T, client *rpc.Client) {
+
+	set := func(args *storage.SetArgs) *storage.SetReply {
+		t.Helper()
+		reply := &storage.SetReply{}
+		if err := client.Call("Store.Set", args, reply); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+		return reply
+	}
+
+	if reply := set(&storage.SetArgs{Namespace: "test-tenant", Key: "a", Value: []byte("tenant value")}); reply.Error != "" {
+		t.Fatalf("Set operation failed: %v", reply.Error)
+	}
+
+	// The namespaced key is stored under a prefix and invisible to the default namespace
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "a"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if getReply.Error != "key not found" {
+		t.Errorf("Expected 'key not found' outside the namespace, got: %v", getReply.Error)
+	}
+	getReply = &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Namespace: "test-tenant", Key: "a"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if string(getReply.Value) != "tenant value" {
+		t.Errorf("Expected 'tenant value', got %q (error %q)", getReply.Value, getReply.Error)
+	}
+
+	// The default namespace cannot reach namespaced keys through their prefix
+	getReply = &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-tenant:a"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if getReply.Error == "" || getReply.Value != nil {
+		t.Errorf("Expected prefixed key to be rejected in the default namespace, got %q", getReply.Value)
+	}
+	if reply := set(&storage.SetArgs{Key: "test-tenant:a", Value: []byte("spoofed")}); reply.Error == "" {
+		t.Errorf("Expected write to a prefixed key in the default namespace to be rejected")
+	}
+	scanReply := &storage.ScanReply{}
+	if err := client.Call("Store.Scan", &storage.ScanArgs{Pattern: "test-tenant*", Count: 1000}, scanReply); err != nil {
+		t.Fatalf("Scan RPC call failed: %v", err)
+	}
+	if len(scanReply.Keys) != 0 {
+		t.Errorf("Expected default namespace scan to hide namespaced keys, got %v", scanReply.Keys)
+	}
+
+	// The namespace default TTL applies when none is given
+	ttlReply := &storage.TTLReply{}
+	if err := client.Call("Store.TTL", &storage.TTLArgs{Namespace: "test-tenant", Key: "a"}, ttlReply); err != nil {
+		t.Fatalf("TTL RPC call failed: %v", err)
+	}
+	if ttlReply.TTL <= 0 || ttlReply.TTL > 30 {
+		t.Errorf("Expected namespace default TTL, got %d", ttlReply.TTL)
+	}
+
+	tooLong := 120
+	if reply := set(&storage.SetArgs{Namespace: "test-tenant", Key: "b", Value: []byte("x"), TTL: &tooLong}); reply.Error == "" {
+		t.Errorf("Expected TTL above the namespace maximum to be rejected")
+	}
+	if reply := set(&storage.SetArgs{Namespace: "test-tenant", Key: "b", Value: make([]byte, 100)}); reply.Error == "" {
+		t.Errorf("Expected write above the byte quota to be rejected")
+	}
+	if reply := set(&storage.SetArgs{Namespace: "test-tenant", Key: "b", Value: []byte("x")}); reply.Error != "" {
+		t.Fatalf("Set operation failed: %v", reply.Error)
+	}
+	if reply := set(&storage.SetArgs{Namespace: "test-tenant", Key: "c", Value: []byte("x")}); reply.Error == "" {
+		t.Errorf("Expected write above the key quota to be rejected")
+	}
+	if reply := set(&storage.SetArgs{Namespace: "missing", Key: "c", Value: []byte("x")}); reply.Error == "" {
+		t.Errorf("Expected write to an undeclared namespace to be rejected")
+	}
+
+	nsReply := &storage.NamespacesReply{}
+	if err := client.Call("Store.Namespaces", struct{}{}, nsReply); err != nil {
+		t.Fatalf("Namespaces RPC call failed: %v", err)
+	}
+	if len(nsReply.Namespaces) != 1 {
+		t.Fatalf("Expected 1 namespace, got %d", len(nsReply.Namespaces))
+	}
+	if info := nsReply.Namespaces[0]; info.Keys != 2 || info.Bytes != int64(len("tenant value")+1) {
+		t.Errorf("Unexpected namespace usage %+v", info)
+	}
+
+	// Deleting frees quota
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-tenant", Keys: []string{"a", "b"}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+	if delReply.Deleted != 2 {
+		t.Errorf("Expected 2 keys deleted, got %d", delReply.Deleted)
+	}
+	if reply := set(&storage.SetArgs{Namespace: "test-tenant", Key: "c", Value: []byte("x")}); reply.Error != "" {
+		t.Errorf("Expected write after delete to succeed, got %v", reply.Error)
+	}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-tenant", Keys: []string{"c"}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerNamespaceNames(t *testing.T) {
+	for _, name := range []string{"tenant*", "a?b", "[ab]", `a\b`, "a:b", "a b"} {
+		if _, err := newNamespaces([]config.NamespaceConfig{{Name: name}}); err == nil {
+			t.Errorf("Expected namespace name %q to be rejected", name)
+		}
+	}
+	if _, err := newNamespaces([]config.NamespaceConfig{{Name: "__tritium"}}); err == nil {
+		t.Errorf("Expected a namespace among the bookkeeping keys to be rejected")
+	}
+	if _, err := newNamespaces([]config.NamespaceConfig{{Name: "tenant_1-a"}}); err != nil {
+		t.Errorf("Expected valid namespace name to be accepted: %v", err)
+	}
+}
+
+func TestServerHash(t *testing.T) {
+	_, client := startTestServer(t)
+
+	key := "test-hash"
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+
+	hsetArgs := &storage.HSetArgs{
+		Key:    key,
+		Fields: map[string][]byte{"name": []byte("ada"), "role": []byte("admin")},
+	}
+	hsetReply := &storage.HSetReply{}
+	if err := client.Call("Store.HSet", hsetArgs, hsetReply); err != nil {
+		t.Fatalf("HSet RPC call failed: %v", err)
+	}
+	if hsetReply.Error != "" || hsetReply.Added != 2 {
+		t.Fatalf("Expected 2 fields added, got %d (error %q)", hsetReply.Added, hsetReply.Error)
+	}
+
+	hgetReply := &storage.HGetReply{}
+	if err := client.Call("Store.HGet", &storage.HGetArgs{Key: key, Field: "role"}, hgetReply); err != nil {
+		t.Fatalf("HGet RPC call failed: %v", err)
+	}
+	if string(hgetReply.Value) != "admin" {
+		t.Errorf("Expected 'admin', got %q (error %q)", hgetReply.Value, hgetReply.Error)
+	}
+
+	incrReply := &storage.IncrByReply{}
+	if err := client.Call("Store.HIncrBy", &storage.HIncrByArgs{Key: key, Field: "logins", Delta: 3}, incrReply); err != nil {
+		t.Fatalf("HIncrBy RPC call failed: %v", err)
+	}
+	if incrReply.Value != 3 {
+		t.Errorf("Expected 3, got %d (error %q)", incrReply.Value, incrReply.Error)
+	}
+
+	hdelReply := &storage.HDelReply{}
+	if err := client.Call("Store.HDel", &storage.HDelArgs{Key: key, Fields: []string{"role", "missing"}}, hdelReply); err != nil {
+		t.Fatalf("HDel RPC call failed: %v", err)
+	}
+	if hdelReply.Deleted != 1 {
+		t.Errorf("Expected 1 field deleted, got %d", hdelReply.Deleted)
+	}
+
+	allReply := &storage.HGetAllReply{}
+	if err := client.Call("Store.HGetAll", &storage.HGetAllArgs{Key: key}, allReply); err != nil {
+		t.Fatalf("HGetAll RPC call failed: %v", err)
+	}
+	if len(allReply.Fields) != 2 || string(allReply.Fields["name"]) != "ada" || string(allReply.Fields["logins"]) != "3" {
+		t.Errorf("Unexpected hash contents %q", allReply.Fields)
+	}
+
+	ttlReply := &storage.TTLReply{}
+	if err := client.Call("Store.TTL", &storage.TTLArgs{Key: key}, ttlReply); err != nil {
+		t.Fatalf("TTL RPC call failed: %v", err)
+	}
+	if ttlReply.TTL <= 0 {
+		t.Errorf("Expected the hash to carry the default TTL, got %d", ttlReply.TTL)
+	}
+
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerHashQuota(t *testing.T) {
+	_, client := startTestServerWithConfig(t, config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 10,
+		Namespaces: []config.NamespaceConfig{
+			{Name: "test-hq", MaxKeys: 1, MaxBytes: 20},
+		},
+	})
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-hq", Keys: []string{"h", "other"}}, &storage.DeleteReply{})
+
+	hset := func(key, field, value string) string {
+		t.Helper()
+		reply := &storage.HSetReply{}
+		args := &storage.HSetArgs{Namespace: "test-hq", Key: key, Fields: map[string][]byte{field: []byte(value)}}
+		if err := client.Call("Store.HSet", args, reply); err != nil {
+			t.Fatalf("HSet RPC call failed: %v", err)
+		}
+		return reply.Error
+	}
+	hincr := func(field string) string {
+		t.Helper()
+		reply := &storage.IncrByReply{}
+		args := &storage.HIncrByArgs{Namespace: "test-hq", Key: "h", Field: field, Delta: 1}
+		if err := client.Call("Store.HIncrBy", args, reply); err != nil {
+			t.Fatalf("HIncrBy RPC call failed: %v", err)
+		}
+		return reply.Error
+	}
+	hdel := func(fields ...string) {
+		t.Helper()
+		args := &storage.HDelArgs{Namespace: "test-hq", Key: "h", Fields: fields}
+		if err := client.Call("Store.HDel", args, &storage.HDelReply{}); err != nil {
+			t.Fatalf("HDel RPC call failed: %v", err)
+		}
+	}
+
+	// Overwriting a field and incrementing a counter only charge them once:
+	// 10 bytes for f and 9 for n
+	for i := 0; i < 5; i++ {
+		if err := hset("h", "f", "123456789"); err != "" {
+			t.Fatalf("Expected rewriting a field to fit, got %q", err)
+		}
+		if err := hincr("n"); err != "" {
+			t.Fatalf("Expected incrementing a counter to fit, got %q", err)
+		}
+	}
+	if err := hset("h", "g", "x"); !strings.Contains(err, "byte quota") {
+		t.Errorf("Expected a new field to exceed the byte quota, got %q", err)
+	}
+
+	// Deleted fields are released
+	hdel("f")
+	if err := hset("h", "g", "x"); err != "" {
+		t.Errorf("Expected a field to fit after HDel, got %q", err)
+	}
+
+	// and so is the key once the hash is empty
+	hdel("g", "n")
+	if err := hset("other", "f", "x"); err != "" {
+		t.Errorf("Expected another key to fit once the hash is empty, got %q", err)
+	}
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-hq", Keys: []string{"h", "other"}}, &storage.DeleteReply{})
+}
+
+func TestServerQueue(t *testing.T) {
+	_, client := startTestServer(t)
+
+	key := "test-queue"
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+
+	pushReply := &storage.PushReply{}
+	pushArgs := &storage.PushArgs{Key: key, Values: [][]byte{[]byte("job-1"), []byte("job-2")}}
+	if err := client.Call("Store.Push", pushArgs, pushReply); err != nil {
+		t.Fatalf("Push RPC call failed: %v", err)
+	}
+	if pushReply.Error != "" || pushReply.Length != 2 {
+		t.Fatalf("Expected length 2, got %d (error %q)", pushReply.Length, pushReply.Error)
+	}
+
+	pop := func(method string, args *storage.PopArgs) *storage.PopReply {
+		t.Helper()
+		reply := &storage.PopReply{}
+		if err := client.Call(method, args, reply); err != nil {
+			t.Fatalf("%s RPC call failed: %v", method, err)
+		}
+		return reply
+	}
+
+	// Reliable pop hides the item until its lease expires
+	leased := pop("Store.Pop", &storage.PopArgs{Key: key, VisibilityTimeout: 1})
+	if string(leased.Value) != "job-1" || leased.Receipt == "" {
+		t.Fatalf("Expected job-1 with a receipt, got %q (error %q)", leased.Value, leased.Error)
+	}
+	if reply := pop("Store.Pop", &storage.PopArgs{Key: key}); string(reply.Value) != "job-2" {
+		t.Fatalf("Expected job-2, got %q (error %q)", reply.Value, reply.Error)
+	}
+	if reply := pop("Store.Pop", &storage.PopArgs{Key: key}); reply.Error != storage.ErrQueueEmpty.Error() {
+		t.Fatalf("Expected empty queue, got %q (error %q)", reply.Value, reply.Error)
+	}
+
+	// Unacked items reappear once the visibility timeout passes
+	redelivered := pop("Store.BPop", &storage.PopArgs{Key: key, Timeout: 3, VisibilityTimeout: 5})
+	if string(redelivered.Value) != "job-1" {
+		t.Fatalf("Expected job-1 to be redelivered, got %q (error %q)", redelivered.Value, redelivered.Error)
+	}
+
+	ackReply := &storage.AckReply{}
+	if err := client.Call("Store.Ack", &storage.AckArgs{Key: key, Receipt: leased.Receipt}, ackReply); err != nil {
+		t.Fatalf("Ack RPC call failed: %v", err)
+	}
+	if ackReply.Error == "" {
+		t.Errorf("Expected ack with an expired receipt to fail")
+	}
+	ackReply = &storage.AckReply{}
+	if err := client.Call("Store.Ack", &storage.AckArgs{Key: key, Receipt: redelivered.Receipt}, ackReply); err != nil {
+		t.Fatalf("Ack RPC call failed: %v", err)
+	}
+	if ackReply.Error != "" {
+		t.Errorf("Ack operation failed: %v", ackReply.Error)
+	}
+
+	lenReply := &storage.LLenReply{}
+	if err := client.Call("Store.LLen", &storage.LLenArgs{Key: key}, lenReply); err != nil {
+		t.Fatalf("LLen RPC call failed: %v", err)
+	}
+	if lenReply.Length != 0 {
+		t.Errorf("Expected empty queue after ack, got length %d", lenReply.Length)
+	}
+
+	if reply := pop("Store.BPop", &storage.PopArgs{Key: key, Timeout: 1}); reply.Error != storage.ErrQueueEmpty.Error() {
+		t.Errorf("Expected BPop to time out on an empty queue, got %q (error %q)", reply.Value, reply.Error)
+	}
+
+	// Concurrent consumers each lease a different item, and every lease can be acked
+	jobs := make([][]byte, 20)
+	for i := range jobs {
+		jobs[i] = []byte(fmt.Sprintf("job-%d", i))
+	}
+	if err := client.Call("Store.Push", &storage.PushArgs{Key: key, Values: jobs}, pushReply); err != nil || pushReply.Error != "" {
+		t.Fatalf("Push failed: %v %s", err, pushReply.Error)
+	}
+	var wg sync.WaitGroup
+	replies := make([]storage.PopReply, len(jobs))
+	for i := range replies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client.Call("Store.Pop", &storage.PopArgs{Key: key, VisibilityTimeout: 30}, &replies[i])
+		}(i)
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	for _, reply := range replies {
+		if reply.Error != "" || seen[string(reply.Value)] {
+			t.Fatalf("Expected a distinct leased item, got %q (error %q)", reply.Value, reply.Error)
+		}
+		seen[string(reply.Value)] = true
+		ackReply := &storage.AckReply{}
+		if err := client.Call("Store.Ack", &storage.AckArgs{Key: key, Receipt: reply.Receipt}, ackReply); err != nil || ackReply.Error != "" {
+			t.Errorf("Ack of %q failed: %v %s", reply.Value, err, ackReply.Error)
+		}
+	}
+	client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, delReply)
+}
+
+func TestServerQueueQuota(t *testing.T) {
+	_, client := startTestServerWithConfig(t, config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 10,
+		Namespaces: []config.NamespaceConfig{
+			{Name: "test-qq", MaxKeys: 1, MaxBytes: 10},
+		},
+	})
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-qq", Keys: []string{"q", "other"}}, &storage.DeleteReply{})
+
+	push := func(key string, values ...string) string {
+		t.Helper()
+		args := &storage.PushArgs{Namespace: "test-qq", Key: key}
+		for _, v := range values {
+			args.Values = append(args.Values, []byte(v))
+		}
+		reply := &storage.PushReply{}
+		if err := client.Call("Store.Push", args, reply); err != nil {
+			t.Fatalf("Push RPC call failed: %v", err)
+		}
+		return reply.Error
+	}
+	pop := func(visibility int) *storage.PopReply {
+		t.Helper()
+		reply := &storage.PopReply{}
+		args := &storage.PopArgs{Namespace: "test-qq", Key: "q", VisibilityTimeout: visibility}
+		if err := client.Call("Store.Pop", args, reply); err != nil {
+			t.Fatalf("Pop RPC call failed: %v", err)
+		}
+		return reply
+	}
+
+	if err := push("q", "12345", "12345"); err != "" {
+		t.Fatalf("Push failed: %s", err)
+	}
+	if err := push("q", "x"); !strings.Contains(err, "byte quota") {
+		t.Errorf("Expected a full queue to exceed the byte quota, got %q", err)
+	}
+
+	// Popped items are released; leased items only once they are acked
+	if reply := pop(0); reply.Error != "" {
+		t.Fatalf("Pop failed: %s", reply.Error)
+	}
+	leased := pop(30)
+	if leased.Error != "" {
+		t.Fatalf("Pop failed: %s", leased.Error)
+	}
+	if err := push("q", "123456"); !strings.Contains(err, "byte quota") {
+		t.Errorf("Expected a leased item to stay charged, got %q", err)
+	}
+	ackReply := &storage.AckReply{}
+	if err := client.Call("Store.Ack", &storage.AckArgs{Namespace: "test-qq", Key: "q", Receipt: leased.Receipt}, ackReply); err != nil || ackReply.Error != "" {
+		t.Fatalf("Ack failed: %v %s", err, ackReply.Error)
+	}
+
+	// With the queue drained its key no longer counts either
+	if err := push("other", "1234567890"); err != "" {
+		t.Errorf("Expected another queue to fit once the first is drained, got %q", err)
+	}
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-qq", Keys: []string{"q", "other"}}, &storage.DeleteReply{})
+}
+
+func TestServerSets(t *testing.T) {
+	_, client := startTestServer(t)
+
+	setKey, zsetKey := "test-set", "test-zset"
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{setKey, zsetKey}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+
+	saddReply := &storage.SAddReply{}
+	saddArgs := &storage.SAddArgs{Key: setKey, Members: [][]byte{[]byte("token-a"), []byte("token-b"), []byte("token-a")}}
+	if err := client.Call("Store.SAdd", saddArgs, saddReply); err != nil {
+		t.Fatalf("SAdd RPC call failed: %v", err)
+	}
+	if saddReply.Added != 2 {
+		t.Errorf("Expected 2 members added, got %d (error %q)", saddReply.Added, saddReply.Error)
+	}
+
+	isMember := func(member string) bool {
+		t.Helper()
+		reply := &storage.SIsMemberReply{}
+		if err := client.Call("Store.SIsMember", &storage.SIsMemberArgs{Key: setKey, Member: []byte(member)}, reply); err != nil {
+			t.Fatalf("SIsMember RPC call failed: %v", err)
+		}
+		return reply.IsMember
+	}
+	if !isMember("token-a") || isMember("token-c") {
+		t.Errorf("Unexpected membership results")
+	}
+
+	sremReply := &storage.SRemReply{}
+	if err := client.Call("Store.SRem", &storage.SRemArgs{Key: setKey, Members: [][]byte{[]byte("token-a")}}, sremReply); err != nil {
+		t.Fatalf("SRem RPC call failed: %v", err)
+	}
+	membersReply := &storage.SMembersReply{}
+	if err := client.Call("Store.SMembers", &storage.SMembersArgs{Key: setKey}, membersReply); err != nil {
+		t.Fatalf("SMembers RPC call failed: %v", err)
+	}
+	if len(membersReply.Members) != 1 || string(membersReply.Members[0]) != "token-b" {
+		t.Errorf("Expected only token-b to remain, got %q", membersReply.Members)
+	}
+
+	zaddArgs := &storage.ZAddArgs{
+		Key: zsetKey,
+		Members: []storage.ScoredMember{
+			{Member: []byte("alice"), Score: 10},
+			{Member: []byte("bob"), Score: 20},
+			{Member: []byte("carol"), Score: 15},
+		},
+	}
+	zaddReply := &storage.ZAddReply{}
+	if err := client.Call("Store.ZAdd", zaddArgs, zaddReply); err != nil {
+		t.Fatalf("ZAdd RPC call failed: %v", err)
+	}
+	if zaddReply.Added != 3 {
+		t.Errorf("Expected 3 members added, got %d (error %q)", zaddReply.Added, zaddReply.Error)
+	}
+
+	zincrReply := &storage.ZIncrByReply{}
+	if err := client.Call("Store.ZIncrBy", &storage.ZIncrByArgs{Key: zsetKey, Member: []byte("alice"), Delta: 12.5}, zincrReply); err != nil {
+		t.Fatalf("ZIncrBy RPC call failed: %v", err)
+	}
+	if zincrReply.Score != 22.5 {
+		t.Errorf("Expected score 22.5, got %v (error %q)", zincrReply.Score, zincrReply.Error)
+	}
+
+	rangeReply := &storage.ZRangeReply{}
+	if err := client.Call("Store.ZRange", &storage.ZRangeArgs{Key: zsetKey, Start: 0, Stop: 1, Reverse: true}, rangeReply); err != nil {
+		t.Fatalf("ZRange RPC call failed: %v", err)
+	}
+	if len(rangeReply.Members) != 2 || string(rangeReply.Members[0].Member) != "alice" || string(rangeReply.Members[1].Member) != "bob" {
+		t.Errorf("Unexpected leaderboard %+v", rangeReply.Members)
+	}
+
+	rangeReply = &storage.ZRangeReply{}
+	byScoreArgs := &storage.ZRangeByScoreArgs{Key: zsetKey, Min: 15, Max: math.Inf(1)}
+	if err := client.Call("Store.ZRangeByScore", byScoreArgs, rangeReply); err != nil {
+		t.Fatalf("ZRangeByScore RPC call failed: %v", err)
+	}
+	if len(rangeReply.Members) != 3 || string(rangeReply.Members[0].Member) != "carol" || rangeReply.Members[0].Score != 15 {
+		t.Errorf("Unexpected score range %+v (error %q)", rangeReply.Members, rangeReply.Error)
+	}
+
+	zremReply := &storage.ZRemReply{}
+	if err := client.Call("Store.ZRem", &storage.ZRemArgs{Key: zsetKey, Members: [][]byte{[]byte("bob"), []byte("dave")}}, zremReply); err != nil {
+		t.Fatalf("ZRem RPC call failed: %v", err)
+	}
+	if zremReply.Removed != 1 {
+		t.Errorf("Expected 1 member removed, got %d", zremReply.Removed)
+	}
+
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{setKey, zsetKey}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerSetQuota(t *testing.T) {
+	_, client := startTestServerWithConfig(t, config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 10,
+		Namespaces: []config.NamespaceConfig{
+			{Name: "test-sq", MaxKeys: 2, MaxBytes: 20},
+		},
+	})
+	keys := []string{"s", "z", "other"}
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-sq", Keys: keys}, &storage.DeleteReply{})
+
+	sadd := func(key, member string) string {
+		t.Helper()
+		reply := &storage.SAddReply{}
+		args := &storage.SAddArgs{Namespace: "test-sq", Key: key, Members: [][]byte{[]byte(member)}}
+		if err := client.Call("Store.SAdd", args, reply); err != nil {
+			t.Fatalf("SAdd RPC call failed: %v", err)
+		}
+		return reply.Error
+	}
+
+	// Re-adding a member and incrementing a score only charge them once:
+	// 10 bytes for the set member and 9 for the scored one
+	for i := 0; i < 5; i++ {
+		if err := sadd("s", "0123456789"); err != "" {
+			t.Fatalf("Expected re-adding a member to fit, got %q", err)
+		}
+		reply := &storage.ZIncrByReply{}
+		args := &storage.ZIncrByArgs{Namespace: "test-sq", Key: "z", Member: []byte("m"), Delta: 1}
+		if err := client.Call("Store.ZIncrBy", args, reply); err != nil || reply.Error != "" {
+			t.Fatalf("Expected incrementing a score to fit, got %v %q", err, reply.Error)
+		}
+	}
+	if err := sadd("s", "ab"); !strings.Contains(err, "byte quota") {
+		t.Errorf("Expected a new member to exceed the byte quota, got %q", err)
+	}
+
+	// Removed members are released, and so is a set left empty
+	sremArgs := &storage.SRemArgs{Namespace: "test-sq", Key: "s", Members: [][]byte{[]byte("0123456789")}}
+	if err := client.Call("Store.SRem", sremArgs, &storage.SRemReply{}); err != nil {
+		t.Fatalf("SRem RPC call failed: %v", err)
+	}
+	if err := sadd("s", "ab"); err != "" {
+		t.Errorf("Expected a member to fit after SRem, got %q", err)
+	}
+	zremArgs := &storage.ZRemArgs{Namespace: "test-sq", Key: "z", Members: [][]byte{[]byte("m")}}
+	if err := client.Call("Store.ZRem", zremArgs, &storage.ZRemReply{}); err != nil {
+		t.Fatalf("ZRem RPC call failed: %v", err)
+	}
+	if err := sadd("other", "0123456789"); err != "" {
+		t.Errorf("Expected another key to fit once the sorted set is empty, got %q", err)
+	}
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-sq", Keys: keys}, &storage.DeleteReply{})
+}
+
+func TestServerPubSub(t *testing.T) {
+	_, client := startTestServer(t)
+
+	subReply := &storage.SubscribeReply{}
+	if err := client.Call("Store.Subscribe", &storage.SubscribeArgs{Patterns: []string{"test-events.*"}}, subReply); err != nil {
+		t.Fatalf("Subscribe RPC call failed: %v", err)
+	}
+	if subReply.Error != "" {
+		t.Fatalf("Subscribe failed: %s", subReply.Error)
+	}
+
+	publish := func(channel, message string) {
+		t.Helper()
+		reply := &storage.PublishReply{}
+		if err := client.Call("Store.Publish", &storage.PublishArgs{Channel: channel, Message: []byte(message)}, reply); err != nil {
+			t.Fatalf("Publish RPC call failed: %v", err)
+		}
+		if reply.Error != "" {
+			t.Fatalf("Publish failed: %s", reply.Error)
+		}
+	}
+	publish("test-events.created", "one")
+	publish("other-events.created", "ignored")
+	publish("test-events.deleted", "two")
+
+	var received []storage.Message
+	for len(received) < 2 {
+		recvReply := &storage.ReceiveReply{}
+		args := &storage.ReceiveArgs{SubscriptionID: subReply.SubscriptionID, Timeout: 2}
+		if err := client.Call("Store.Receive", args, recvReply); err != nil {
+			t.Fatalf("Receive RPC call failed: %v", err)
+		}
+		if recvReply.Error != "" || len(recvReply.Messages) == 0 {
+			t.Fatalf("Expected messages, got none (error %q)", recvReply.Error)
+		}
+		received = append(received, recvReply.Messages...)
+	}
+
+	if len(received) != 2 || string(received[0].Payload) != "one" || received[1].Channel != "test-events.deleted" {
+		t.Errorf("Unexpected messages %+v", received)
+	}
+	if received[0].Pattern != "test-events.*" {
+		t.Errorf("Expected pattern test-events.*, got %q", received[0].Pattern)
+	}
+
+	unsubReply := &storage.UnsubscribeReply{}
+	if err := client.Call("Store.Unsubscribe", &storage.UnsubscribeArgs{SubscriptionID: subReply.SubscriptionID}, unsubReply); err != nil {
+		t.Fatalf("Unsubscribe RPC call failed: %v", err)
+	}
+	recvReply := &storage.ReceiveReply{}
+	if err := client.Call("Store.Receive", &storage.ReceiveArgs{SubscriptionID: subReply.SubscriptionID}, recvReply); err != nil {
+		t.Fatalf("Receive RPC call failed: %v", err)
+	}
+	if recvReply.Error != "subscription not found" {
+		t.Errorf("Expected subscription not found after unsubscribe, got %q", recvReply.Error)
+	}
+}
+
+func TestServerWatch(t *testing.T) {
+	_, client := startTestServer(t)
+
+	watchReply := &storage.SubscribeReply{}
+	if err := client.Call("Store.Watch", &storage.WatchArgs{Key: "test-watch:", Prefix: true}, watchReply); err != nil {
+		t.Fatalf("Watch RPC call failed: %v", err)
+	}
+	if watchReply.Error != "" {
+		t.Fatalf("Watch failed: %s", watchReply.Error)
+	}
+
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-watch:secret", Value: []byte("v1")}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-unwatched", Value: []byte("v1")}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	ttlArgs := &storage.ExpireArgs{Key: "test-watch:secret", TTL: 60}
+	if err := client.Call("Store.Expire", ttlArgs, &storage.ExpireReply{}); err != nil {
+		t.Fatalf("Expire RPC call failed: %v", err)
+	}
+	delReply := &storage.DeleteReply{}
+	keys := []string{"test-watch:secret", "test-watch:missing", "test-unwatched"}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: keys}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+	if delReply.Deleted != 2 {
+		t.Errorf("Expected 2 keys deleted, got %d", delReply.Deleted)
+	}
+	pushArgs := &storage.PushArgs{Key: "test-watch:queue", Values: [][]byte{[]byte("job")}}
+	if err := client.Call("Store.Push", pushArgs, &storage.PushReply{}); err != nil {
+		t.Fatalf("Push RPC call failed: %v", err)
+	}
+	popReply := &storage.PopReply{}
+	if err := client.Call("Store.Pop", &storage.PopArgs{Key: "test-watch:queue"}, popReply); err != nil {
+		t.Fatalf("Pop RPC call failed: %v", err)
+	}
+	// An empty queue publishes nothing
+	if err := client.Call("Store.Pop", &storage.PopArgs{Key: "test-watch:queue"}, popReply); err != nil {
+		t.Fatalf("Pop RPC call failed: %v", err)
+	}
+
+	var events []storage.Message
+	for len(events) < 5 {
+		recvReply := &storage.ReceiveReply{}
+		args := &storage.ReceiveArgs{SubscriptionID: watchReply.SubscriptionID, Timeout: 2}
+		if err := client.Call("Store.Receive", args, recvReply); err != nil {
+			t.Fatalf("Receive RPC call failed: %v", err)
+		}
+		if recvReply.Error != "" || len(recvReply.Messages) == 0 {
+			t.Fatalf("Expected events, got none (error %q)", recvReply.Error)
+		}
+		events = append(events, recvReply.Messages...)
+	}
+
+	if len(events) != 5 {
+		t.Fatalf("Expected 5 events, got %+v", events)
+	}
+	expected := []struct{ key, event string }{
+		{"test-watch:secret", storage.EventSet},
+		{"test-watch:secret", storage.EventTTL},
+		{"test-watch:secret", storage.EventDelete},
+		{"test-watch:queue", storage.EventSet},
+		{"test-watch:queue", storage.EventPop},
+	}
+	for i, want := range expected {
+		if events[i].Channel != want.key || string(events[i].Payload) != want.event {
+			t.Errorf("Expected %s event for %s, got %+v", want.event, want.key, events[i])
+		}
+	}
+	recvReply := &storage.ReceiveReply{}
+	args := &storage.ReceiveArgs{SubscriptionID: watchReply.SubscriptionID, Timeout: 1}
+	if err := client.Call("Store.Receive", args, recvReply); err != nil {
+		t.Fatalf("Receive RPC call failed: %v", err)
+	}
+	if len(recvReply.Messages) != 0 {
+		t.Errorf("Expected no more events, got %+v", recvReply.Messages)
+	}
+
+	unsubReply := &storage.UnsubscribeReply{}
+	if err := client.Call("Store.Unsubscribe", &storage.UnsubscribeArgs{SubscriptionID: watchReply.SubscriptionID}, unsubReply); err != nil {
+		t.Fatalf("Unsubscribe RPC call failed: %v", err)
+	}
+}
+
+func TestServerTxn(t *testing.T) {
+	_, client := startTestServer(t)
+
+	keys := []string{"test-txn-a", "test-txn-b", "test-txn-counter"}
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: keys}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-txn-a", Value: []byte("old")}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+
+	version := setReply.Version
+	txnArgs := &storage.TxnArgs{
+		Watch: []storage.TxnWatchArgs{{Key: "test-txn-a", Version: &version}},
+		Ops: []storage.TxnOpArgs{
+			{Type: storage.TxnSet, Key: "test-txn-a", Value: []byte("new")},
+			{Type: storage.TxnSet, Key: "test-txn-b", Value: []byte("b")},
+			{Type: storage.TxnIncrBy, Key: "test-txn-counter", Delta: 5},
+		},
+	}
+	txnReply := &storage.TxnReply{}
+	if err := client.Call("Store.Txn", txnArgs, txnReply); err != nil {
+		t.Fatalf("Txn RPC call failed: %v", err)
+	}
+	if !txnReply.Committed || txnReply.Error != "" {
+		t.Fatalf("Expected transaction to commit, got %+v", txnReply)
+	}
+	if txnReply.Results[0].Version != version+1 || txnReply.Results[2].Value != 5 {
+		t.Errorf("Unexpected results %+v", txnReply.Results)
+	}
+
+	// The same transaction now watches a stale version and must not apply
+	txnArgs.Ops[1].Value = []byte("changed")
+	txnReply = &storage.TxnReply{}
+	if err := client.Call("Store.Txn", txnArgs, txnReply); err != nil {
+		t.Fatalf("Txn RPC call failed: %v", err)
+	}
+	if txnReply.Committed || txnReply.Error != "" {
+		t.Errorf("Expected transaction to abort, got %+v", txnReply)
+	}
+
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-txn-b"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if string(getReply.Value) != "b" {
+		t.Errorf("Expected aborted transaction to leave b unchanged, got %q", getReply.Value)
+	}
+
+	// An increment outside the transaction changes the counter's version
+	getReply = &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-txn-counter"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	counterVersion := getReply.Version
+	if err := client.Call("Store.IncrBy", &storage.IncrByArgs{Key: "test-txn-counter", Delta: 1}, &storage.IncrByReply{}); err != nil {
+		t.Fatalf("IncrBy RPC call failed: %v", err)
+	}
+	txnArgs = &storage.TxnArgs{
+		Watch: []storage.TxnWatchArgs{{Key: "test-txn-counter", Version: &counterVersion}},
+		Ops:   []storage.TxnOpArgs{{Type: storage.TxnSet, Key: "test-txn-b", Value: []byte("changed")}},
+	}
+	txnReply = &storage.TxnReply{}
+	if err := client.Call("Store.Txn", txnArgs, txnReply); err != nil {
+		t.Fatalf("Txn RPC call failed: %v", err)
+	}
+	if txnReply.Committed || txnReply.Error != "" {
+		t.Errorf("Expected transaction watching the counter's old version to abort, got %+v", txnReply)
+	}
+
+	// A non-integer counter rejects the whole transaction before anything is written
+	txnArgs = &storage.TxnArgs{
+		Ops: []storage.TxnOpArgs{
+			{Type: storage.TxnDelete, Key: "test-txn-b"},
+			{Type: storage.TxnIncrBy, Key: "test-txn-a", Delta: 1},
+		},
+	}
+	txnReply = &storage.TxnReply{}
+	if err := client.Call("Store.Txn", txnArgs, txnReply); err != nil {
+		t.Fatalf("Txn RPC call failed: %v", err)
+	}
+	if txnReply.Committed || txnReply.Error == "" {
+		t.Errorf("Expected transaction to fail, got %+v", txnReply)
+	}
+	getReply = &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-txn-b"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if getReply.Error != "" {
+		t.Errorf("Expected b to survive the failed transaction, got error %q", getReply.Error)
+	}
+
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: keys}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerLock(t *testing.T) {
+	_, client := startTestServer(t)
+
+	lockArgs := &storage.LockArgs{Key: "test-lock", Lease: 5000}
+	first := &storage.LockReply{}
+	if err := client.Call("Store.Lock", lockArgs, first); err != nil {
+		t.Fatalf("Lock RPC call failed: %v", err)
+	}
+	if first.Error != "" || first.Owner == "" {
+		t.Fatalf("Expected lock to be acquired, got %+v", first)
+	}
+
+	// The owner token cannot be read through the key, and writing or
+	// deleting the key leaves the lock alone
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-lock"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if getReply.Value != nil {
+		t.Errorf("Expected the lock's key to hold no value, got %q", getReply.Value)
+	}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-lock", Value: []byte("x")}, &storage.SetReply{}); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{"test-lock"}}, &storage.DeleteReply{}); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+
+	second := &storage.LockReply{}
+	if err := client.Call("Store.Lock", lockArgs, second); err != nil {
+		t.Fatalf("Lock RPC call failed: %v", err)
+	}
+	if second.Error != storage.ErrLockHeld.Error() {
+		t.Errorf("Expected lock held error, got %+v", second)
+	}
+
+	renewReply := &storage.RenewReply{}
+	if err := client.Call("Store.Renew", &storage.RenewArgs{Key: "test-lock", Owner: "someone-else", Lease: 5000}, renewReply); err != nil {
+		t.Fatalf("Renew RPC call failed: %v", err)
+	}
+	if renewReply.Error != storage.ErrNotLockHolder.Error() {
+		t.Errorf("Expected not lock holder error, got %q", renewReply.Error)
+	}
+	renewReply = &storage.RenewReply{}
+	if err := client.Call("Store.Renew", &storage.RenewArgs{Key: "test-lock", Owner: first.Owner, Lease: 5000}, renewReply); err != nil {
+		t.Fatalf("Renew RPC call failed: %v", err)
+	}
+	if renewReply.Error != "" {
+		t.Errorf("Expected holder to renew, got %q", renewReply.Error)
+	}
+
+	unlockReply := &storage.UnlockReply{}
+	if err := client.Call("Store.Unlock", &storage.UnlockArgs{Key: "test-lock", Owner: "someone-else"}, unlockReply); err != nil {
+		t.Fatalf("Unlock RPC call failed: %v", err)
+	}
+	if unlockReply.Error != storage.ErrNotLockHolder.Error() {
+		t.Errorf("Expected not lock holder error, got %q", unlockReply.Error)
+	}
+	unlockReply = &storage.UnlockReply{}
+	if err := client.Call("Store.Unlock", &storage.UnlockArgs{Key: "test-lock", Owner: first.Owner}, unlockReply); err != nil {
+		t.Fatalf("Unlock RPC call failed: %v", err)
+	}
+	if unlockReply.Error != "" {
+		t.Errorf("Expected holder to unlock, got %q", unlockReply.Error)
+	}
+
+	// The next holder gets a higher fencing token
+	third := &storage.LockReply{}
+	if err := client.Call("Store.Lock", lockArgs, third); err != nil {
+		t.Fatalf("Lock RPC call failed: %v", err)
+	}
+	if third.Error != "" || third.Fence <= first.Fence {
+		t.Errorf("Expected fence above %d, got %+v", first.Fence, third)
+	}
+	if err := client.Call("Store.Unlock", &storage.UnlockArgs{Key: "test-lock", Owner: third.Owner}, unlockReply); err != nil {
+		t.Fatalf("Unlock RPC call failed: %v", err)
+	}
+
+	// Of concurrent attempts exactly one holder takes the lock and a token
+	var wg sync.WaitGroup
+	replies := make([]*storage.LockReply, 20)
+	for i := range replies {
+		replies[i] = &storage.LockReply{}
+		wg.Add(1)
+		go func(reply *storage.LockReply) {
+			defer wg.Done()
+			if err := client.Call("Store.Lock", lockArgs, reply); err != nil {
+				t.Errorf("Lock RPC call failed: %v", err)
+			}
+		}(replies[i])
+	}
+	wg.Wait()
+	var holder *storage.LockReply
+	for _, reply := range replies {
+		switch reply.Error {
+		case "":
+			if holder != nil {
+				t.Errorf("Expected one holder, got %+v and %+v", holder, reply)
+			}
+			holder = reply
+		case storage.ErrLockHeld.Error():
+		default:
+			t.Errorf("Unexpected lock error %q", reply.Error)
+		}
+	}
+	if holder == nil {
+		t.Fatal("Expected one attempt to take the lock")
+	}
+	if holder.Fence != third.Fence+1 {
+		t.Errorf("Expected fence %d, got %d", third.Fence+1, holder.Fence)
+	}
+	if err := client.Call("Store.Unlock", &storage.UnlockArgs{Key: "test-lock", Owner: holder.Owner}, unlockReply); err != nil {
+		t.Fatalf("Unlock RPC call failed: %v", err)
+	}
+}
+
+func TestServerRateLimit(t *testing.T) {
+	_, client := startTestServer(t)
+
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{"test-ratelimit"}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+
+	args := &storage.RateLimitArgs{Key: "test-ratelimit", Limit: 3, Window: 60000}
+	for i := 0; i < 3; i++ {
+		reply := &storage.RateLimitReply{}
+		if err := client.Call("Store.RateLimit", args, reply); err != nil {
+			t.Fatalf("RateLimit RPC call failed: %v", err)
+		}
+		if !reply.Allowed || reply.Remaining != 2-i {
+			t.Errorf("Request %d: expected allowed with %d remaining, got %+v", i, 2-i, reply)
+		}
+	}
+
+	reply := &storage.RateLimitReply{}
+	if err := client.Call("Store.RateLimit", args, reply); err != nil {
+		t.Fatalf("RateLimit RPC call failed: %v", err)
+	}
+	if reply.Allowed || reply.Remaining != 0 {
+		t.Errorf("Expected request over the limit to be denied, got %+v", reply)
+	}
+	if reply.RetryAfter <= 0 || reply.RetryAfter > 20000 || reply.ResetAfter <= 40000 {
+		t.Errorf("Unexpected retry-after %dms and reset-after %dms", reply.RetryAfter, reply.ResetAfter)
+	}
+
+	invalid := &storage.RateLimitReply{}
+	if err := client.Call("Store.RateLimit", &storage.RateLimitArgs{Key: "test-ratelimit", Limit: 3, Window: 60000, Cost: 4}, invalid); err != nil {
+		t.Fatalf("RateLimit RPC call failed: %v", err)
+	}
+	if invalid.Error != "invalid arguments" {
+		t.Errorf("Expected invalid arguments for cost above limit, got %q", invalid.Error)
+	}
+
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{"test-ratelimit"}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	_, client := startTestServer(t)
+
+	uploadID := "0123456789abcdef"
+	chunks := [][]byte{[]byte("hello, "), []byte("streamed "), []byte("world")}
+	for i, chunk := range chunks {
+		reply := &storage.StreamChunkReply{}
+		args := &storage.StreamChunkArgs{Key: "test-stream", UploadID: uploadID, Index: i, Data: chunk}
+		if err := client.Call("Store.StreamChunk", args, reply); err != nil {
+			t.Fatalf("StreamChunk RPC call failed: %v", err)
+		}
+		if reply.Error != "" {
+			t.Fatalf("StreamChunk failed: %s", reply.Error)
+		}
+	}
+
+	whole := []byte("hello, streamed world")
+	sum := sha256.Sum256(whole)
+	commitArgs := &storage.StreamCommitArgs{
+		Key:      "test-stream",
+		UploadID: uploadID,
+		Chunks:   len(chunks),
+		Size:     int64(len(whole)) + 1,
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+
+	// A size that does not match the staged chunks is rejected
+	commitReply := &storage.SetReply{}
+	if err := client.Call("Store.StreamCommit", commitArgs, commitReply); err != nil {
+		t.Fatalf("StreamCommit RPC call failed: %v", err)
+	}
+	if commitReply.Error == "" {
+		t.Errorf("Expected commit with the wrong size to fail")
+	}
+
+	// Chunk counts are bounded before anything is sized by them
+	for _, chunkCount := range []int{1 << 30, len(whole) + 1} {
+		args := *commitArgs
+		args.Chunks, args.Size = chunkCount, int64(len(whole))
+		commitReply = &storage.SetReply{}
+		if err := client.Call("Store.StreamCommit", &args, commitReply); err != nil {
+			t.Fatalf("StreamCommit RPC call failed: %v", err)
+		}
+		if commitReply.Error != "invalid arguments" {
+			t.Errorf("Expected %d chunks to be rejected, got %+v", chunkCount, commitReply)
+		}
+	}
+
+	commitArgs.Size = int64(len(whole))
+	commitReply = &storage.SetReply{}
+	if err := client.Call("Store.StreamCommit", commitArgs, commitReply); err != nil {
+		t.Fatalf("StreamCommit RPC call failed: %v", err)
+	}
+	if commitReply.Error != "" || commitReply.Version == 0 {
+		t.Fatalf("Expected commit to succeed, got %+v", commitReply)
+	}
+
+	openReply := &storage.StreamOpenReply{}
+	if err := client.Call("Store.StreamOpen", &storage.GetArgs{Key: "test-stream"}, openReply); err != nil {
+		t.Fatalf("StreamOpen RPC call failed: %v", err)
+	}
+	if openReply.Error != "" || openReply.Chunks != len(chunks) || openReply.Checksum != commitArgs.Checksum {
+		t.Fatalf("Unexpected manifest %+v", openReply)
+	}
+
+	var read []byte
+	for i := 0; i < openReply.Chunks; i++ {
+		reply := &storage.StreamReadReply{}
+		args := &storage.StreamReadArgs{Key: "test-stream", UploadID: openReply.UploadID, Index: i}
+		if err := client.Call("Store.StreamRead", args, reply); err != nil {
+			t.Fatalf("StreamRead RPC call failed: %v", err)
+		}
+		read = append(read, reply.Data...)
+	}
+	if string(read) != string(whole) {
+		t.Errorf("Expected %q, got %q", whole, read)
+	}
+
+	readChunk := func(uploadID string) string {
+		t.Helper()
+		reply := &storage.StreamReadReply{}
+		args := &storage.StreamReadArgs{Key: "test-stream", UploadID: uploadID, Index: 0}
+		if err := client.Call("Store.StreamRead", args, reply); err != nil {
+			t.Fatalf("StreamRead RPC call failed: %v", err)
+		}
+		return reply.Error
+	}
+
+	// Committing a new upload deletes the chunks of the one it replaces
+	newID := "fedcba9876543210"
+	chunkReply := &storage.StreamChunkReply{}
+	chunkArgs := &storage.StreamChunkArgs{Key: "test-stream", UploadID: newID, Index: 0, Data: whole}
+	if err := client.Call("Store.StreamChunk", chunkArgs, chunkReply); err != nil || chunkReply.Error != "" {
+		t.Fatalf("StreamChunk failed: %v %s", err, chunkReply.Error)
+	}
+	commitArgs.UploadID, commitArgs.Chunks = newID, 1
+	commitReply = &storage.SetReply{}
+	if err := client.Call("Store.StreamCommit", commitArgs, commitReply); err != nil || commitReply.Error != "" {
+		t.Fatalf("StreamCommit failed: %v %s", err, commitReply.Error)
+	}
+	if reply := readChunk(uploadID); reply != "chunk not found" {
+		t.Errorf("Expected the replaced upload's chunks to be deleted, got %q", reply)
+	}
+
+	// and deleting the key deletes the chunks of its current upload
+	delReply := &storage.DeleteReply{}
+	if err := client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{"test-stream"}}, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+	if delReply.Deleted != 1 {
+		t.Errorf("Expected 1 key deleted, got %d", delReply.Deleted)
+	}
+	if reply := readChunk(newID); reply != "chunk not found" {
+		t.Errorf("Expected the deleted stream's chunks to be deleted, got %q", reply)
+	}
+
+	// as does deleting it in a transaction
+	txnID := "00112233445566ff"
+	chunkArgs.UploadID = txnID
+	if err := client.Call("Store.StreamChunk", chunkArgs, chunkReply); err != nil || chunkReply.Error != "" {
+		t.Fatalf("StreamChunk failed: %v %s", err, chunkReply.Error)
+	}
+	commitArgs.UploadID = txnID
+	if err := client.Call("Store.StreamCommit", commitArgs, commitReply); err != nil || commitReply.Error != "" {
+		t.Fatalf("StreamCommit failed: %v %s", err, commitReply.Error)
+	}
+	txnReply := &storage.TxnReply{}
+	txnArgs := &storage.TxnArgs{Ops: []storage.TxnOpArgs{{Type: storage.TxnDelete, Key: "test-stream"}}}
+	if err := client.Call("Store.Txn", txnArgs, txnReply); err != nil || txnReply.Error != "" {
+		t.Fatalf("Txn failed: %v %s", err, txnReply.Error)
+	}
+	if reply := readChunk(txnID); reply != "chunk not found" {
+		t.Errorf("Expected the stream deleted in a transaction to lose its chunks, got %q", reply)
+	}
+}
+
+func TestServerStreamQuota(t *testing.T) {
+	_, client := startTestServerWithConfig(t, config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 10,
+		Namespaces: []config.NamespaceConfig{
+			{Name: "test-sq", MaxBytes: 10},
+		},
+	})
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-sq", Keys: []string{"s"}}, &storage.DeleteReply{})
+
+	stage := func(uploadID string, index int, data string, ttl int) string {
+		t.Helper()
+		reply := &storage.StreamChunkReply{}
+		args := &storage.StreamChunkArgs{Namespace: "test-sq", Key: "s", UploadID: uploadID, Index: index, Data: []byte(data), TTL: &ttl}
+		if err := client.Call("Store.StreamChunk", args, reply); err != nil {
+			t.Fatalf("StreamChunk RPC call failed: %v", err)
+		}
+		return reply.Error
+	}
+
+	// Staged chunks are charged before anything is committed
+	if err := stage("aa", 0, "123456", 60); err != "" {
+		t.Fatalf("StreamChunk failed: %s", err)
+	}
+	if err := stage("aa", 1, "123456", 60); !strings.Contains(err, "byte quota") {
+		t.Errorf("Expected staged chunks to exceed the byte quota, got %q", err)
+	}
+	// Restaging a chunk only charges what it grows by
+	if err := stage("aa", 0, "123456", 60); err != "" {
+		t.Errorf("Expected restaging a chunk to fit, got %q", err)
+	}
+
+	// Committing moves the charge to the value rather than adding to it
+	sum := sha256.Sum256([]byte("123456"))
+	commitArgs := &storage.StreamCommitArgs{
+		Namespace: "test-sq",
+		Key:       "s",
+		UploadID:  "aa",
+		Chunks:    1,
+		Size:      6,
+		Checksum:  hex.EncodeToString(sum[:]),
+	}
+	commitReply := &storage.SetReply{}
+	if err := client.Call("Store.StreamCommit", commitArgs, commitReply); err != nil || commitReply.Error != "" {
+		t.Fatalf("StreamCommit failed: %v %s", err, commitReply.Error)
+	}
+	if err := stage("bb", 0, "12345", 60); !strings.Contains(err, "byte quota") {
+		t.Errorf("Expected the committed value to stay charged, got %q", err)
+	}
+
+	// Chunks that are never committed are released once they expire
+	if err := stage("cc", 0, "1234", 1); err != "" {
+		t.Fatalf("StreamChunk failed: %s", err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if err := stage("dd", 0, "1234", 60); err != "" {
+		t.Errorf("Expected expired chunks to be released, got %q", err)
+	}
+
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-sq", Keys: []string{"s"}}, &storage.DeleteReply{})
+}
+
+func TestServerHistory(t *testing.T) {
+	_, client := startTestServerWithConfig(t, config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 10,
+		Namespaces: []config.NamespaceConfig{
+			{Name: "test-versioned", History: 2},
+			{Name: "test-kept", History: 2, MaxBytes: 10},
+		},
+	})
+
+	for _, value := range []string{"v1", "v2", "v3"} {
+		reply := &storage.SetReply{}
+		args := &storage.SetArgs{Namespace: "test-versioned", Key: "test-hist", Value: []byte(value)}
+		if err := client.Call("Store.Set", args, reply); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+		if reply.Error != "" {
+			t.Fatalf("Set failed: %s", reply.Error)
+		}
+	}
+
+	listReply := &storage.ListVersionsReply{}
+	listArgs := &storage.GetArgs{Namespace: "test-versioned", Key: "test-hist"}
+	if err := client.Call("Store.ListVersions", listArgs, listReply); err != nil {
+		t.Fatalf("ListVersions RPC call failed: %v", err)
+	}
+	if listReply.Error != "" || len(listReply.Versions) != 2 {
+		t.Fatalf("Expected 2 kept versions, got %+v", listReply)
+	}
+	newest := listReply.Versions[0]
+	if newest.Version != listReply.Versions[1].Version+1 || newest.Timestamp == 0 || newest.TTL <= 0 {
+		t.Errorf("Unexpected versions %+v", listReply.Versions)
+	}
+
+	getVersion := func(version int64) *storage.GetVersionReply {
+		t.Helper()
+		reply := &storage.GetVersionReply{}
+		args := &storage.GetVersionArgs{Namespace: "test-versioned", Key: "test-hist", Version: version}
+		if err := client.Call("Store.GetVersion", args, reply); err != nil {
+			t.Fatalf("GetVersion RPC call failed: %v", err)
+		}
+		return reply
+	}
+
+	if reply := getVersion(newest.Version - 1); reply.Error != "" || string(reply.Value) != "v2" {
+		t.Errorf("Expected v2, got %+v", reply)
+	}
+	// Only the last two versions are kept
+	if reply := getVersion(newest.Version - 2); reply.Error != storage.ErrVersionNotFound.Error() {
+		t.Errorf("Expected dropped version to be not found, got %+v", reply)
+	}
+
+	rollbackReply := &storage.SetReply{}
+	rollbackArgs := &storage.RollbackArgs{Namespace: "test-versioned", Key: "test-hist", Version: newest.Version - 1}
+	if err := client.Call("Store.Rollback", rollbackArgs, rollbackReply); err != nil {
+		t.Fatalf("Rollback RPC call failed: %v", err)
+	}
+	if rollbackReply.Error != "" || rollbackReply.Version != newest.Version+1 {
+		t.Fatalf("Expected rollback to write version %d, got %+v", newest.Version+1, rollbackReply)
+	}
+
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Namespace: "test-versioned", Key: "test-hist"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if string(getReply.Value) != "v2" || getReply.Version != rollbackReply.Version {
+		t.Errorf("Expected rolled back value v2, got %+v", getReply)
+	}
+
+	// Deleting the key deletes its history
+	delReply := &storage.DeleteReply{}
+	delArgs := &storage.DeleteArgs{Namespace: "test-versioned", Keys: []string{"test-hist"}}
+	if err := client.Call("Store.Delete", delArgs, delReply); err != nil {
+		t.Fatalf("Delete RPC call failed: %v", err)
+	}
+	if reply := getVersion(rollbackReply.Version); reply.Error != storage.ErrVersionNotFound.Error() {
+		t.Errorf("Expected deleted version to be not found, got %+v", reply)
+	}
+	listReply = &storage.ListVersionsReply{}
+	if err := client.Call("Store.ListVersions", listArgs, listReply); err != nil {
+		t.Fatalf("ListVersions RPC call failed: %v", err)
+	}
+	if listReply.Error != "" || len(listReply.Versions) != 0 {
+		t.Errorf("Expected no versions after delete, got %+v", listReply)
+	}
+
+	// Quotas count the kept copies: 4 bytes kept twice more exceed 10
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Namespace: "test-kept", Key: "test-hist", Value: []byte("four")}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if !strings.Contains(setReply.Error, "byte quota") {
+		t.Errorf("Expected byte quota error, got %+v", setReply)
+	}
+	setReply = &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Namespace: "test-kept", Key: "test-hist", Value: []byte("3b")}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != "" {
+		t.Errorf("Expected 2 bytes kept twice more to fit, got %+v", setReply)
+	}
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-kept", Keys: []string{"test-hist"}}, delReply)
+
+	// Namespaces without history reject version calls
+	if err := client.Call("Store.ListVersions", &storage.GetArgs{Key: "test-hist"}, listReply); err != nil {
+		t.Fatalf("ListVersions RPC call failed: %v", err)
+	}
+	if listReply.Error == "" {
+		t.Errorf("Expected ListVersions without history to fail")
+	}
+}
+
+func TestServerMaxReads(t *testing.T) {
+	forEachBackend(t, testConfig(), testServerMaxReads)
+}
+
+func testServerMaxReads(t *testing.T, client *rpc.Client) {
+
+	setReply := &storage.SetReply{}
+	setArgs := &storage.SetArgs{Key: "test-read-twice", Value: []byte("secret"), MaxReads: 2}
+	if err := client.Call("Store.Set", setArgs, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != "" {
+		t.Fatalf("Set failed: %s", setReply.Error)
+	}
+
+	get := func() *storage.GetReply {
+		t.Helper()
+		reply := &storage.GetReply{}
+		if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-read-twice"}, reply); err != nil {
+			t.Fatalf("Get RPC call failed: %v", err)
+		}
+		return reply
+	}
+
+	for left := int64(1); left >= 0; left-- {
+		reply := get()
+		if reply.Error != "" || string(reply.Value) != "secret" {
+			t.Fatalf("Expected secret, got %+v", reply)
+		}
+		if !reply.Limited || reply.ReadsLeft != left {
+			t.Errorf("Expected %d reads left, got %+v", left, reply)
+		}
+	}
+	if reply := get(); reply.Error != storage.ErrConsumed.Error() {
+		t.Errorf("Expected consumed error, got %+v", reply)
+	}
+
+	// Concurrent readers of a read-once value never share the read
+	setArgs = &storage.SetArgs{Key: "test-read-once", Value: []byte("secret"), MaxReads: 1}
+	if err := client.Call("Store.Set", setArgs, setReply); err != nil || setReply.Error != "" {
+		t.Fatalf("Set failed: %v %s", err, setReply.Error)
+	}
+
+	var wg sync.WaitGroup
+	var reads int64
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply := &storage.GetReply{}
+			if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-read-once"}, reply); err != nil {
+				t.Errorf("Get RPC call failed: %v", err)
+				return
+			}
+			if reply.Error == "" {
+				atomic.AddInt64(&reads, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if reads != 1 {
+		t.Errorf("Expected exactly one read, got %d", reads)
+	}
+
+	// The read count cannot be reset through its bookkeeping key
+	setArgs = &storage.SetArgs{Key: "test-read-guarded", Value: []byte("secret"), MaxReads: 1}
+	if err := client.Call("Store.Set", setArgs, setReply); err != nil || setReply.Error != "" {
+		t.Fatalf("Set failed: %v %s", err, setReply.Error)
+	}
+	forged := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "__tritium:reads:test-read-guarded", Value: []byte("1000")}, forged); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if forged.Error == "" {
+		t.Errorf("Expected a write to a bookkeeping key to be rejected")
+	}
+	reads = 0
+	for i := 0; i < 3; i++ {
+		reply := &storage.GetReply{}
+		if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-read-guarded"}, reply); err != nil {
+			t.Fatalf("Get RPC call failed: %v", err)
+		}
+		if reply.Error == "" {
+			reads++
+		}
+	}
+	if reads != 1 {
+		t.Errorf("Expected exactly one read, got %d", reads)
+	}
+
+	// Writing the key again lifts the limit
+	setArgs = &storage.SetArgs{Key: "test-read-twice", Value: []byte("plain")}
+	if err := client.Call("Store.Set", setArgs, setReply); err != nil || setReply.Error != "" {
+		t.Fatalf("Set failed: %v %s", err, setReply.Error)
+	}
+	for i := 0; i < 3; i++ {
+		if reply := get(); reply.Error != "" || reply.Limited {
+			t.Fatalf("Expected unlimited reads, got %+v", reply)
+		}
+	}
+}
+
+// stubBackend is a test double holding values in a map. Operations it does
+// not override panic through the nil embedded Backend.
+type stubBackend struct {
+	storage.Backend
+	values map[string]string
+}
+
+func (b *stubBackend) SetExIf(key string, ttl int, value string, cond storage.Condition, maxReads int) (int64, error) {
+	// Values passed to backends are only valid during the call
+	b.values[key] = strings.Clone(value)
+	return 1, nil
+}
+
+func (b *stubBackend) Get(key string) (storage.Item, error) {
+	if v, ok := b.values[key]; ok {
+		return storage.Item{Value: []byte(v), Version: 1}, nil
+	}
+	return storage.Item{}, nil
+}
+
+func (b *stubBackend) Close() error { return nil }
+
+func TestServerBackend(t *testing.T) {
+	backend := &stubBackend{values: make(map[string]string)}
+	srv, err := NewServerWithBackend(config.Config{}, backend)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := srv.Start(testAddr); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+
+	client, err := rpc.Dial("tcp", srv.GetAddress())
+	if err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer client.Close()
+
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-stub", Value: []byte("secret")}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != "" || backend.values["test-stub"] != "secret" {
+		t.Fatalf("Expected value in the stub backend, got %+v", setReply)
+	}
+
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-stub"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if string(getReply.Value) != "secret" {
+		t.Errorf("Expected secret, got %+v", getReply)
+	}
+
+	// Capabilities the backend lacks are reported rather than attempted
+	hsetReply := &storage.HSetReply{}
+	hsetArgs := &storage.HSetArgs{Key: "test-stub-hash", Fields: map[string][]byte{"f": []byte("v")}}
+	if err := client.Call("Store.HSet", hsetArgs, hsetReply); err != nil {
+		t.Fatalf("HSet RPC call failed: %v", err)
+	}
+	if hsetReply.Error != storage.ErrUnsupported.Error() {
+		t.Errorf("Expected unsupported error, got %+v", hsetReply)
+	}
+}
+
+func TestServerMemoryBackend(t *testing.T) {
+	// No RESP server needed
+	_, client := startTestServerWithConfig(t, config.Config{Backend: config.BackendMemory})
+
+	call := func(method string, args, reply interface{}) {
+		t.Helper()
+		if err := client.Call(method, args, reply); err != nil {
+			t.Fatalf("%s RPC call failed: %v", method, err)
+		}
+	}
+
+	// Values are binary safe
+	value := []byte{0, 'a', 0xff, '\r', '\n'}
+	setReply := &storage.SetReply{}
+	call("Store.Set", &storage.SetArgs{Key: "test-mem", Value: value}, setReply)
+	if setReply.Error != "" || setReply.Version != 1 {
+		t.Fatalf("Unexpected Set reply %+v", setReply)
+	}
+	getReply := &storage.GetReply{}
+	call("Store.Get", &storage.GetArgs{Key: "test-mem"}, getReply)
+	if string(getReply.Value) != string(value) || getReply.Version != 1 {
+		t.Errorf("Expected binary value at version 1, got %+v", getReply)
+	}
+
+	// Conditional writes check the version
+	stale := int64(7)
+	setReply = &storage.SetReply{}
+	call("Store.Set", &storage.SetArgs{Key: "test-mem", Value: []byte("x"), IfVersion: &stale}, setReply)
+	if setReply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure, got %+v", setReply)
+	}
+
+	incrReply := &storage.IncrByReply{}
+	call("Store.IncrBy", &storage.IncrByArgs{Key: "test-mem-counter", Delta: 5}, incrReply)
+	call("Store.IncrBy", &storage.IncrByArgs{Key: "test-mem-counter", Delta: -2}, incrReply)
+	if incrReply.Error != "" || incrReply.Value != 3 {
+		t.Errorf("Expected counter at 3, got %+v", incrReply)
+	}
+
+	scanReply := &storage.ScanReply{}
+	var scanned []string
+	for {
+		call("Store.Scan", &storage.ScanArgs{Pattern: "test-mem*", Cursor: scanReply.Cursor}, scanReply)
+		scanned = append(scanned, scanReply.Keys...)
+		if scanReply.Cursor == 0 {
+			break
+		}
+	}
+	if len(scanned) != 2 {
+		t.Errorf("Expected 2 scanned keys, got %v", scanned)
+	}
+
+	// Keys expire through the janitor
+	ttl := 1
+	call("Store.Set", &storage.SetArgs{Key: "test-mem-short", Value: []byte("v"), TTL: &ttl}, setReply)
+	ttlReply := &storage.TTLReply{}
+	call("Store.TTL", &storage.TTLArgs{Key: "test-mem-short"}, ttlReply)
+	if ttlReply.TTL != 1 {
+		t.Errorf("Expected TTL of 1, got %+v", ttlReply)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	getReply = &storage.GetReply{}
+	call("Store.Get", &storage.GetArgs{Key: "test-mem-short"}, getReply)
+	if getReply.Error != "key not found" {
+		t.Errorf("Expected expired key, got %+v", getReply)
+	}
+
+	call("Store.Set", &storage.SetArgs{Key: "test-mem-once", Value: []byte("v"), MaxReads: 1}, setReply)
+	call("Store.Get", &storage.GetArgs{Key: "test-mem-once"}, getReply)
+	call("Store.Get", &storage.GetArgs{Key: "test-mem-once"}, getReply)
+	if getReply.Error != storage.ErrConsumed.Error() {
+		t.Errorf("Expected consumed error, got %+v", getReply)
+	}
+
+	deleteReply := &storage.DeleteReply{}
+	call("Store.Delete", &storage.DeleteArgs{Keys: []string{"test-mem", "test-mem-missing"}}, deleteReply)
+	if deleteReply.Deleted != 1 {
+		t.Errorf("Expected 1 deleted key, got %+v", deleteReply)
+	}
+
+	// Everything beyond plain keys and counters needs the RESP backend
+	unsupported := []struct {
+		method string
+		args   interface{}
+		reply  interface{}
+	}{
+		{"Store.HSet", &storage.HSetArgs{Key: "test-mem-hash", Fields: map[string][]byte{"f": []byte("v")}}, &storage.HSetReply{}},
+		{"Store.Push", &storage.PushArgs{Key: "test-mem-queue", Values: [][]byte{[]byte("v")}}, &storage.PushReply{}},
+		{"Store.SAdd", &storage.SAddArgs{Key: "test-mem-set", Members: [][]byte{[]byte("m")}}, &storage.SAddReply{}},
+		{"Store.Subscribe", &storage.SubscribeArgs{Patterns: []string{"test-mem.*"}}, &storage.SubscribeReply{}},
+		{"Store.Watch", &storage.WatchArgs{Key: "test-mem"}, &storage.SubscribeReply{}},
+		{"Store.Txn", &storage.TxnArgs{Ops: []storage.TxnOpArgs{{Type: storage.TxnDelete, Key: "test-mem"}}}, &storage.TxnReply{}},
+		{"Store.Lock", &storage.LockArgs{Key: "test-mem-lock", Lease: 1000}, &storage.LockReply{}},
+		{"Store.RateLimit", &storage.RateLimitArgs{Key: "test-mem-rate", Limit: 1, Window: 1000}, &storage.RateLimitReply{}},
+		{"Store.StreamChunk", &storage.StreamChunkArgs{Key: "test-mem-stream", UploadID: "ab", Data: []byte("v")}, &storage.StreamChunkReply{}},
+	}
+	for _, u := range unsupported {
+		call(u.method, u.args, u.reply)
+		if msg := reflect.ValueOf(u.reply).Elem().FieldByName("Error").String(); msg != storage.ErrUnsupported.Error() {
+			t.Errorf("Expected %s to be unsupported, got %q", u.method, msg)
+		}
+	}
+}
+
+func TestServerMemoryLimit(t *testing.T) {
+	value := []byte(strings.Repeat("v", 100))
+
+	// Each key charges about 170 bytes, so 5 fit in the limit
+	cfg := config.Config{Backend: config.BackendMemory, MemoryLimit: 1000, EvictionPolicy: "reject-writes"}
+	srv, client := startTestServerWithConfig(t, cfg)
+	for i := 0; i < 5; i++ {
+		setReply := &storage.SetReply{}
+		if err := client.Call("Store.Set", &storage.SetArgs{Key: fmt.Sprintf("test-mem-%d", i), Value: value}, setReply); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+		if setReply.Error != "" {
+			t.Fatalf("Unexpected Set error for key %d: %s", i, setReply.Error)
+		}
+	}
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-mem-5", Value: value}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != storage.ErrMemoryLimit.Error() {
+		t.Errorf("Expected memory limit error, got %+v", setReply)
+	}
+	stats := srv.Stats()
+	if stats.MemoryLimit != 1000 || stats.MemoryUsed > 1000 || stats.EvictionPolicy != "reject-writes" {
+		t.Errorf("Unexpected memory stats %+v", stats)
+	}
+
+	// With volatile-lru the least recently read key makes room instead
+	cfg.EvictionPolicy = "volatile-lru"
+	srv, client = startTestServerWithConfig(t, cfg)
+	for i := 0; i < 5; i++ {
+		if err := client.Call("Store.Set", &storage.SetArgs{Key: fmt.Sprintf("test-mem-%d", i), Value: value}, &storage.SetReply{}); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+	}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-mem-0"}, &storage.GetReply{}); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	setReply = &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-mem-5", Value: value}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != "" {
+		t.Fatalf("Expected eviction to make room, got %+v", setReply)
+	}
+
+	for key, want := range map[string]string{"test-mem-0": "", "test-mem-1": "key not found", "test-mem-5": ""} {
+		getReply := &storage.GetReply{}
+		if err := client.Call("Store.Get", &storage.GetArgs{Key: key}, getReply); err != nil {
+			t.Fatalf("Get RPC call failed: %v", err)
+		}
+		if getReply.Error != want {
+			t.Errorf("Expected %q for %s, got %+v", want, key, getReply)
+		}
+	}
+	if stats := srv.Stats(); stats.Evictions != 1 || stats.MemoryUsed > 1000 {
+		t.Errorf("Expected 1 eviction within the limit, got %+v", stats)
+	}
+}
+
+func TestServerRespEvictionPolicy(t *testing.T) {
+	// The RESP server would evict a value's bookkeeping apart from the value
+	cfg := config.Config{MemStoreAddr: "localhost:6379", MaxConnections: 1, EvictionPolicy: "volatile-lru"}
+	if _, err := NewServer(cfg); !errors.Is(err, storage.ErrUnsupported) {
+		t.Errorf("Expected eviction on a RESP backend to be refused, got %v", err)
+	}
+}
+
+func TestServerEncryption(t *testing.T) {
+	_, client := startTestServerWithConfig(t, config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 10,
+		EncryptValues:  true,
+	})
+
+	secret := []byte("plaintext secret")
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-sealed", Value: secret}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != "" {
+		t.Fatalf("Unexpected Set error: %s", setReply.Error)
+	}
+
+	getReply := &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-sealed"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if string(getReply.Value) != string(secret) {
+		t.Errorf("Expected %q, got %+v", secret, getReply)
+	}
+
+	// Conditional writes compare against the plaintext
+	setReply = &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-sealed", Value: secret, IfValue: secret}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != "" {
+		t.Errorf("Expected IfValue to match the plaintext, got %+v", setReply)
+	}
+
+	// The RESP server only holds ciphertext
+	conn, err := net.Dial("tcp", "localhost:6379")
+	if err != nil {
+		t.Fatalf("Failed to connect to RESP server: %v", err)
+	}
+	defer conn.Close()
+	stored, err := resp.NewCommand("GET", "test-sealed").ExecuteWithResponse(conn, nil)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	raw, _ := stored.([]byte)
+	if len(raw) == 0 || strings.Contains(string(raw), string(secret)) {
+		t.Fatalf("Expected a sealed value in the RESP server, got %q", raw)
+	}
+
+	// A value moved to another key does not open
+	if _, err := resp.NewCommand("SET", "test-sealed-moved", string(raw)).ExecuteWithResponse(conn, nil); err != nil {
+		t.Fatalf("SET failed: %v", err)
+	}
+	getReply = &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-sealed-moved"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if !strings.Contains(getReply.Error, crypto.ErrOpen.Error()) {
+		t.Errorf("Expected authentication failure, got %+v", getReply)
+	}
+
+	// A plaintext value planted in the RESP server is rejected
+	if _, err := resp.NewCommand("SET", "test-sealed-planted", "forged").ExecuteWithResponse(conn, nil); err != nil {
+		t.Fatalf("SET failed: %v", err)
+	}
+	getReply = &storage.GetReply{}
+	if err := client.Call("Store.Get", &storage.GetArgs{Key: "test-sealed-planted"}, getReply); err != nil {
+		t.Fatalf("Get RPC call failed: %v", err)
+	}
+	if !strings.Contains(getReply.Error, crypto.ErrUnsealed.Error()) {
+		t.Errorf("Expected unsealed value to be rejected, got %+v", getReply)
+	}
+}
+
+func TestServerEncryptionCoverage(t *testing.T) {
+	_, client := startTestServerWithConfig(t, config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 10,
+		EncryptValues:  true,
+		Namespaces: []config.NamespaceConfig{
+			{Name: "test-enc", History: 2},
+		},
+	})
+
+	call := func(method string, args, reply interface{}) string {
+		t.Helper()
+		if err := client.Call(method, args, reply); err != nil {
+			t.Fatalf("%s RPC call failed: %v", method, err)
+		}
+		return reflect.ValueOf(reply).Elem().FieldByName("Error").String()
+	}
+	mustCall := func(method string, args, reply interface{}) {
+		t.Helper()
+		if msg := call(method, args, reply); msg != "" {
+			t.Fatalf("%s failed: %s", method, msg)
+		}
+	}
+
+	// Values, kept versions, batched and transactional writes, and staged
+	// and committed stream chunks are all sealed
+	marker := []byte("test-enc-plaintext-marker")
+	for i := 0; i < 3; i++ {
+		mustCall("Store.Set", &storage.SetArgs{Namespace: "test-enc", Key: "kept", Value: marker}, &storage.SetReply{})
+	}
+	mustCall("Store.MSet", &storage.MSetArgs{Entries: []storage.SetArgs{{Key: "test-enc-mset", Value: marker}}}, &storage.MSetReply{})
+	txnArgs := &storage.TxnArgs{Ops: []storage.TxnOpArgs{{Type: storage.TxnSet, Key: "test-enc-txn", Value: marker}}}
+	mustCall("Store.Txn", txnArgs, &storage.TxnReply{})
+	for _, uploadID := range []string{"aa", "bb"} {
+		chunkArgs := &storage.StreamChunkArgs{Key: "test-enc-stream", UploadID: uploadID, Data: marker}
+		mustCall("Store.StreamChunk", chunkArgs, &storage.StreamChunkReply{})
+	}
+	sum := sha256.Sum256(marker)
+	commitArgs := &storage.StreamCommitArgs{
+		Key:      "test-enc-stream",
+		UploadID: "aa",
+		Chunks:   1,
+		Size:     int64(len(marker)),
+		Checksum: hex.EncodeToString(sum[:]),
+	}
+	mustCall("Store.StreamCommit", commitArgs, &storage.SetReply{})
+
+	// and so are lock owners, which still renew and release
+	lockReply := &storage.LockReply{}
+	mustCall("Store.Lock", &storage.LockArgs{Key: "test-enc-lock", Lease: 5000}, lockReply)
+	mustCall("Store.Renew", &storage.RenewArgs{Key: "test-enc-lock", Owner: lockReply.Owner, Lease: 5000}, &storage.RenewReply{})
+
+	// Data types the RESP server operates on cannot be sealed, so writes to them are refused
+	ttl := 60
+	refused := []struct {
+		method string
+		args   interface{}
+		reply  interface{}
+	}{
+		{"Store.HSet", &storage.HSetArgs{Key: "test-enc-hash", Fields: map[string][]byte{"f": marker}}, &storage.HSetReply{}},
+		{"Store.HIncrBy", &storage.HIncrByArgs{Key: "test-enc-hash", Field: "n", Delta: 1}, &storage.IncrByReply{}},
+		{"Store.Push", &storage.PushArgs{Key: "test-enc-queue", Values: [][]byte{marker}}, &storage.PushReply{}},
+		{"Store.SAdd", &storage.SAddArgs{Key: "test-enc-set", Members: [][]byte{marker}}, &storage.SAddReply{}},
+		{"Store.ZAdd", &storage.ZAddArgs{Key: "test-enc-zset", Members: []storage.ScoredMember{{Member: marker, Score: 1}}}, &storage.ZAddReply{}},
+		{"Store.ZIncrBy", &storage.ZIncrByArgs{Key: "test-enc-zset", Member: marker, Delta: 1}, &storage.ZIncrByReply{}},
+		{"Store.IncrBy", &storage.IncrByArgs{Key: "test-enc-counter", Delta: 1, TTL: &ttl}, &storage.IncrByReply{}},
+		{"Store.Txn", &storage.TxnArgs{Ops: []storage.TxnOpArgs{{Type: storage.TxnIncrBy, Key: "test-enc-counter", Delta: 1}}}, &storage.TxnReply{}},
+	}
+	for _, r := range refused {
+		if msg := call(r.method, r.args, r.reply); msg != storage.ErrNotSealable.Error() {
+			t.Errorf("Expected %s to be refused with sealing on, got %q", r.method, msg)
+		}
+	}
+
+	// Read back everything the RESP server holds for these keys, bookkeeping
+	// keys included
+	conn, err := net.Dial("tcp", "localhost:6379")
+	if err != nil {
+		t.Fatalf("Failed to connect to RESP server: %v", err)
+	}
+	defer conn.Close()
+	reader := resp.NewReader(conn)
+	command := func(args ...string) interface{} {
+		t.Helper()
+		res, err := resp.NewCommand(args...).ExecuteWithResponse(conn, reader)
+		if err != nil {
+			t.Fatalf("%s failed: %v", args[0], err)
+		}
+		return res
+	}
+	var flatten func(res interface{}) []string
+	flatten = func(res interface{}) []string {
+		switch v := res.(type) {
+		case []byte:
+			return []string{string(v)}
+		case []interface{}:
+			var out []string
+			for _, elem := range v {
+				out = append(out, flatten(elem)...)
+			}
+			return out
+		}
+		return nil
+	}
+
+	stored := make(map[string][]string)
+	for cursor := "0"; ; {
+		page := flatten(command("SCAN", cursor, "MATCH", "*test-enc*", "COUNT", "1000"))
+		for _, key := range page[1:] {
+			switch command("TYPE", key) {
+			case "string":
+				stored[key] = flatten(command("GET", key))
+			case "hash":
+				stored[key] = flatten(command("HGETALL", key))
+			default:
+				t.Errorf("Unexpected %v at %s", command("TYPE", key), key)
+			}
+		}
+		if cursor = page[0]; cursor == "0" {
+			break
+		}
+	}
+	for _, want := range []string{"test-enc:kept", "__tritium:hist:test-enc:kept", "test-enc-mset", "test-enc-txn",
+		"__tritium:chunk:test-enc-stream:aa:0", "__tritium:chunk:test-enc-stream:bb:0", "__tritium:lock:test-enc-lock"} {
+		if _, ok := stored[want]; !ok {
+			t.Errorf("Expected %s in the RESP server", want)
+		}
+	}
+	for key, values := range stored {
+		for _, v := range values {
+			if strings.Contains(v, string(marker)) || strings.Contains(v, lockReply.Owner) {
+				t.Errorf("Found plaintext in %s: %q", key, v)
+			}
+		}
+	}
+
+	mustCall("Store.Unlock", &storage.UnlockArgs{Key: "test-enc-lock", Owner: lockReply.Owner}, &storage.UnlockReply{})
+	client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{"test-enc-mset", "test-enc-txn", "test-enc-stream"}}, &storage.DeleteReply{})
+	client.Call("Store.Delete", &storage.DeleteArgs{Namespace: "test-enc", Keys: []string{"kept"}}, &storage.DeleteReply{})
+}
+
+// testProxy forwards connections to a RESP server and can cut them, standing
+// in for a server restart
+type testProxy struct {
+	ln     net.Listener
+	target string
+	mu     sync.Mutex
+	conns  []net.Conn
+}
+
+func startTestProxy(t *testing.T, addr, target string) *testProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to start proxy: %v", err)
+	}
+	p := &testProxy{ln: ln, target: target}
+	go func() {
+		for {
+			client, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				client.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, client, upstream)
+			p.mu.Unlock()
+			go io.Copy(upstream, client)
+			go io.Copy(client, upstream)
+		}
+	}()
+	t.Cleanup(p.stop)
+	return p
+}
+
+// drop closes every proxied connection
+func (p *testProxy) drop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// stop closes the listener and every proxied connection
+func (p *testProxy) stop() {
+	p.ln.Close()
+	p.drop()
+}
+
+func TestServerPoolRecovery(t *testing.T) {
+	proxy := startTestProxy(t, "127.0.0.1:0", "localhost:6379")
+	addr := proxy.ln.Addr().String()
+	srv, client := startTestServerWithConfig(t, config.Config{MemStoreAddr: addr, MaxConnections: 4})
+
+	set := func() string {
+		t.Helper()
+		reply := &storage.SetReply{}
+		if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-pool", Value: []byte("v")}, reply); err != nil {
+			t.Fatalf("Set RPC call failed: %v", err)
+		}
+		return reply.Error
+	}
+
+	if errMsg := set(); errMsg != "" {
+		t.Fatalf("Unexpected Set error: %s", errMsg)
+	}
+	if pools := srv.Stats().Pools; len(pools) != 1 || pools[0].MaxConns != 4 || pools[0].InUse != 0 {
+		t.Fatalf("Unexpected pool stats %+v", pools)
+	}
+
+	// A restart costs at most the call that found the connection dead
+	proxy.drop()
+	if set() != "" {
+		if errMsg := set(); errMsg != "" {
+			t.Fatalf("Expected the pool to reconnect, got %s", errMsg)
+		}
+	}
+
+	// While the server is down calls fail within the acquisition deadline
+	proxy.stop()
+	start := time.Now()
+	if errMsg := set(); errMsg == "" {
+		t.Fatalf("Expected Set to fail with the server down")
+	}
+	if elapsed := time.Since(start); elapsed > 8*time.Second {
+		t.Errorf("Set took %v to fail", elapsed)
+	}
+	if pools := srv.Stats().Pools; pools[0].DialFailures == 0 {
+		t.Errorf("Expected dial failures to be counted, got %+v", pools)
+	}
+
+	// and succeed again once it is back
+	startTestProxy(t, addr, "localhost:6379")
+	deadline := time.Now().Add(10 * time.Second)
+	for errMsg := set(); errMsg != ""; errMsg = set() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Pool did not recover: %s", errMsg)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestServerPipelining(t *testing.T) {
+	_, client := startTestServerWithConfig(t, config.Config{
+		MemStoreAddr:   "localhost:6379",
+		MaxConnections: 2,
+		PipelineConns:  2,
+	})
+
+	// Far more concurrent callers than connections, each checking its own replies
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("test-pipe-%d", i)
+			value := []byte(strings.Repeat(strconv.Itoa(i), i+1))
+
+			client.Call("Store.Delete", &storage.DeleteArgs{Keys: []string{key}}, &storage.DeleteReply{})
+			var last int64
+			for round := 1; round <= 5; round++ {
+				setReply := &storage.SetReply{}
+				if err := client.Call("Store.Set", &storage.SetArgs{Key: key, Value: value}, setReply); err != nil || setReply.Error != "" {
+					errs <- fmt.Errorf("set %s: %v %s", key, err, setReply.Error)
+					return
+				}
+				getReply := &storage.GetReply{}
+				if err := client.Call("Store.Get", &storage.GetArgs{Key: key}, getReply); err != nil || getReply.Error != "" {
+					errs <- fmt.Errorf("get %s: %v %s", key, err, getReply.Error)
+					return
+				}
+				// Versions continue from before the delete, then count up
+				if round > 1 && setReply.Version != last+1 {
+					errs <- fmt.Errorf("%s: expected version %d, got %d", key, last+1, setReply.Version)
+					return
+				}
+				last = setReply.Version
+				if string(getReply.Value) != string(value) || getReply.Version != last {
+					errs <- fmt.Errorf("%s: expected %q at version %d, got %q at %d", key, value, last, getReply.Value, getReply.Version)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Conditional writes still run under WATCH on pooled connections
+	stale := int64(-1)
+	setReply := &storage.SetReply{}
+	if err := client.Call("Store.Set", &storage.SetArgs{Key: "test-pipe-0", Value: []byte("x"), IfVersion: &stale}, setReply); err != nil {
+		t.Fatalf("Set RPC call failed: %v", err)
+	}
+	if setReply.Error != storage.ErrConditionFailed.Error() {
+		t.Errorf("Expected condition failure, got %+v", setReply)
+	}
+}
+
+func TestWipeReply(t *testing.T) {
+	value := func() []byte { return []byte("secret") }
+	replies := []interface{}{
+		&storage.HGetReply{Value: value()},
+		&storage.HGetAllReply{Fields: map[string][]byte{"f": value()}},
+		&storage.PopReply{Value: value()},
+		&storage.LRangeReply{Values: [][]byte{value()}},
+		&storage.SMembersReply{Members: [][]byte{value()}},
+		&storage.ZRangeReply{Members: []storage.ScoredMember{{Member: value()}}},
+		&storage.StreamReadReply{Data: value()},
+	}
+	for _, reply := range replies {
+		wipeReply(reply)
+		if s := fmt.Sprintf("%s", reply); strings.Contains(s, "secret") {
+			t.Errorf("%T not wiped: %s", reply, s)
+		}
+	}
+}
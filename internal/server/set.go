@@ -0,0 +1,355 @@
+package server
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// SAdd handles the SAdd RPC call
+func (s *Server) SAdd(args *storage.SAddArgs, reply *storage.SAddReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || len(args.Members) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Use the namespace or server default TTL if none provided
+	ttl, err := ns.resolveTTL(args.TTL, DefaultTTL)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	members, size := stringValues(args.Members)
+	sizes := make(map[string]int64, len(members))
+	for _, member := range members {
+		sizes[member] = int64(len(member))
+	}
+	undo, err := ns.reserveMembers(key, sizes, ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	added, err := sets.SAdd(key, members, ttl)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Added = int(added)
+	atomic.AddInt64(&s.stats.BytesTransferred, size)
+	s.notify(storage.EventSet, key)
+	return nil
+}
+
+// SRem handles the SRem RPC call
+func (s *Server) SRem(args *storage.SRemArgs, reply *storage.SRemReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || len(args.Members) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	members, _ := stringValues(args.Members)
+	removed, err := sets.SRem(key, members...)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Removed = int(removed)
+	if removed > 0 {
+		ns.releaseMembers(key, members...)
+		s.notify(storage.EventSet, key)
+	}
+	return nil
+}
+
+// SMembers handles the SMembers RPC call
+func (s *Server) SMembers(args *storage.SMembersArgs, reply *storage.SMembersReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	members, err := sets.SMembers(key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Members = members
+	for _, m := range members {
+		atomic.AddInt64(&s.stats.BytesTransferred, int64(len(m)))
+	}
+	return nil
+}
+
+// SIsMember handles the SIsMember RPC call
+func (s *Server) SIsMember(args *storage.SIsMemberArgs, reply *storage.SIsMemberReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	isMember, err := sets.SIsMember(key, string(args.Member))
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.IsMember = isMember
+	return nil
+}
+
+// ZAdd handles the ZAdd RPC call
+func (s *Server) ZAdd(args *storage.ZAddArgs, reply *storage.ZAddReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || len(args.Members) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+	for _, m := range args.Members {
+		if math.IsNaN(m.Score) {
+			reply.Error = "invalid arguments"
+			return nil
+		}
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Use the namespace or server default TTL if none provided
+	ttl, err := ns.resolveTTL(args.TTL, DefaultTTL)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	size := int64(0)
+	sizes := make(map[string]int64, len(args.Members))
+	for _, m := range args.Members {
+		sizes[string(m.Member)] = int64(len(m.Member)) + counterSize
+		size += int64(len(m.Member)) + counterSize
+	}
+	undo, err := ns.reserveMembers(key, sizes, ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	added, err := sets.ZAdd(key, args.Members, ttl)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Added = int(added)
+	atomic.AddInt64(&s.stats.BytesTransferred, size)
+	s.notify(storage.EventSet, key)
+	return nil
+}
+
+// ZRem handles the ZRem RPC call
+func (s *Server) ZRem(args *storage.ZRemArgs, reply *storage.ZRemReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || len(args.Members) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	members, _ := stringValues(args.Members)
+	removed, err := sets.ZRem(key, members...)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Removed = int(removed)
+	if removed > 0 {
+		ns.releaseMembers(key, members...)
+		s.notify(storage.EventSet, key)
+	}
+	return nil
+}
+
+// ZIncrBy handles the ZIncrBy RPC call
+func (s *Server) ZIncrBy(args *storage.ZIncrByArgs, reply *storage.ZIncrByReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || math.IsNaN(args.Delta) || (args.TTL != nil && *args.TTL <= 0) {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Sorted sets created by an increment without an explicit or namespace TTL never expire
+	ttl, err := ns.resolveTTL(args.TTL, 0)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Only a new member is charged; changing the score of an existing one is free
+	member := string(args.Member)
+	undo, err := ns.reserveMembers(key, map[string]int64{member: int64(len(member)) + counterSize}, ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	score, err := sets.ZIncrBy(key, member, args.Delta, ttl)
+	if err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Score = score
+	s.notify(storage.EventSet, key)
+	return nil
+}
+
+// ZRange handles the ZRange RPC call
+func (s *Server) ZRange(args *storage.ZRangeArgs, reply *storage.ZRangeReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	members, err := sets.ZRange(key, args.Start, args.Stop, args.Reverse)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	s.setScoredMembers(reply, members)
+	return nil
+}
+
+// ZRangeByScore handles the ZRangeByScore RPC call
+func (s *Server) ZRangeByScore(args *storage.ZRangeByScoreArgs, reply *storage.ZRangeReply) error {
+	sets, ok := s.store.(storage.SetBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || math.IsNaN(args.Min) || math.IsNaN(args.Max) || args.Offset < 0 || args.Count < 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	members, err := sets.ZRangeByScore(key, args.Min, args.Max, args.Offset, args.Count)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	s.setScoredMembers(reply, members)
+	return nil
+}
+
+func (s *Server) setScoredMembers(reply *storage.ZRangeReply, members []storage.ScoredMember) {
+	reply.Members = members
+	for _, m := range members {
+		atomic.AddInt64(&s.stats.BytesTransferred, int64(len(m.Member)))
+	}
+}
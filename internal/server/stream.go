@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/hex"
+	"sync/atomic"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// maxChunkSize bounds a single streamed chunk so no RPC buffers more than this
+const maxChunkSize = 8 << 20
+
+// validUploadID reports whether id is a hex upload ID, so it cannot alter the
+// shape of the chunk keys built from it
+func validUploadID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return id != "" && len(id) <= 64 && err == nil
+}
+
+// StreamChunk handles the StreamChunk RPC call, staging one chunk of an upload
+func (s *Server) StreamChunk(args *storage.StreamChunkArgs, reply *storage.StreamChunkReply) error {
+	streams, ok := s.store.(storage.StreamBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || !validUploadID(args.UploadID) || args.Index < 0 || args.Index >= storage.MaxStreamChunks ||
+		len(args.Data) == 0 || len(args.Data) > maxChunkSize {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	ttl, err := ns.resolveTTL(args.TTL, DefaultTTL)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// Staged chunks count against the byte quota until they are committed
+	up := upload{key: key, id: args.UploadID}
+	undo, err := ns.stage(up, args.Index, int64(len(args.Data)), ttl)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	if err := streams.PutChunk(key, args.UploadID, args.Index, string(args.Data), ttl); err != nil {
+		undo()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	atomic.AddInt64(&s.stats.BytesTransferred, int64(len(args.Data)))
+	return nil
+}
+
+// StreamCommit handles the StreamCommit RPC call, making a fully staged upload
+// the value of its key
+func (s *Server) StreamCommit(args *storage.StreamCommitArgs, reply *storage.SetReply) error {
+	streams, ok := s.store.(storage.StreamBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	// A chunk holds at least one byte, so there are never more chunks than bytes
+	if args == nil || !validUploadID(args.UploadID) || args.Chunks <= 0 || args.Chunks > storage.MaxStreamChunks ||
+		args.Size <= 0 || int64(args.Chunks) > args.Size {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+	if checksum, err := hex.DecodeString(args.Checksum); err != nil || len(checksum) != 32 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	ttl, err := ns.resolveTTL(args.TTL, DefaultTTL)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	// The committed value takes over the charge for its staged chunks
+	restage := ns.unstage(upload{key: key, id: args.UploadID})
+	undo, err := ns.reserve(key, args.Size, ttl)
+	if err != nil {
+		restage()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	manifest := storage.Manifest{
+		UploadID: args.UploadID,
+		Chunks:   args.Chunks,
+		Size:     args.Size,
+		Checksum: args.Checksum,
+	}
+	version, err := streams.CommitStream(key, manifest, ttl)
+	if err != nil {
+		undo()
+		restage()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Version = version
+	s.notify(storage.EventSet, key)
+	return nil
+}
+
+// StreamOpen handles the StreamOpen RPC call, returning the manifest of a
+// streamed value
+func (s *Server) StreamOpen(args *storage.GetArgs, reply *storage.StreamOpenReply) error {
+	streams, ok := s.store.(storage.StreamBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	manifest, version, err := streams.GetManifest(key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if manifest == nil {
+		reply.Error = "key not found"
+		return nil
+	}
+
+	reply.UploadID = manifest.UploadID
+	reply.Chunks = manifest.Chunks
+	reply.Size = manifest.Size
+	reply.Checksum = manifest.Checksum
+	reply.Version = version
+	return nil
+}
+
+// StreamRead handles the StreamRead RPC call, returning one chunk of a
+// streamed value
+func (s *Server) StreamRead(args *storage.StreamReadArgs, reply *storage.StreamReadReply) error {
+	streams, ok := s.store.(storage.StreamBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || !validUploadID(args.UploadID) || args.Index < 0 || args.Index >= storage.MaxStreamChunks {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, _, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	data, err := streams.GetChunk(key, args.UploadID, args.Index)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+	if data == nil {
+		reply.Error = "chunk not found"
+		return nil
+	}
+
+	reply.Data = data
+	atomic.AddInt64(&s.stats.BytesTransferred, int64(len(data)))
+	return nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// Txn handles the Txn RPC call, applying every op or none of them
+func (s *Server) Txn(args *storage.TxnArgs, reply *storage.TxnReply) error {
+	txns, ok := s.store.(storage.TxnBackend)
+	if !ok {
+		reply.Error = storage.ErrUnsupported.Error()
+		return nil
+	}
+
+	if args == nil || len(args.Ops) == 0 {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	_, ns, err := s.resolveKey(args.Namespace, "")
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	watches := make([]storage.TxnWatch, len(args.Watch))
+	for i, w := range args.Watch {
+		key, _, err := s.resolveKey(args.Namespace, w.Key)
+		if err != nil {
+			reply.Error = err.Error()
+			return nil
+		}
+		watches[i] = storage.TxnWatch{Key: key, Version: w.Version}
+	}
+
+	ops := make([]storage.TxnOp, len(args.Ops))
+	undos := make([]func(), 0, len(args.Ops))
+	undoAll := func() {
+		// Reservations for the same key stack, so undo them newest first
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+
+	last := make(map[string]int, len(args.Ops)) // index of the last op on each key
+	for i, op := range args.Ops {
+		key, _, err := s.resolveKey(args.Namespace, op.Key)
+		if err != nil {
+			undoAll()
+			reply.Error = err.Error()
+			return nil
+		}
+		last[key] = i
+		ops[i] = storage.TxnOp{Type: op.Type, Key: key, Value: string(op.Value), Delta: op.Delta}
+
+		var size int64
+		switch op.Type {
+		case storage.TxnSet:
+			ops[i].TTL, err = ns.resolveTTL(op.TTL, DefaultTTL)
+			size = int64(len(op.Value))
+		case storage.TxnIncrBy:
+			// Counters without an explicit or namespace TTL never expire
+			ops[i].TTL, err = ns.resolveTTL(op.TTL, 0)
+			size = counterSize
+		case storage.TxnDelete:
+			continue
+		default:
+			undoAll()
+			reply.Error = "invalid arguments"
+			return nil
+		}
+		if err != nil {
+			undoAll()
+			reply.Error = err.Error()
+			return nil
+		}
+
+		// A failing command would leave the block half applied, so reject
+		// anything the backend would refuse before it is queued
+		if (op.TTL != nil && *op.TTL <= 0) || (op.Type == storage.TxnSet && ops[i].TTL <= 0) {
+			undoAll()
+			reply.Error = "invalid arguments"
+			return nil
+		}
+
+		undo, err := ns.reserve(key, size, ops[i].TTL)
+		if err != nil {
+			undoAll()
+			reply.Error = err.Error()
+			return nil
+		}
+		undos = append(undos, undo)
+	}
+
+	results, err := txns.Txn(watches, ops)
+	if err == storage.ErrTxnAborted {
+		undoAll()
+		return nil
+	}
+	if err != nil {
+		undoAll()
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.Committed = true
+	reply.Results = make([]storage.TxnOpReply, len(results))
+	var written, deleted []string
+	for i, r := range results {
+		reply.Results[i] = storage.TxnOpReply{Version: r.Version, Value: r.Value, Deleted: r.Deleted}
+		if r.Err != nil {
+			reply.Results[i].Error = r.Err.Error()
+			continue
+		}
+
+		switch ops[i].Type {
+		case storage.TxnSet:
+			written = append(written, ops[i].Key)
+			atomic.AddInt64(&s.stats.BytesTransferred, int64(len(args.Ops[i].Value)))
+		case storage.TxnIncrBy:
+			written = append(written, ops[i].Key)
+		case storage.TxnDelete:
+			if r.Deleted {
+				deleted = append(deleted, ops[i].Key)
+			}
+			if last[ops[i].Key] == i {
+				ns.release(ops[i].Key)
+			}
+		}
+	}
+
+	s.notify(storage.EventSet, written...)
+	s.notify(storage.EventDelete, deleted...)
+	return nil
+}
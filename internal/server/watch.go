@@ -0,0 +1,212 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+const (
+	// eventChannelPrefix is prepended to a key to form the channel its change
+	// events are published on. Events are published through the store, which
+	// forwards them to the backends of the other cluster nodes.
+	eventChannelPrefix = "__tritium:events:"
+	// expiredPattern matches the backend's keyevent channel for expired keys
+	expiredPattern = "__keyevent@*__:expired"
+
+	// notifyQueue bounds the change events waiting to be published; events
+	// beyond it are dropped rather than slowing down writes
+	notifyQueue = 4096
+	// notifyBatch bounds the events sent in one PublishBatch
+	notifyBatch = 256
+)
+
+// notify queues a change event for each key, to be published to watchers on
+// every node. Publishing is best effort: it never delays or fails the write
+// that triggered it.
+func (s *Server) notify(event string, keys ...string) {
+	if s.notifier == nil {
+		return
+	}
+	for _, key := range keys {
+		s.notifier.queue(storage.Message{Channel: eventChannelPrefix + key, Payload: []byte(event)})
+	}
+}
+
+// notifier publishes change events from a single goroutine, batching the
+// events queued while the previous batch was published. Events are published
+// through the store, which forwards them to the backends of the other cluster
+// nodes, so they are published whether or not this node has watchers.
+type notifier struct {
+	store   storage.PubSubBackend
+	events  chan storage.Message
+	stopCh  <-chan struct{}
+	done    chan struct{}
+	dropped atomic.Int64 // events discarded because the queue was full
+}
+
+// newNotifier starts publishing events to store until stopCh is closed, or
+// returns nil if the store has no pub/sub
+func newNotifier(store storage.PubSubBackend, stopCh <-chan struct{}) *notifier {
+	if store == nil {
+		return nil
+	}
+	n := &notifier{
+		store:  store,
+		events: make(chan storage.Message, notifyQueue),
+		stopCh: stopCh,
+		done:   make(chan struct{}),
+	}
+	go n.publishLoop()
+	return n
+}
+
+// queue adds an event without blocking, dropping it if the queue is full
+func (n *notifier) queue(msg storage.Message) {
+	select {
+	case n.events <- msg:
+	default:
+		n.dropped.Add(1)
+	}
+}
+
+func (n *notifier) publishLoop() {
+	defer close(n.done)
+
+	batch := make([]storage.Message, 0, notifyBatch)
+	for {
+		select {
+		case msg := <-n.events:
+			n.publish(append(batch[:0], msg))
+		case <-n.stopCh:
+			// Publish what was queued before the server stopped
+			n.publish(batch[:0])
+			return
+		}
+	}
+}
+
+// publish sends batch along with the events queued behind it, up to a full batch
+func (n *notifier) publish(batch []storage.Message) {
+collect:
+	for len(batch) < notifyBatch {
+		select {
+		case msg := <-n.events:
+			batch = append(batch, msg)
+		default:
+			break collect
+		}
+	}
+	if len(batch) > 0 {
+		if err := n.store.PublishBatch(batch); err != nil {
+			fmt.Printf("[warning] failed to publish %d change events: %v\n", len(batch), err)
+		}
+	}
+	if dropped := n.dropped.Swap(0); dropped > 0 {
+		fmt.Printf("[warning] dropped %d change events; the publish queue was full\n", dropped)
+	}
+}
+
+// wait blocks until the events queued before the server stopped are published
+func (n *notifier) wait() {
+	if n != nil {
+		<-n.done
+	}
+}
+
+// isInternalChannel reports whether channel carries Tritium's own events
+func isInternalChannel(channel string) bool {
+	return strings.HasPrefix(channel, eventChannelPrefix) || strings.HasPrefix(channel, "__keyevent@")
+}
+
+// escapePattern escapes the glob characters in s so it matches literally
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// watchFilter turns event and expiry notifications into watch messages whose
+// channel is the changed key and payload the event type
+func watchFilter(key string, prefix bool) messageFilter {
+	matches := func(k string) bool {
+		if prefix {
+			return strings.HasPrefix(k, key)
+		}
+		return k == key
+	}
+
+	return func(msg storage.Message) (storage.Message, bool) {
+		changed, event := strings.TrimPrefix(msg.Channel, eventChannelPrefix), string(msg.Payload)
+		if msg.Pattern == expiredPattern {
+			changed, event = string(msg.Payload), storage.EventExpire
+		}
+
+		// Bookkeeping keys expire alongside the keys they describe
+		if !matches(changed) || storage.IsMetaKey(changed) {
+			return msg, false
+		}
+		return storage.Message{Pattern: key, Channel: changed, Payload: []byte(event)}, true
+	}
+}
+
+// enableExpiryEvents turns on the backend's expiry notifications the first
+// time a key is watched. Without them watchers only see sets and deletes.
+func (s *Server) enableExpiryEvents() {
+	s.expiryEvents.Do(func() {
+		store, ok := s.store.(storage.PubSubBackend)
+		if !ok {
+			return
+		}
+		if err := store.EnableExpiryEvents(); err != nil {
+			fmt.Printf("[warning] expire events unavailable: %v\n", err)
+		}
+	})
+}
+
+// Watch handles the Watch RPC call, registering a subscription that receives
+// set, delete, expire and TTL events for a key or key prefix. Events are collected
+// with Receive like any other subscription: each message's channel is the
+// changed key and its payload the event type.
+func (s *Server) Watch(args *storage.WatchArgs, reply *storage.SubscribeReply) error {
+	if args == nil || (args.Key == "" && !args.Prefix) {
+		reply.Error = "invalid arguments"
+		return nil
+	}
+
+	key, ns, err := s.resolveKey(args.Namespace, args.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	var prefix string
+	filter := s.defaultOnly(watchFilter(key, args.Prefix))
+	if ns != nil {
+		prefix, filter = ns.prefix(), watchFilter(key, args.Prefix)
+	}
+
+	pattern := eventChannelPrefix + escapePattern(key)
+	if args.Prefix {
+		pattern += "*"
+	}
+
+	s.enableExpiryEvents()
+
+	id, err := s.pubsub.subscribe(prefix, []string{pattern, expiredPattern}, filter)
+	if err != nil {
+		reply.Error = err.Error()
+		return nil
+	}
+
+	reply.SubscriptionID = id
+	return nil
+}
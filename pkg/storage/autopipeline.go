@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+const (
+	// maxPipelineBatch caps how many callers' commands go out in one write
+	maxPipelineBatch = 256
+	// maxPipelineInflight caps requests written but not yet answered on a
+	// shared connection
+	maxPipelineInflight = 4096
+)
+
+// pipeRequest is one caller's commands on a shared connection. read consumes
+// exactly the replies to cmds.
+type pipeRequest struct {
+	cmds [][]string
+	read func(*resp.Reader) (interface{}, error)
+	done chan pipeResult
+}
+
+type pipeResult struct {
+	value interface{}
+	err   error
+}
+
+func (r *pipeRequest) finish(value interface{}, err error) {
+	r.done <- pipeResult{value, err}
+}
+
+// autoPipeline multiplexes concurrent callers onto a few shared connections.
+// Each connection has a writer that coalesces whatever requests are waiting
+// into a single write and a reader that hands replies back in the order the
+// requests were written, so a caller only waits for its own replies rather
+// than holding a connection for a full round trip.
+//
+// Only self-contained requests can share a connection: a MULTI/EXEC block is
+// written without interruption, but WATCH needs a round trip on a connection
+// of its own and keeps using the pool.
+type autoPipeline struct {
+	pool      *connPool
+	reqs      chan *pipeRequest
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newAutoPipeline starts conns shared connections to the pool's server. They
+// are dialed when the first request arrives and redialed after failures.
+func newAutoPipeline(pool *connPool, conns int) *autoPipeline {
+	ap := &autoPipeline{
+		pool:   pool,
+		reqs:   make(chan *pipeRequest, maxPipelineBatch),
+		closed: make(chan struct{}),
+	}
+	for i := 0; i < conns; i++ {
+		go ap.run()
+	}
+	return ap
+}
+
+// send queues cmds and waits for read to consume their replies
+func (ap *autoPipeline) send(cmds [][]string, read func(*resp.Reader) (interface{}, error)) (interface{}, error) {
+	req := &pipeRequest{cmds: cmds, read: read, done: make(chan pipeResult, 1)}
+	select {
+	case ap.reqs <- req:
+	case <-ap.closed:
+		return nil, ErrPoolClosed
+	}
+	select {
+	case res := <-req.done:
+		return res.value, res.err
+	case <-ap.closed:
+		return nil, ErrPoolClosed
+	}
+}
+
+// run keeps one shared connection serving requests, redialing it when it breaks
+func (ap *autoPipeline) run() {
+	var batch []*pipeRequest
+	for {
+		if len(batch) == 0 {
+			select {
+			case req := <-ap.reqs:
+				batch = []*pipeRequest{req}
+			case <-ap.closed:
+				return
+			}
+		}
+
+		conn, err := ap.pool.redial(time.Now().Add(acquireTimeout))
+		if err != nil {
+			for _, req := range batch {
+				req.finish(nil, err)
+			}
+			batch = nil
+			continue
+		}
+		batch = ap.serve(conn, batch)
+		conn.Close()
+	}
+}
+
+// serve writes batches of requests to conn until it breaks or the pipeline
+// is closed. If another connection to the server broke since conn was
+// dialed, conn is likely dead too, so serve returns the batch it was about to
+// write for a fresh connection.
+func (ap *autoPipeline) serve(conn *poolConn, batch []*pipeRequest) []*pipeRequest {
+	dialed := time.Now().UnixNano()
+	inflight := make(chan *pipeRequest, maxPipelineInflight)
+	broken := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		ap.readReplies(conn, inflight, broken)
+	}()
+	defer func() {
+		close(inflight)
+		<-readerDone
+	}()
+
+	var cmds [][]string
+	for {
+		// Coalesce everything already waiting
+	gather:
+		for len(batch) < maxPipelineBatch {
+			select {
+			case req := <-ap.reqs:
+				batch = append(batch, req)
+			default:
+				break gather
+			}
+		}
+
+		if atomic.LoadInt64(&ap.pool.brokenAt) > dialed {
+			return batch
+		}
+
+		cmds = cmds[:0]
+		for _, req := range batch {
+			cmds = append(cmds, req.cmds...)
+			// Queued before writing so the reader always knows what comes next
+			inflight <- req
+		}
+		conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+		if _, err := conn.writePipeline(cmds...); err != nil {
+			// The reader fails the batch when its replies do not arrive
+			conn.Close()
+			return nil
+		}
+		batch = batch[:0]
+
+		select {
+		case req := <-ap.reqs:
+			batch = append(batch, req)
+		case <-broken:
+			return nil
+		case <-ap.closed:
+			conn.Close()
+			return nil
+		}
+	}
+}
+
+// readReplies hands each request its replies in the order requests were
+// written. Once the connection breaks, every request still queued fails.
+func (ap *autoPipeline) readReplies(conn *poolConn, inflight <-chan *pipeRequest, broken chan<- struct{}) {
+	reader := resp.NewReader(conn)
+	var lost error
+	for req := range inflight {
+		if lost != nil {
+			req.finish(nil, lost)
+			continue
+		}
+
+		conn.SetReadDeadline(time.Now().Add(ioTimeout))
+		value, err := req.read(reader)
+		if broke := conn.broken.Load(); broke || !inSync(err) {
+			// The stream is out of sync with the requests
+			lost = fmt.Errorf("connection to %s lost: %w", ap.pool.addr, err)
+			if broke {
+				atomic.StoreInt64(&ap.pool.brokenAt, time.Now().UnixNano())
+			}
+			conn.Close()
+			close(broken)
+			req.finish(nil, lost)
+			continue
+		}
+		req.finish(value, err)
+	}
+}
+
+// close stops the shared connections; waiting callers fail with ErrPoolClosed
+func (ap *autoPipeline) close() {
+	ap.closeOnce.Do(func() { close(ap.closed) })
+}
+
+// EnablePipelining makes self-contained commands share conns connections to
+// the primary instead of each holding a pooled connection for a round trip.
+// Throughput is then no longer bounded by pool size times latency. It must be
+// called before the server is used.
+func (rs *RespServer) EnablePipelining(conns int) {
+	if conns > 0 {
+		rs.autoPipeline = newAutoPipeline(rs.primaryPool, conns)
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+const benchAddr = "localhost:6379"
+
+// benchmarkSetGet runs SetEx followed by Get from many goroutines, with the
+// given number of shared connections or, if 0, on the connection pool
+func benchmarkSetGet(b *testing.B, pipelineConns int) {
+	rs, err := NewRespServer(benchAddr, 4, nil)
+	if err != nil {
+		b.Skipf("RESP server unavailable: %v", err)
+	}
+	defer rs.Close()
+	rs.EnablePipelining(pipelineConns)
+
+	var n int64
+	value := "benchmark-value"
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		key := fmt.Sprintf("bench-pipe-%d", atomic.AddInt64(&n, 1))
+		for pb.Next() {
+			if _, err := rs.SetEx(key, 60, value); err != nil {
+				b.Error(err)
+				return
+			}
+			if _, err := rs.Get(key); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkSetGetPool(b *testing.B) {
+	benchmarkSetGet(b, 0)
+}
+
+func BenchmarkSetGetPipelined(b *testing.B) {
+	benchmarkSetGet(b, 2)
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned for operations the configured backend does not
+// implement
+var ErrUnsupported = errors.New("not supported by this backend")
+
+// Backend is a storage engine the server keeps values in. Every backend
+// stores versioned values with a TTL and replicates writes to the replicas it
+// is given. Richer data types and coordination primitives are optional; see
+// the capability interfaces below.
+//
+// Values passed to a backend may live in secure memory that is wiped once the
+// call returns, so backends must copy any value they keep.
+type Backend interface {
+	// SetEx writes value with a TTL in seconds and returns its new version
+	SetEx(key string, ttl int, value string) (int64, error)
+	// SetExIf writes value if cond holds, returning ErrConditionFailed if not.
+	// A positive maxReads limits how often the value can be read.
+	SetExIf(key string, ttl int, value string, cond Condition, maxReads int) (int64, error)
+	// MSetEx writes several values, reporting the outcome of each
+	MSetEx(entries []Entry) ([]WriteResult, error)
+	// Get reads a value and its version; a missing key has a nil value
+	Get(key string) (Item, error)
+	// MGet reads several values in one call
+	MGet(keys ...string) ([]Item, error)
+	// IncrBy adds delta to the integer at key, creating it with ttl
+	IncrBy(key string, delta int64, ttl int) (int64, error)
+	// Delete removes keys and returns the ones that existed
+	Delete(keys ...string) ([]string, error)
+	// Scan iterates over keys matching pattern, starting at cursor
+	Scan(cursor uint64, pattern string, count int) (uint64, []string, error)
+
+	// TTL returns the seconds left, -1 for no expiry and -2 for missing keys
+	TTL(key string) (int64, error)
+	Expire(key string, ttl int) (bool, error)
+	ExpireAt(key string, unixTime int64) (bool, error)
+	Persist(key string) (bool, error)
+
+	// AddReplica starts replicating writes to the node at addr
+	AddReplica(addr string, maxConn int) error
+	// RemoveReplica stops replicating writes to the node at addr
+	RemoveReplica(addr string) error
+	GetMaxConnections() int
+
+	Close() error
+}
+
+// HashBackend is implemented by backends that store hashes
+type HashBackend interface {
+	HSet(key string, fields map[string]string, ttl int) (int64, error)
+	HGet(key, field string) (interface{}, error)
+	HGetAll(key string) (map[string][]byte, error)
+	HDel(key string, fields ...string) (int64, error)
+	HIncrBy(key, field string, delta int64, ttl int) (int64, error)
+}
+
+// ListBackend is implemented by backends that store lists and queues
+type ListBackend interface {
+	Push(key string, front bool, values []string, ttl int) (int64, error)
+	Pop(key string, back bool) ([]byte, error)
+	PopReliable(key string, back bool, visibility time.Duration) ([]byte, string, error)
+	Ack(key, receipt string) ([]byte, error)
+	RequeueExpired(key string) (int, error)
+	LRange(key string, start, stop int64) ([][]byte, error)
+	LLen(key string) (int64, error)
+}
+
+// SetBackend is implemented by backends that store sets and sorted sets
+type SetBackend interface {
+	SAdd(key string, members []string, ttl int) (int64, error)
+	SRem(key string, members ...string) (int64, error)
+	SMembers(key string) ([][]byte, error)
+	SIsMember(key, member string) (bool, error)
+	ZAdd(key string, members []ScoredMember, ttl int) (int64, error)
+	ZRem(key string, members ...string) (int64, error)
+	ZIncrBy(key, member string, delta float64, ttl int) (float64, error)
+	ZRange(key string, start, stop int64, reverse bool) ([]ScoredMember, error)
+	ZRangeByScore(key string, min, max float64, offset, count int) ([]ScoredMember, error)
+}
+
+// PubSubBackend is implemented by backends that deliver published messages
+type PubSubBackend interface {
+	Publish(channel, message string) (int64, error)
+	PublishBatch(msgs []Message) error
+	EnableExpiryEvents() error
+	NewSubscriber() (*Subscriber, error)
+}
+
+// TxnBackend is implemented by backends that run multi-key transactions
+type TxnBackend interface {
+	Txn(watches []TxnWatch, ops []TxnOp) ([]TxnResult, error)
+}
+
+// LockBackend is implemented by backends that provide distributed locks
+type LockBackend interface {
+	Lock(key string, lease time.Duration) (string, int64, error)
+	Renew(key, owner string, lease time.Duration) error
+	Unlock(key, owner string) error
+}
+
+// RateLimitBackend is implemented by backends that enforce rate limits
+type RateLimitBackend interface {
+	RateLimit(key string, limit int64, window time.Duration, cost int64) (RateLimitResult, error)
+}
+
+// StreamBackend is implemented by backends that store chunked values
+type StreamBackend interface {
+	PutChunk(key, uploadID string, index int, data string, ttl int) error
+	CommitStream(key string, m Manifest, ttl int) (int64, error)
+	GetManifest(key string) (*Manifest, int64, error)
+	GetChunk(key, uploadID string, index int) ([]byte, error)
+}
+
+// HistoryBackend is implemented by backends that keep past versions of keys
+type HistoryBackend interface {
+	SetExKeep(key string, ttl int, value string, cond Condition, keep int) (int64, error)
+	GetVersion(key string, version int64) (*HistoryEntry, error)
+	ListVersions(key string, keep int) ([]HistoryEntry, error)
+}
+
+// RespServer implements every capability
+var (
+	_ Backend          = (*RespServer)(nil)
+	_ HashBackend      = (*RespServer)(nil)
+	_ ListBackend      = (*RespServer)(nil)
+	_ SetBackend       = (*RespServer)(nil)
+	_ PubSubBackend    = (*RespServer)(nil)
+	_ TxnBackend       = (*RespServer)(nil)
+	_ LockBackend      = (*RespServer)(nil)
+	_ RateLimitBackend = (*RespServer)(nil)
+	_ StreamBackend    = (*RespServer)(nil)
+	_ HistoryBackend   = (*RespServer)(nil)
+	_ MemoryReporter   = (*RespServer)(nil)
+	_ PoolReporter     = (*RespServer)(nil)
+)
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrMemoryLimit is returned for writes that would exceed the node's memory
+// limit when nothing can be evicted to make room
+var ErrMemoryLimit = errors.New("memory limit reached, write rejected")
+
+// EvictionPolicy selects what is dropped when a write would exceed the
+// memory limit
+type EvictionPolicy string
+
+const (
+	EvictVolatileLRU EvictionPolicy = "volatile-lru"  // least recently used among keys with a TTL
+	EvictAllKeysLFU  EvictionPolicy = "allkeys-lfu"   // least frequently used among all keys
+	EvictTTLNearest  EvictionPolicy = "ttl-nearest"   // the key closest to expiring
+	EvictReject      EvictionPolicy = "reject-writes" // nothing; writes fail with ErrMemoryLimit
+)
+
+// ParseEvictionPolicy validates a policy name, defaulting to EvictReject
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch p := EvictionPolicy(name); p {
+	case "":
+		return EvictReject, nil
+	case EvictVolatileLRU, EvictAllKeysLFU, EvictTTLNearest, EvictReject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy %q", name)
+	}
+}
+
+// MemoryStats reports a backend's memory use against its limit
+type MemoryStats struct {
+	Limit   int64 // bytes; 0 if unlimited
+	Used    int64 // bytes
+	Evicted int64 // keys evicted since startup
+	Policy  EvictionPolicy
+}
+
+// MemoryReporter is implemented by backends that report their memory use
+type MemoryReporter interface {
+	MemoryStats() (MemoryStats, error)
+}
+
+// SetMemoryLimit configures the primary and every replica to hold at most
+// limit bytes, or any amount if limit is 0. The RESP server enforces the limit
+// itself, so it also covers keys written by other clients.
+//
+// Only EvictReject is supported. The RESP server evicts keys one at a time,
+// so any other policy could drop a value's version, read limit or lock fence
+// while keeping the value, and the value could come back at an old version or
+// with its read limit lifted.
+func (rs *RespServer) SetMemoryLimit(limit int64, policy EvictionPolicy) error {
+	if policy != EvictReject {
+		return fmt.Errorf("eviction policy %q on a RESP backend: %w", policy, ErrUnsupported)
+	}
+	cmds := memoryLimitCmds(limit)
+	for _, cmd := range cmds {
+		if _, err := rs.do(cmd...); err != nil {
+			return fmt.Errorf("failed to set memory limit: %w", err)
+		}
+	}
+	rs.replicate(cmds...)
+
+	rs.mu.Lock()
+	rs.memoryLimit, rs.evictionPolicy = limit, policy
+	rs.mu.Unlock()
+	return nil
+}
+
+// memoryLimitCmds returns the commands that make a RESP server reject writes
+// beyond limit bytes
+func memoryLimitCmds(limit int64) [][]string {
+	return [][]string{
+		{"CONFIG", "SET", "maxmemory", strconv.FormatInt(limit, 10)},
+		{"CONFIG", "SET", "maxmemory-policy", "noeviction"},
+	}
+}
+
+// MemoryStats reports the primary's memory use from INFO
+func (rs *RespServer) MemoryStats() (MemoryStats, error) {
+	res, err := rs.do("INFO")
+	if err != nil {
+		return MemoryStats{}, fmt.Errorf("failed to read server info: %w", err)
+	}
+
+	rs.mu.RLock()
+	stats := MemoryStats{Limit: rs.memoryLimit, Policy: rs.evictionPolicy}
+	rs.mu.RUnlock()
+
+	for _, line := range strings.Split(string(toBytes(res)), "\n") {
+		field, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch field {
+		case "used_memory":
+			stats.Used = n
+		case "evicted_keys":
+			stats.Evicted = n
+		}
+	}
+	return stats, nil
+}
+
+// memoryError maps a RESP server's out of memory error to ErrMemoryLimit
+func memoryError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "OOM ") {
+		return ErrMemoryLimit
+	}
+	return err
+}
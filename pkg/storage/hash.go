@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// HSet writes fields into the hash at key and, if ttl is positive, refreshes
+// the hash's TTL in the same transaction. It returns the number of new fields.
+func (rs *RespServer) HSet(key string, fields map[string]string, ttl int) (int64, error) {
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	if err := rs.checkSealable(); err != nil {
+		return 0, err
+	}
+
+	hset := make([]string, 0, 2*len(fields)+2)
+	hset = append(hset, "HSET", key)
+	for field, value := range fields {
+		hset = append(hset, field, value)
+	}
+	cmds := [][]string{hset}
+	if ttl > 0 {
+		cmds = append(cmds, []string{"EXPIRE", key, strconv.Itoa(ttl)})
+	}
+
+	results, err := rs.multi(cmds...)
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if err := firstError(results); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+
+	rs.replicate(wrapMulti(cmds)...)
+
+	added, _ := results[0].(int64)
+	return added, nil
+}
+
+// HGet reads a single field of the hash at key, nil if it does not exist
+func (rs *RespServer) HGet(key, field string) (interface{}, error) {
+	return rs.do("HGET", key, field)
+}
+
+// HGetAll reads every field of the hash at key
+func (rs *RespServer) HGetAll(key string) (map[string][]byte, error) {
+	res, err := rs.do("HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, ok := res.([]interface{})
+	if !ok || len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("unexpected HGETALL reply %T", res)
+	}
+
+	fields := make(map[string][]byte, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		fields[string(toBytes(pairs[i]))] = toBytes(pairs[i+1])
+	}
+	return fields, nil
+}
+
+// HDel removes fields from the hash at key on the primary and every replica,
+// returning how many fields the primary removed
+func (rs *RespServer) HDel(key string, fields ...string) (int64, error) {
+	if len(fields) == 0 {
+		return 0, nil
+	}
+
+	args := append([]string{"HDEL", key}, fields...)
+	deleted, err := rs.doInt(args...)
+	if err != nil {
+		return 0, fmt.Errorf("primary delete failed: %w", err)
+	}
+
+	if deleted > 0 {
+		rs.replicate(args)
+	}
+
+	return deleted, nil
+}
+
+// HIncrBy atomically adds delta to an integer field of the hash at key and
+// returns the new value. If ttl is positive the hash's TTL is refreshed.
+// Replicas receive the resulting value so they cannot drift, in the order the
+// primary applied the increments.
+func (rs *RespServer) HIncrBy(key, field string, delta int64, ttl int) (int64, error) {
+	if err := rs.checkSealable(); err != nil {
+		return 0, err
+	}
+
+	unlock := rs.lockReplication(key)
+	defer unlock()
+
+	cmds := [][]string{{"HINCRBY", key, field, strconv.FormatInt(delta, 10)}}
+	if ttl > 0 {
+		cmds = append(cmds, []string{"EXPIRE", key, strconv.Itoa(ttl)})
+	}
+
+	results, err := rs.multi(cmds...)
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if err := firstError(results); err != nil {
+		return 0, fmt.Errorf("primary increment failed: %w", err)
+	}
+
+	value, ok := results[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected HINCRBY reply %T", results[0])
+	}
+
+	replicaCmds := [][]string{{"HSET", key, field, strconv.FormatInt(value, 10)}}
+	replicaCmds = append(replicaCmds, cmds[1:]...)
+	rs.replicate(wrapMulti(replicaCmds)...)
+
+	return value, nil
+}
+
+// firstError returns the first error value among EXEC results
+func firstError(results []interface{}) error {
+	for _, res := range results {
+		if err, ok := res.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
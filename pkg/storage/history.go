@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// historyRetries bounds how often an unconditional SetExKeep retries after
+// losing a race with a concurrent writer on the same key
+const historyRetries = 16
+
+// ErrVersionNotFound is returned for versions that were never written, have
+// expired or were dropped from a key's history
+var ErrVersionNotFound = errors.New("version not found")
+
+// HistoryEntry is one kept version of a key
+type HistoryEntry struct {
+	Version   int64
+	Value     []byte // nil when listing versions
+	Timestamp time.Time
+	TTL       int // seconds left; -1 if the version never expires
+}
+
+// historyKey returns the hash holding the kept versions of key. Each version
+// has a field for its value and fields for when it was written and when it
+// expires, all in one key so the history is deleted and expired with the value.
+func historyKey(key string) string {
+	return metaPrefix + "hist:" + key
+}
+
+// historyFields returns the value, timestamp and expiry fields of version
+func historyFields(version int64) (value, ts, expires string) {
+	v := strconv.FormatInt(version, 10)
+	return v, v + ":ts", v + ":exp"
+}
+
+// SetExKeep is SetExIf for keys that keep their last keep versions. Each
+// version is stored in the key's history with the time it was written and
+// its own expiry, in the transaction that writes the value, and the version
+// falling out of the history is dropped. The history as a whole lives as long
+// as the value.
+func (rs *RespServer) SetExKeep(key string, ttl int, value string, cond Condition, keep int) (int64, error) {
+	// Kept versions are sealed like the value, under the same key
+	value, err := rs.seal(key, value)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < historyRetries; i++ {
+		version, err := rs.setExKeepOnce(key, ttl, value, cond, keep)
+		if err == ErrConditionFailed && cond.IsZero() {
+			// Unconditional writes only lost a race; try again
+			continue
+		}
+		return version, err
+	}
+	return 0, fmt.Errorf("write to %s too contended", key)
+}
+
+func (rs *RespServer) setExKeepOnce(key string, ttl int, value string, cond Condition, keep int) (version int64, err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	reader := resp.NewReader(conn)
+	watch := resp.NewPipeline(
+		[]string{"WATCH", key, versionKey(key)},
+		[]string{"MGET", key, versionKey(key)},
+	)
+	if _, err := watch.Execute(conn); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if !reader.IsOK() {
+		reader.ReadValue()
+		return 0, fmt.Errorf("primary watch not OK")
+	}
+	res, err := reader.ReadValue()
+	if err != nil {
+		return 0, unwatch(conn, reader, fmt.Errorf("primary read failed: %w", err))
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, unwatch(conn, reader, fmt.Errorf("unexpected MGET reply %T", res))
+	}
+
+	currentValue, err := rs.open(key, values[0])
+	if err != nil {
+		return 0, unwatch(conn, reader, err)
+	}
+	current := Item{Value: currentValue, Version: parseVersion(values[1])}
+	if !cond.holds(current) {
+		return 0, unwatch(conn, reader, ErrConditionFailed)
+	}
+
+	// The version key is watched, so INCR yields exactly this version
+	version = current.Version + 1
+	history := historyCmds(key, ttl, value, version, time.Now(), keep)
+	cmds := append(setExCmds(key, ttl, value), history...)
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if results == nil {
+		return 0, ErrConditionFailed
+	}
+	if _, err := versionResult(results); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+
+	replicaCmds := append(replicaSetExCmds(key, ttl, value, version), history...)
+	rs.replicate(wrapMulti(replicaCmds)...)
+
+	return version, nil
+}
+
+// historyCmds returns the commands that record version of key and drop the
+// version it pushes out of a history of keep versions
+func historyCmds(key string, ttl int, value string, version int64, at time.Time, keep int) [][]string {
+	hk := historyKey(key)
+	valueField, tsField, expField := historyFields(version)
+	expires := at.Add(time.Duration(ttl) * time.Second)
+	cmds := [][]string{
+		{"HSET", hk,
+			valueField, value,
+			tsField, strconv.FormatInt(at.UnixMilli(), 10),
+			expField, strconv.FormatInt(expires.UnixMilli(), 10)},
+		{"EXPIRE", hk, strconv.Itoa(ttl)},
+	}
+	if dropped := version - int64(keep); dropped > 0 {
+		valueField, tsField, expField := historyFields(dropped)
+		cmds = append(cmds, []string{"HDEL", hk, valueField, tsField, expField})
+	}
+	return cmds
+}
+
+// GetVersion reads a kept version of key
+func (rs *RespServer) GetVersion(key string, version int64) (*HistoryEntry, error) {
+	hk := historyKey(key)
+	valueField, tsField, expField := historyFields(version)
+	results, err := rs.multi(
+		[]string{"GET", versionKey(key)},
+		[]string{"HMGET", hk, valueField, tsField, expField},
+		[]string{"PTTL", hk},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("primary read failed: %w", err)
+	}
+	if err := firstError(results); err != nil {
+		return nil, fmt.Errorf("primary read failed: %w", err)
+	}
+
+	if version < 1 || version > parseVersion(results[0]) {
+		return nil, ErrVersionNotFound
+	}
+	fields, _ := results[1].([]interface{})
+	if len(fields) != 3 || toBytes(fields[0]) == nil {
+		return nil, ErrVersionNotFound
+	}
+	entry, ok := parseHistoryEntry(version, fields[1], fields[2], results[2], time.Now())
+	if !ok {
+		return nil, ErrVersionNotFound
+	}
+
+	value, err := rs.open(key, fields[0])
+	if err != nil {
+		return nil, err
+	}
+	entry.Value = toBytes(value)
+	return &entry, nil
+}
+
+// ListVersions returns the kept versions of key, newest first, without their
+// values. keep is the history length the versions were written with.
+func (rs *RespServer) ListVersions(key string, keep int) ([]HistoryEntry, error) {
+	res, err := rs.do("GET", versionKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("primary read failed: %w", err)
+	}
+	current := parseVersion(res)
+	oldest := max(current-int64(keep)+1, 1)
+	if current < oldest {
+		return nil, nil
+	}
+
+	hk := historyKey(key)
+	hmget := []string{"HMGET", hk}
+	for v := current; v >= oldest; v-- {
+		_, tsField, expField := historyFields(v)
+		hmget = append(hmget, tsField, expField)
+	}
+	results, err := rs.multi(hmget, []string{"PTTL", hk})
+	if err != nil {
+		return nil, fmt.Errorf("primary read failed: %w", err)
+	}
+	if err := firstError(results); err != nil {
+		return nil, fmt.Errorf("primary read failed: %w", err)
+	}
+	fields, _ := results[0].([]interface{})
+	if len(fields) != len(hmget)-2 {
+		return nil, fmt.Errorf("unexpected HMGET reply of %d fields", len(fields))
+	}
+
+	now := time.Now()
+	var entries []HistoryEntry
+	for i, v := 0, current; v >= oldest; i, v = i+2, v-1 {
+		// Missing versions expired, or were written before history was enabled
+		if entry, ok := parseHistoryEntry(v, fields[i], fields[i+1], results[1], now); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// parseHistoryEntry builds an entry from its stored timestamp and expiry and
+// the PTTL of the history, reporting false if the version has expired
+func parseHistoryEntry(version int64, ts, expires, historyTTL interface{}, now time.Time) (HistoryEntry, bool) {
+	if toBytes(ts) == nil {
+		return HistoryEntry{}, false
+	}
+
+	entry := HistoryEntry{Version: version, TTL: -1}
+	if ms, err := strconv.ParseInt(string(toBytes(ts)), 10, 64); err == nil {
+		entry.Timestamp = time.UnixMilli(ms)
+	}
+
+	// A version expires with its own TTL or with the history, if that is sooner
+	left := time.Duration(-1)
+	if ms, err := strconv.ParseInt(string(toBytes(expires)), 10, 64); err == nil {
+		left = time.UnixMilli(ms).Sub(now)
+		if left <= 0 {
+			return HistoryEntry{}, false
+		}
+	}
+	if ms, ok := historyTTL.(int64); ok && ms >= 0 {
+		if d := time.Duration(ms) * time.Millisecond; left < 0 || d < left {
+			left = d
+		}
+	}
+	if left >= 0 {
+		entry.TTL = int(left / time.Second)
+	}
+	return entry, true
+}
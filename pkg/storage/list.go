@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// ErrQueueEmpty is returned when a pop finds no item before its timeout
+var ErrQueueEmpty = errors.New("queue empty")
+
+// popRetries bounds how often PopReliable retries after losing a race with a
+// concurrent writer to the queue
+const popRetries = 16
+
+// inflightKey holds items popped in reliable mode until they are acked
+func inflightKey(key string) string {
+	return metaPrefix + "inflight:" + key
+}
+
+// leaseKey maps each outstanding receipt to the item it was issued for
+func leaseKey(key string) string {
+	return metaPrefix + "leases:" + key
+}
+
+// deadlineKey orders outstanding receipts by visibility deadline in unix ms
+func deadlineKey(key string) string {
+	return metaPrefix + "deadlines:" + key
+}
+
+// Push appends values to the tail of the list at key, or to its head if front
+// is set, refreshing the list's TTL when ttl is positive. It returns the new
+// length of the list.
+func (rs *RespServer) Push(key string, front bool, values []string, ttl int) (int64, error) {
+	if len(values) == 0 {
+		return 0, nil
+	}
+	if err := rs.checkSealable(); err != nil {
+		return 0, err
+	}
+
+	push := "RPUSH"
+	if front {
+		push = "LPUSH"
+	}
+	cmds := [][]string{append([]string{push, key}, values...)}
+	if ttl > 0 {
+		cmds = append(cmds, []string{"EXPIRE", key, strconv.Itoa(ttl)})
+	}
+
+	results, err := rs.multi(cmds...)
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if err := firstError(results); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+
+	rs.replicate(wrapMulti(cmds)...)
+
+	length, _ := results[0].(int64)
+	return length, nil
+}
+
+// Pop removes and returns the head of the list at key, or its tail if back is
+// set. It returns ErrQueueEmpty if the list is empty.
+func (rs *RespServer) Pop(key string, back bool) ([]byte, error) {
+	args := []string{"LPOP", key}
+	if back {
+		args[0] = "RPOP"
+	}
+
+	res, err := rs.do(args...)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := res.([]byte)
+	if !ok || value == nil {
+		return nil, ErrQueueEmpty
+	}
+
+	rs.replicate(args)
+
+	return value, nil
+}
+
+// PopReliable moves the head (or tail) of the list at key into its in-flight
+// list and leases it for the visibility timeout. The item stays in flight
+// until Ack is called with the returned receipt; if the lease expires first,
+// RequeueExpired puts it back at the head of the queue. The item is read under
+// WATCH and moved and leased in one transaction, so it is never in flight
+// without a lease.
+func (rs *RespServer) PopReliable(key string, back bool, visibility time.Duration) ([]byte, string, error) {
+	receipt, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < popRetries; i++ {
+		value, err := rs.popReliableOnce(key, back, receipt, visibility)
+		if err == ErrConditionFailed {
+			continue
+		}
+		return value, receipt, err
+	}
+	return nil, "", fmt.Errorf("pops from %s too contended", key)
+}
+
+func (rs *RespServer) popReliableOnce(key string, back bool, receipt string, visibility time.Duration) (_ []byte, err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	from, index := "LEFT", "0"
+	if back {
+		from, index = "RIGHT", "-1"
+	}
+
+	reader := resp.NewReader(conn)
+	watch := resp.NewPipeline(
+		[]string{"WATCH", key},
+		[]string{"LINDEX", key, index},
+	)
+	if _, err := watch.Execute(conn); err != nil {
+		return nil, fmt.Errorf("primary pop failed: %w", err)
+	}
+	if !reader.IsOK() {
+		reader.ReadValue()
+		return nil, fmt.Errorf("primary watch not OK")
+	}
+	res, err := reader.ReadValue()
+	if err != nil {
+		return nil, unwatch(conn, reader, fmt.Errorf("primary read failed: %w", err))
+	}
+	value, ok := res.([]byte)
+	if !ok || value == nil {
+		return nil, unwatch(conn, reader, ErrQueueEmpty)
+	}
+
+	deadline := time.Now().Add(visibility).UnixMilli()
+	cmds := [][]string{
+		{"LMOVE", key, inflightKey(key), from, "RIGHT"},
+		{"HSET", leaseKey(key), receipt, string(value)},
+		{"ZADD", deadlineKey(key), strconv.FormatInt(deadline, 10), receipt},
+	}
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return nil, fmt.Errorf("primary pop failed: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return nil, fmt.Errorf("primary pop failed: %w", err)
+	}
+	if results == nil {
+		// Another consumer or a producer got there first
+		return nil, ErrConditionFailed
+	}
+	if err := firstError(results); err != nil {
+		return nil, fmt.Errorf("primary pop failed: %w", err)
+	}
+
+	rs.replicate(wrapMulti(cmds)...)
+
+	return value, nil
+}
+
+// Ack removes an item popped in reliable mode from the in-flight list and
+// returns it, or nil if the receipt is unknown or its lease already expired
+func (rs *RespServer) Ack(key, receipt string) ([]byte, error) {
+	value, err := rs.releaseLease(key, receipt, false)
+	if err != nil {
+		return nil, fmt.Errorf("primary ack failed: %w", err)
+	}
+	return value, nil
+}
+
+// RequeueExpired returns items whose visibility timeout has passed to the head
+// of the list at key and reports how many were requeued
+func (rs *RespServer) RequeueExpired(key string) (int, error) {
+	res, err := rs.do("ZRANGEBYSCORE", deadlineKey(key), "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	if err != nil {
+		return 0, err
+	}
+	receipts, _ := res.([]interface{})
+
+	requeued := 0
+	for _, r := range receipts {
+		// Another node may be requeueing or acking the same receipt
+		value, err := rs.releaseLease(key, string(toBytes(r)), true)
+		if err != nil {
+			return requeued, fmt.Errorf("primary requeue failed: %w", err)
+		}
+		if value != nil {
+			requeued++
+		}
+	}
+
+	return requeued, nil
+}
+
+// releaseLease drops a lease and its in-flight item, pushing the item back
+// onto the head of the queue if requeue is set. The lease is read under WATCH
+// and claimed and released in one transaction, so only one of Ack and
+// RequeueExpired can win for a given receipt. It returns the item, or nil if
+// the lease is gone.
+func (rs *RespServer) releaseLease(key, receipt string, requeue bool) ([]byte, error) {
+	for i := 0; i < popRetries; i++ {
+		value, err := rs.releaseLeaseOnce(key, receipt, requeue)
+		if err == ErrConditionFailed {
+			continue
+		}
+		return value, err
+	}
+	return nil, fmt.Errorf("leases on %s too contended", key)
+}
+
+func (rs *RespServer) releaseLeaseOnce(key, receipt string, requeue bool) (_ []byte, err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	reader := resp.NewReader(conn)
+	watch := resp.NewPipeline(
+		[]string{"WATCH", deadlineKey(key), leaseKey(key)},
+		[]string{"ZSCORE", deadlineKey(key), receipt},
+		[]string{"HGET", leaseKey(key), receipt},
+	)
+	if _, err := watch.Execute(conn); err != nil {
+		return nil, fmt.Errorf("failed to read lease: %w", err)
+	}
+	if !reader.IsOK() {
+		reader.ReadValue()
+		reader.ReadValue()
+		return nil, fmt.Errorf("primary watch not OK")
+	}
+	// Read both replies even after an error so the connection stays in sync
+	deadline, deadlineErr := reader.ReadValue()
+	res, err := reader.ReadValue()
+	if deadlineErr != nil {
+		err = deadlineErr
+	}
+	if err != nil {
+		return nil, unwatch(conn, reader, fmt.Errorf("failed to read lease: %w", err))
+	}
+	value, ok := res.([]byte)
+	if deadline == nil || !ok || value == nil {
+		// Already acked or requeued
+		return nil, unwatch(conn, reader, nil)
+	}
+
+	cmds := [][]string{
+		{"ZREM", deadlineKey(key), receipt},
+		{"LREM", inflightKey(key), "1", string(value)},
+		{"HDEL", leaseKey(key), receipt},
+	}
+	if requeue {
+		cmds = append(cmds, []string{"LPUSH", key, string(value)})
+	}
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return nil, fmt.Errorf("failed to release lease: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to release lease: %w", err)
+	}
+	if results == nil {
+		// The lease was claimed or renewed meanwhile
+		return nil, ErrConditionFailed
+	}
+	if err := firstError(results); err != nil {
+		return nil, fmt.Errorf("failed to release lease: %w", err)
+	}
+
+	rs.replicate(wrapMulti(cmds)...)
+
+	return value, nil
+}
+
+// LRange returns the elements of the list at key between start and stop
+// inclusive; negative indexes count from the tail
+func (rs *RespServer) LRange(key string, start, stop int64) ([][]byte, error) {
+	res, err := rs.do("LRANGE", key, strconv.FormatInt(start, 10), strconv.FormatInt(stop, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	elems, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected LRANGE reply %T", res)
+	}
+
+	values := make([][]byte, len(elems))
+	for i, elem := range elems {
+		values[i] = toBytes(elem)
+	}
+	return values, nil
+}
+
+// LLen returns the length of the list at key
+func (rs *RespServer) LLen(key string) (int64, error) {
+	return rs.doInt("LLEN", key)
+}
+
+// newToken returns a random hex token used for queue receipts and lock owners
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
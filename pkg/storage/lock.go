@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+var (
+	// ErrLockHeld is returned when a lock is already held by another owner
+	ErrLockHeld = errors.New("lock held by another owner")
+	// ErrNotLockHolder is returned when renewing or releasing a lock the caller
+	// no longer holds, usually because its lease expired
+	ErrNotLockHolder = errors.New("not the lock holder")
+)
+
+// lockKey holds the owner token of the lock at key, sealed like a value.
+// Locks live in their own key space, so the value at key itself is untouched
+// by locking and the owner token cannot be read or overwritten through it.
+func lockKey(key string) string {
+	return metaPrefix + "lock:" + key
+}
+
+// fenceKey holds the last fencing token issued for the lock at key. It is
+// never deleted or expired so tokens keep increasing across holders.
+func fenceKey(key string) string {
+	return metaPrefix + "fence:" + key
+}
+
+// Lock tries once to acquire the lock at key for lease, returning a random
+// owner token needed to renew or release it and a fencing token that is higher
+// than any issued for the lock before. It returns ErrLockHeld if the lock is
+// taken.
+func (rs *RespServer) Lock(key string, lease time.Duration) (_ string, _ int64, err error) {
+	owner, err := newToken()
+	if err != nil {
+		return "", 0, err
+	}
+	lk := lockKey(key)
+	stored, err := rs.seal(lk, owner)
+	if err != nil {
+		return "", 0, err
+	}
+
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	// Taking the lock and its token in one transaction under WATCH means a
+	// holder always has a token, and only holders take one, so each new
+	// holder sees a higher token
+	reader := resp.NewReader(conn)
+	if _, err := conn.writePipeline([]string{"WATCH", lk}, []string{"EXISTS", lk}); err != nil {
+		return "", 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if !reader.IsOK() {
+		reader.ReadValue()
+		return "", 0, fmt.Errorf("primary watch not OK")
+	}
+	exists, err := reader.ReadInt()
+	if err != nil {
+		return "", 0, unwatch(conn, reader, fmt.Errorf("primary read failed: %w", err))
+	}
+	if exists != 0 {
+		return "", 0, unwatch(conn, reader, ErrLockHeld)
+	}
+
+	ms := strconv.FormatInt(lease.Milliseconds(), 10)
+	cmds := [][]string{
+		{"SET", lk, stored, "PX", ms},
+		{"INCR", fenceKey(key)},
+	}
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return "", 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return "", 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if results == nil {
+		// Another owner took the lock between the check and the write
+		return "", 0, ErrLockHeld
+	}
+	if err := firstError(results); err != nil {
+		return "", 0, fmt.Errorf("failed to issue fencing token: %w", err)
+	}
+	fence, ok := results[1].(int64)
+	if !ok {
+		return "", 0, fmt.Errorf("unexpected fencing token reply %T", results[1])
+	}
+
+	rs.replicate(wrapMulti([][]string{
+		{"SET", lk, stored, "PX", ms},
+		{"SET", fenceKey(key), strconv.FormatInt(fence, 10)},
+	})...)
+
+	return owner, fence, nil
+}
+
+// Renew extends the lease of a lock held by owner
+func (rs *RespServer) Renew(key, owner string, lease time.Duration) error {
+	ms := strconv.FormatInt(lease.Milliseconds(), 10)
+	stored, err := rs.seal(lockKey(key), owner)
+	if err != nil {
+		return err
+	}
+	if err := rs.ifOwner(key, owner, []string{"PEXPIRE", lockKey(key), ms}); err != nil {
+		return err
+	}
+
+	rs.replicate([]string{"SET", lockKey(key), stored, "PX", ms})
+
+	return nil
+}
+
+// Unlock releases a lock held by owner
+func (rs *RespServer) Unlock(key, owner string) error {
+	if err := rs.ifOwner(key, owner, []string{"DEL", lockKey(key)}); err != nil {
+		return err
+	}
+
+	rs.replicate([]string{"DEL", lockKey(key)})
+
+	return nil
+}
+
+// ifOwner runs cmd in a transaction only if the lock at key is still held by
+// owner, returning ErrNotLockHolder otherwise
+func (rs *RespServer) ifOwner(key, owner string, cmd []string) (err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	lk := lockKey(key)
+	reader := resp.NewReader(conn)
+	if _, err := conn.writePipeline([]string{"WATCH", lk}, []string{"GET", lk}); err != nil {
+		return fmt.Errorf("primary write failed: %w", err)
+	}
+	if !reader.IsOK() {
+		reader.ReadValue()
+		return fmt.Errorf("primary watch not OK")
+	}
+	res, err := reader.ReadValue()
+	if err != nil {
+		return unwatch(conn, reader, fmt.Errorf("primary read failed: %w", err))
+	}
+
+	current, err := rs.open(lk, res)
+	if err != nil {
+		return unwatch(conn, reader, err)
+	}
+	if current, ok := current.([]byte); !ok || string(current) != owner {
+		return unwatch(conn, reader, ErrNotLockHolder)
+	}
+
+	if _, err := conn.writePipeline(wrapMulti([][]string{cmd})...); err != nil {
+		return fmt.Errorf("primary write failed: %w", err)
+	}
+	results, err := readMulti(reader, 1)
+	if err != nil {
+		return fmt.Errorf("primary write failed: %w", err)
+	}
+	if results == nil {
+		// The lock changed hands between the check and the write
+		return ErrNotLockHolder
+	}
+	return firstError(results)
+}
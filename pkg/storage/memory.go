@@ -0,0 +1,779 @@
+package storage
+
+import (
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/we-be/tritium/internal/secmem"
+)
+
+const (
+	// memoryShards is the number of independently locked maps keys are spread over
+	memoryShards = 64
+	// entryOverhead approximates the bookkeeping cost of a key beyond its bytes
+	entryOverhead = 64
+	// evictionSamples is how many keys are compared to pick each eviction victim
+	evictionSamples = 16
+	// lfuDecay is how long a key goes unread before its use count is halved
+	lfuDecay = time.Minute
+)
+
+// MemoryBackend keeps values in the Tritium process itself, so a node can run
+// without an external RESP server. Keys are spread over sharded maps and
+// expire through a deadline heap drained by a background janitor, as well as
+// lazily when read. Values are copied in and out, so any bytes are safe.
+// Locks are always taken shard first, then the heap. Versions are drawn from
+// one counter for the whole backend, so a key deleted and written again never
+// reissues a version a client may still hold.
+//
+// With a memory limit, writes that would exceed it first evict keys chosen by
+// the eviction policy. Like Redis, victims are picked among a random sample of
+// keys rather than by an exact ordering.
+//
+// A memory backend is standalone: it holds no connections and cannot
+// replicate to other nodes. It implements Backend and MemoryReporter only, so
+// it stores plain values and counters; hashes, lists, sets, pub/sub and
+// watches, transactions, locks, rate limits, streams and version history need
+// the RESP backend and fail with ErrUnsupported.
+type MemoryBackend struct {
+	shards [memoryShards]memShard
+
+	limit    int64 // bytes; 0 if unlimited
+	policy   EvictionPolicy
+	used     int64 // accessed atomically
+	evicted  int64 // accessed atomically
+	versions int64 // the last version issued; accessed atomically
+
+	expiryMu sync.Mutex
+	expiry   expiryHeap
+	wake     chan struct{} // signals the janitor that an earlier deadline was added
+
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+type memShard struct {
+	mu    sync.Mutex
+	items map[string]*memEntry
+}
+
+type memEntry struct {
+	value   []byte         // nil for the tombstone of a used-up read-limited value
+	buf     *secmem.Buffer // secure memory holding value
+	version int64
+	expires time.Time   // zero if the key never expires
+	slot    *expiryItem // the entry's deadline in the heap, if it expires
+
+	limited   bool
+	readsLeft int64
+
+	size       int64 // bytes charged against the memory limit
+	lastAccess time.Time
+	uses       float64 // decayed use count for LFU eviction
+}
+
+// NewMemoryBackend creates an empty in-process backend holding at most limit
+// bytes, or any amount if limit is 0, and starts its janitor
+func NewMemoryBackend(limit int64, policy EvictionPolicy) *MemoryBackend {
+	m := &MemoryBackend{
+		limit:  limit,
+		policy: policy,
+		wake:   make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for i := range m.shards {
+		m.shards[i].items = make(map[string]*memEntry)
+	}
+	go m.janitor()
+	return m
+}
+
+func (m *MemoryBackend) shard(key string) *memShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &m.shards[h.Sum32()%memoryShards]
+}
+
+// live returns the entry at key, dropping it if it has expired. Callers must
+// hold the shard lock.
+func (m *MemoryBackend) live(s *memShard, key string, now time.Time) *memEntry {
+	e, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && !now.Before(e.expires) {
+		m.drop(s, key, e)
+		return nil
+	}
+	return e
+}
+
+// drop removes an entry and its deadline; callers must hold the shard lock
+func (m *MemoryBackend) drop(s *memShard, key string, e *memEntry) {
+	delete(s.items, key)
+	m.setDeadline(e, key, time.Time{})
+	atomic.AddInt64(&m.used, -e.size)
+	e.buf.Free()
+}
+
+// setValue replaces the value of e with buf, or a tombstone if buf is nil,
+// wiping the old value and charging the change in size; callers must hold
+// the shard lock
+func (m *MemoryBackend) setValue(e *memEntry, key string, buf *secmem.Buffer) {
+	e.buf.Free()
+	e.buf, e.value = buf, nil
+	if buf != nil {
+		e.value = buf.Bytes()
+	}
+	size := int64(len(key) + len(e.value) + entryOverhead)
+	atomic.AddInt64(&m.used, size-e.size)
+	e.size = size
+}
+
+// touch records a use of e for eviction; callers must hold the shard lock
+func touch(e *memEntry, now time.Time) {
+	e.uses = decayedUses(e, now) + 1
+	e.lastAccess = now
+}
+
+// decayedUses halves a key's use count for every lfuDecay it went unused
+func decayedUses(e *memEntry, now time.Time) float64 {
+	idle := now.Sub(e.lastAccess)
+	if e.lastAccess.IsZero() || idle <= 0 {
+		return e.uses
+	}
+	return e.uses * math.Pow(0.5, float64(idle)/float64(lfuDecay))
+}
+
+// expiresIn converts a TTL in seconds into a deadline
+func expiresIn(now time.Time, ttl int) time.Time {
+	return now.Add(time.Duration(ttl) * time.Second)
+}
+
+// SetEx writes value with a TTL in seconds and bumps the key's version
+func (m *MemoryBackend) SetEx(key string, ttl int, value string) (int64, error) {
+	return m.SetExIf(key, ttl, value, Condition{}, 0)
+}
+
+// SetExIf writes value only if cond holds for the key's current value and
+// version. A positive maxReads limits how often the value can be read.
+func (m *MemoryBackend) SetExIf(key string, ttl int, value string, cond Condition, maxReads int) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("invalid expire time %d", ttl)
+	}
+	if err := m.makeRoom(key, len(value)); err != nil {
+		return 0, err
+	}
+	buf, err := secmem.CopyString(value)
+	if err != nil {
+		return 0, err
+	}
+
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := m.live(s, key, now)
+	current := Item{}
+	if e != nil {
+		current = Item{Value: e.value, Version: e.version}
+	}
+	if !cond.holds(current) {
+		buf.Free()
+		return 0, ErrConditionFailed
+	}
+
+	if e == nil {
+		e = &memEntry{}
+		s.items[key] = e
+	}
+
+	m.setValue(e, key, buf)
+	touch(e, now)
+	e.version = atomic.AddInt64(&m.versions, 1)
+	e.limited = maxReads > 0
+	e.readsLeft = int64(maxReads)
+	m.setDeadline(e, key, expiresIn(now, ttl))
+	return e.version, nil
+}
+
+// MSetEx writes every entry with its own TTL. Entries are applied one by one,
+// so a reader may observe some of them before the others.
+func (m *MemoryBackend) MSetEx(entries []Entry) ([]WriteResult, error) {
+	writes := make([]WriteResult, len(entries))
+	for i, e := range entries {
+		writes[i].Version, writes[i].Err = m.SetEx(e.Key, e.TTL, e.Value)
+	}
+	return writes, nil
+}
+
+// Get reads a key and its version, spending a read of read-limited values
+func (m *MemoryBackend) Get(key string) (Item, error) {
+	item := m.get(key)
+	return item, item.Err
+}
+
+// MGet reads several keys. The result has one item per key, with a nil value
+// for missing keys.
+func (m *MemoryBackend) MGet(keys ...string) ([]Item, error) {
+	items := make([]Item, len(keys))
+	for i, key := range keys {
+		items[i] = m.get(key)
+	}
+	return items, nil
+}
+
+func (m *MemoryBackend) get(key string) Item {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := m.live(s, key, now)
+	if e == nil {
+		return Item{}
+	}
+	if e.value == nil {
+		return Item{Err: ErrConsumed}
+	}
+	touch(e, now)
+
+	item := Item{Value: append([]byte(nil), e.value...), Version: e.version}
+	if e.limited {
+		e.readsLeft--
+		item.Limited = true
+		item.ReadsLeft = e.readsLeft
+		if e.readsLeft == 0 {
+			// Leave a tombstone until the value would have expired
+			m.setValue(e, key, nil)
+		}
+	}
+	return item
+}
+
+// IncrBy adds delta to the integer stored at key and returns the new value. If
+// ttl is positive and the key does not exist yet, the counter is created with
+// that TTL; an existing counter keeps its TTL. Each increment bumps the key's
+// version.
+func (m *MemoryBackend) IncrBy(key string, delta int64, ttl int) (int64, error) {
+	// Room for the longest possible counter
+	if err := m.makeRoom(key, len(strconv.FormatInt(math.MinInt64, 10))); err != nil {
+		return 0, err
+	}
+
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := m.live(s, key, now)
+	created := e == nil || e.value == nil
+
+	var current int64
+	if !created {
+		n, err := strconv.ParseInt(string(e.value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value is not an integer or out of range")
+		}
+		current = n
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, fmt.Errorf("increment or decrement would overflow")
+	}
+
+	value := current + delta
+	buf, err := secmem.CopyString(strconv.FormatInt(value, 10))
+	if err != nil {
+		return 0, err
+	}
+	if e == nil {
+		e = &memEntry{}
+		s.items[key] = e
+	}
+	m.setValue(e, key, buf)
+	touch(e, now)
+	e.limited = false
+	e.version = atomic.AddInt64(&m.versions, 1)
+	if created {
+		var expires time.Time
+		if ttl > 0 {
+			expires = expiresIn(now, ttl)
+		}
+		m.setDeadline(e, key, expires)
+	}
+	return value, nil
+}
+
+// Delete removes keys, returning the ones that held a value
+func (m *MemoryBackend) Delete(keys ...string) ([]string, error) {
+	var deleted []string
+	for _, key := range keys {
+		s := m.shard(key)
+		s.mu.Lock()
+		if e := m.live(s, key, time.Now()); e != nil {
+			if e.value != nil {
+				deleted = append(deleted, key)
+			}
+			m.drop(s, key, e)
+		}
+		s.mu.Unlock()
+	}
+	return deleted, nil
+}
+
+// Scan returns the keys matching pattern in one shard per call, starting with
+// the shard numbered cursor and moving on until at least count keys were found.
+// A returned cursor of 0 means the iteration is complete. As with SCAN, keys
+// written during an iteration may or may not be returned.
+func (m *MemoryBackend) Scan(cursor uint64, pattern string, count int) (uint64, []string, error) {
+	if count <= 0 {
+		count = 10
+	}
+
+	var keys []string
+	now := time.Now()
+	for ; cursor < memoryShards && len(keys) < count; cursor++ {
+		s := &m.shards[cursor]
+		s.mu.Lock()
+		for key := range s.items {
+			e := m.live(s, key, now)
+			if e == nil || e.value == nil || strings.HasPrefix(key, metaPrefix) {
+				continue
+			}
+			if matchPattern(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+	sort.Strings(keys)
+
+	if cursor >= memoryShards {
+		cursor = 0
+	}
+	return cursor, keys, nil
+}
+
+// TTL returns the remaining lifetime of key in seconds, -1 if the key has no
+// expiry and -2 if it does not exist
+func (m *MemoryBackend) TTL(key string) (int64, error) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := m.live(s, key, now)
+	switch {
+	case e == nil || e.value == nil:
+		return -2, nil
+	case e.expires.IsZero():
+		return -1, nil
+	default:
+		// Round to the nearest second like Redis
+		return int64((e.expires.Sub(now) + 500*time.Millisecond) / time.Second), nil
+	}
+}
+
+// Expire sets a new TTL in seconds on key, reporting whether the key existed.
+// A TTL that is not positive deletes the key.
+func (m *MemoryBackend) Expire(key string, ttl int) (bool, error) {
+	return m.setExpiry(key, expiresIn(time.Now(), ttl))
+}
+
+// ExpireAt makes key expire at the given unix timestamp, reporting whether the
+// key existed
+func (m *MemoryBackend) ExpireAt(key string, unixTime int64) (bool, error) {
+	return m.setExpiry(key, time.Unix(unixTime, 0))
+}
+
+func (m *MemoryBackend) setExpiry(key string, expires time.Time) (bool, error) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := m.live(s, key, now)
+	if e == nil || e.value == nil {
+		return false, nil
+	}
+	if !now.Before(expires) {
+		m.drop(s, key, e)
+		return true, nil
+	}
+	m.setDeadline(e, key, expires)
+	return true, nil
+}
+
+// Persist removes the TTL from key, reporting whether a TTL was removed
+func (m *MemoryBackend) Persist(key string) (bool, error) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := m.live(s, key, time.Now())
+	if e == nil || e.value == nil || e.expires.IsZero() {
+		return false, nil
+	}
+	m.setDeadline(e, key, time.Time{})
+	return true, nil
+}
+
+// AddReplica always fails: values held in process cannot be replicated
+func (m *MemoryBackend) AddReplica(addr string, maxConn int) error {
+	return fmt.Errorf("memory backend cannot replicate to %s: %w", addr, ErrUnsupported)
+}
+
+// RemoveReplica always fails, as no replica can have been added
+func (m *MemoryBackend) RemoveReplica(addr string) error {
+	return fmt.Errorf("replica %s not found", addr)
+}
+
+// GetMaxConnections returns 0, as the memory backend holds no connections
+func (m *MemoryBackend) GetMaxConnections() int {
+	return 0
+}
+
+// Close stops the janitor and drops every key
+func (m *MemoryBackend) Close() error {
+	select {
+	case <-m.stopCh:
+		return nil
+	default:
+	}
+	close(m.stopCh)
+	<-m.done
+
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		for _, e := range s.items {
+			e.buf.Free()
+		}
+		s.items = make(map[string]*memEntry)
+		s.mu.Unlock()
+	}
+	m.expiryMu.Lock()
+	m.expiry = nil
+	m.expiryMu.Unlock()
+	atomic.StoreInt64(&m.used, 0)
+	return nil
+}
+
+// MemoryStats reports the bytes held against the memory limit
+func (m *MemoryBackend) MemoryStats() (MemoryStats, error) {
+	return MemoryStats{
+		Limit:   m.limit,
+		Used:    atomic.LoadInt64(&m.used),
+		Evicted: atomic.LoadInt64(&m.evicted),
+		Policy:  m.policy,
+	}, nil
+}
+
+// makeRoom evicts keys until a value of valueLen bytes can be written to key
+// within the memory limit, or returns ErrMemoryLimit if it cannot. It runs
+// before the write takes its shard lock, so concurrent writes may overshoot
+// the limit by the size of the values in flight.
+func (m *MemoryBackend) makeRoom(key string, valueLen int) error {
+	if m.limit <= 0 {
+		return nil
+	}
+
+	need := int64(len(key) + valueLen + entryOverhead)
+	if need > m.limit {
+		return ErrMemoryLimit
+	}
+
+	// Overwrites only need room for the growth
+	s := m.shard(key)
+	s.mu.Lock()
+	if e, ok := s.items[key]; ok {
+		need -= e.size
+	}
+	s.mu.Unlock()
+
+	for atomic.LoadInt64(&m.used)+need > m.limit {
+		if m.policy == EvictReject || !m.evictOne(key) {
+			return ErrMemoryLimit
+		}
+	}
+	return nil
+}
+
+// evictionCandidate is a sampled key and its eviction score; lower scores are
+// evicted first
+type evictionCandidate struct {
+	shard *memShard
+	key   string
+	entry *memEntry
+	score float64
+}
+
+// evictOne evicts the best victim among a sample of keys other than exclude,
+// reporting false if no key is eligible under the policy
+func (m *MemoryBackend) evictOne(exclude string) bool {
+	now := time.Now()
+	perShard := evictionSamples/4 + 1
+
+	var best *evictionCandidate
+	sampled := 0
+	start := rand.Intn(memoryShards)
+	for i := 0; i < memoryShards && sampled < evictionSamples; i++ {
+		s := &m.shards[(start+i)%memoryShards]
+		s.mu.Lock()
+		n := 0
+		// Map iteration order is random, so this samples the shard
+		for key, e := range s.items {
+			if n == perShard {
+				break
+			}
+			if key == exclude || (m.policy != EvictAllKeysLFU && e.expires.IsZero()) {
+				continue
+			}
+			n++
+			if score := m.evictionScore(e, now); best == nil || score < best.score {
+				best = &evictionCandidate{shard: s, key: key, entry: e, score: score}
+			}
+		}
+		sampled += n
+		s.mu.Unlock()
+	}
+	if best == nil {
+		return false
+	}
+
+	best.shard.mu.Lock()
+	// Skip victims rewritten since they were sampled; the caller samples again
+	if best.shard.items[best.key] == best.entry {
+		m.drop(best.shard, best.key, best.entry)
+		atomic.AddInt64(&m.evicted, 1)
+	}
+	best.shard.mu.Unlock()
+	return true
+}
+
+// evictionScore ranks e under the eviction policy; callers must hold its
+// shard lock
+func (m *MemoryBackend) evictionScore(e *memEntry, now time.Time) float64 {
+	switch m.policy {
+	case EvictAllKeysLFU:
+		return decayedUses(e, now)
+	case EvictTTLNearest:
+		return float64(e.expires.UnixNano())
+	default:
+		return float64(e.lastAccess.UnixNano())
+	}
+}
+
+// setDeadline sets when e expires, replacing its previous deadline in the
+// heap; a zero time removes it. Callers must hold the shard lock.
+func (m *MemoryBackend) setDeadline(e *memEntry, key string, expires time.Time) {
+	e.expires = expires
+
+	m.expiryMu.Lock()
+	if e.slot != nil && e.slot.index >= 0 {
+		heap.Remove(&m.expiry, e.slot.index)
+	}
+	e.slot = nil
+	earliest := false
+	if !expires.IsZero() {
+		e.slot = &expiryItem{key: key, expires: expires}
+		heap.Push(&m.expiry, e.slot)
+		earliest = m.expiry[0] == e.slot
+	}
+	m.expiryMu.Unlock()
+
+	if earliest {
+		select {
+		case m.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// janitor deletes keys as their deadlines pass, sleeping until the earliest
+// deadline or until an earlier one is scheduled
+func (m *MemoryBackend) janitor() {
+	defer close(m.done)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		wait := m.expireDue(time.Now())
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-m.stopCh:
+			return
+		case <-m.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// expireDue deletes every key whose deadline has passed and returns how long
+// to wait for the next one
+func (m *MemoryBackend) expireDue(now time.Time) time.Duration {
+	for {
+		m.expiryMu.Lock()
+		if len(m.expiry) == 0 {
+			m.expiryMu.Unlock()
+			return time.Hour
+		}
+		next := m.expiry[0]
+		if now.Before(next.expires) {
+			m.expiryMu.Unlock()
+			return next.expires.Sub(now)
+		}
+		heap.Pop(&m.expiry)
+		m.expiryMu.Unlock()
+
+		// The key may have been rescheduled since its deadline was popped
+		s := m.shard(next.key)
+		s.mu.Lock()
+		if e, ok := s.items[next.key]; ok && e.slot == next {
+			m.drop(s, next.key, e)
+		}
+		s.mu.Unlock()
+	}
+}
+
+type expiryItem struct {
+	key     string
+	expires time.Time
+	index   int // position in the heap, or -1 once popped
+}
+
+// expiryHeap orders deadlines earliest first
+type expiryHeap []*expiryItem
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*h = old[:len(old)-1]
+	return item
+}
+
+// matchPattern reports whether key matches a SCAN glob pattern: * matches any
+// run of characters, ? any single character, [...] a character class (with ^
+// for negation and a-z ranges), and \ escapes the next character
+func matchPattern(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if matchPattern(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			n, ok := matchClass(pattern, key[0])
+			if !ok {
+				return false
+			}
+			pattern = pattern[n:]
+			key = key[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		key = key[1:]
+	}
+	return len(key) == 0
+}
+
+// matchClass matches c against the character class at the start of pattern,
+// returning the length of the class and whether c is in it
+func matchClass(pattern string, c byte) (int, bool) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+
+	matched := false
+	for i < len(pattern) && pattern[i] != ']' {
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			i += 2
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+		i++
+	}
+	if i < len(pattern) {
+		i++ // closing bracket
+	}
+	return i, matched != negate
+}
+
+var (
+	_ Backend        = (*MemoryBackend)(nil)
+	_ MemoryReporter = (*MemoryBackend)(nil)
+)
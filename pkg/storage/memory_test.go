@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryJanitorReleasesExpired(t *testing.T) {
+	m := NewMemoryBackend(10000, EvictReject)
+	defer m.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := m.SetEx(key, 1, "value"); err != nil {
+			t.Fatalf("SetEx returned an error: %v", err)
+		}
+	}
+	if stats, _ := m.MemoryStats(); stats.Used == 0 {
+		t.Fatalf("Expected keys to be charged, got %+v", stats)
+	}
+
+	// Drain the heap as the janitor would, without reading any key
+	m.expireDue(time.Now().Add(2 * time.Second))
+	if stats, _ := m.MemoryStats(); stats.Used != 0 {
+		t.Errorf("Expected expired keys to be released, got %+v", stats)
+	}
+	if _, keys, _ := m.Scan(0, "*", 100); len(keys) != 0 {
+		t.Errorf("Expected no keys left, got %v", keys)
+	}
+}
+
+func TestMemoryJanitorWipesExpired(t *testing.T) {
+	m := NewMemoryBackend(0, EvictReject)
+	defer m.Close()
+
+	if _, err := m.SetEx("secret", 1, "correct horse"); err != nil {
+		t.Fatalf("SetEx returned an error: %v", err)
+	}
+	s := m.shard("secret")
+	s.mu.Lock()
+	value := s.items["secret"].value
+	s.mu.Unlock()
+
+	m.expireDue(time.Now().Add(2 * time.Second))
+	for i, b := range value {
+		if b != 0 {
+			t.Fatalf("Byte %d of the expired value not wiped: %#x", i, b)
+		}
+	}
+}
+
+func TestMemoryVersionAfterDelete(t *testing.T) {
+	m := NewMemoryBackend(0, EvictReject)
+	defer m.Close()
+
+	old, err := m.SetEx("key", 60, "v1")
+	if err != nil {
+		t.Fatalf("SetEx returned an error: %v", err)
+	}
+	m.Delete("key")
+
+	// A stale version must not match the re-created key
+	if _, err := m.SetExIf("key", 60, "v2", Condition{IfVersion: &old}, 0); err != ErrConditionFailed {
+		t.Fatalf("Expected ErrConditionFailed for a version from before the delete, got %v", err)
+	}
+	never := int64(0)
+	version, err := m.SetExIf("key", 60, "v2", Condition{IfVersion: &never}, 0)
+	if err != nil || version <= old {
+		t.Errorf("Expected a version above %d, got %d (%v)", old, version, err)
+	}
+}
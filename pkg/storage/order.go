@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"slices"
+	"sync"
+)
+
+// keyLocks serializes writes to the same key whose replicas are sent the
+// resulting value rather than the command, such as increments. Holding a key's
+// lock from the primary write until its replication completes keeps the
+// replicas' writes in the primary's order, so a replication that finishes late
+// cannot overwrite a newer value with an older one. The zero value is ready to
+// use.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int // holders and waiters; the lock is dropped when none are left
+}
+
+// lock locks each distinct key, in sorted order so concurrent callers cannot
+// deadlock, and returns the function that unlocks them
+func (kl *keyLocks) lock(keys ...string) func() {
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	kl.mu.Lock()
+	if kl.locks == nil {
+		kl.locks = make(map[string]*keyLock)
+	}
+	held := make([]*keyLock, len(keys))
+	for i, key := range keys {
+		l, ok := kl.locks[key]
+		if !ok {
+			l = &keyLock{}
+			kl.locks[key] = l
+		}
+		l.refs++
+		held[i] = l
+	}
+	kl.mu.Unlock()
+
+	for _, l := range held {
+		l.Lock()
+	}
+	return func() {
+		kl.mu.Lock()
+		defer kl.mu.Unlock()
+		for i, l := range held {
+			l.Unlock()
+			if l.refs--; l.refs == 0 {
+				delete(kl.locks, keys[i])
+			}
+		}
+	}
+}
+
+// lockReplication holds keys for a write whose replicas receive its result,
+// until the returned function is called after replicating. Without replicas
+// there is nothing to order and writes are not serialized.
+func (rs *RespServer) lockReplication(keys ...string) func() {
+	rs.mu.RLock()
+	replicated := len(rs.replicas) > 0
+	rs.mu.RUnlock()
+
+	if !replicated {
+		return func() {}
+	}
+	return rs.ordered.lock(keys...)
+}
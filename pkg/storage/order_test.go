@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestIncrByReplicatesInOrder(t *testing.T) {
+	// The primary doubles as its own replica, so a replicated value that
+	// arrives out of order would overwrite the primary's newer one
+	rs, err := NewRespServer(benchAddr, 8, []string{benchAddr})
+	if err != nil {
+		t.Skipf("RESP server unavailable: %v", err)
+	}
+	defer rs.Close()
+	defer rs.Delete("test-incr-order")
+	rs.Delete("test-incr-order")
+
+	const writers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rs.IncrBy("test-incr-order", 1, 60); err != nil {
+				t.Errorf("IncrBy failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := rs.IncrBy("test-incr-order", 0, 60)
+	if err != nil {
+		t.Fatalf("IncrBy failed: %v", err)
+	}
+	if value != writers {
+		t.Errorf("Expected %d after concurrent increments, got %d", writers, value)
+	}
+	if len(rs.ordered.locks) != 0 {
+		t.Errorf("Expected key locks to be dropped, %d left", len(rs.ordered.locks))
+	}
+}
@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+const (
+	dialTimeout    = 2 * time.Second
+	acquireTimeout = 5 * time.Second  // longest a caller waits for a connection
+	ioTimeout      = 10 * time.Second // deadline for the work done on a checkout
+	idleCheck      = 30 * time.Second // connections idle longer are pinged on checkout
+	minBackoff     = 50 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+)
+
+var (
+	// ErrPoolTimeout is returned when no connection became available before
+	// the acquisition deadline
+	ErrPoolTimeout = errors.New("timed out waiting for a connection")
+	// ErrPoolClosed is returned for checkouts from a closed pool
+	ErrPoolClosed = errors.New("connection pool closed")
+)
+
+// PoolStats reports the state of a connection pool
+type PoolStats struct {
+	Addr         string
+	MaxConns     int
+	InUse        int64
+	Idle         int
+	DialFailures int64 // failed dials since startup
+}
+
+// PoolReporter is implemented by backends that report their connection pools
+type PoolReporter interface {
+	PoolStats() []PoolStats
+}
+
+// poolConn is a pooled connection. Any I/O error marks it broken, as the
+// RESP stream can no longer be trusted to be in sync, and broken connections
+// are closed instead of being returned to the pool. So are connections whose
+// operation failed in a way that may have left the stream out of step.
+type poolConn struct {
+	net.Conn
+	idleSince time.Time
+	broken    atomic.Bool
+	writer    resp.Writer // secure buffer reused by every write on the connection
+}
+
+func (c *poolConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if err != nil {
+		c.broken.Store(true)
+	}
+	return n, err
+}
+
+func (c *poolConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if err != nil {
+		c.broken.Store(true)
+	}
+	return n, err
+}
+
+// Close closes the connection, which ends any write in progress, and then
+// frees its write buffer
+func (c *poolConn) Close() error {
+	err := c.Conn.Close()
+	c.writer.Free()
+	return err
+}
+
+// writePipeline writes cmds in a single call; see resp.WritePipeline
+func (c *poolConn) writePipeline(cmds ...[]string) (int, error) {
+	return c.writer.WritePipeline(c, cmds...)
+}
+
+// ping reports whether the connection still answers
+func (c *poolConn) ping() bool {
+	c.SetDeadline(time.Now().Add(dialTimeout))
+	if _, err := c.writePipeline([]string{"PING"}); err != nil {
+		return false
+	}
+	res, err := resp.NewReader(c).ReadValue()
+	return err == nil && res == "PONG"
+}
+
+// connPool holds up to a fixed number of connections to one RESP server.
+// Connections are dialed as they are needed and redialed after failures,
+// backing off while the server is unreachable, so a restarted server is
+// picked up again without restarting Tritium.
+type connPool struct {
+	addr  string
+	slots chan struct{} // one token per checked out connection
+	idle  chan *poolConn
+
+	inUse        int64 // accessed atomically
+	dialFailures int64 // accessed atomically
+	brokenAt     int64 // unix nanos a connection last broke; accessed atomically
+
+	mu       sync.Mutex
+	failures int       // consecutive dial failures
+	retryAt  time.Time // no dials before this after a failure
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newConnPool creates a pool of up to maxConn connections to addr. One
+// connection is dialed up front so an unreachable server fails at startup.
+func newConnPool(addr string, maxConn int) (*connPool, error) {
+	pool := &connPool{
+		addr:   addr,
+		slots:  make(chan struct{}, maxConn),
+		idle:   make(chan *poolConn, maxConn),
+		closed: make(chan struct{}),
+	}
+
+	conn, err := pool.dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	conn.idleSince = time.Now()
+	pool.idle <- conn
+
+	return pool, nil
+}
+
+// get checks out a connection, waiting at most acquireTimeout for one. The
+// connection must be returned with put.
+func (p *connPool) get() (*poolConn, error) {
+	deadline := time.Now().Add(acquireTimeout)
+	timer := time.NewTimer(acquireTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-timer.C:
+		return nil, fmt.Errorf("%s: %w", p.addr, ErrPoolTimeout)
+	case <-p.closed:
+		return nil, ErrPoolClosed
+	}
+
+	conn, err := p.checkout(deadline)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+	atomic.AddInt64(&p.inUse, 1)
+	return conn, nil
+}
+
+// checkout takes a live idle connection, or dials one if there is none
+func (p *connPool) checkout(deadline time.Time) (*poolConn, error) {
+	for {
+		select {
+		case conn := <-p.idle:
+			// A broken connection suggests the server restarted, so check
+			// the ones that were idle at the time too
+			suspect := conn.idleSince.UnixNano() <= atomic.LoadInt64(&p.brokenAt)
+			if (!suspect && time.Since(conn.idleSince) < idleCheck) || conn.ping() {
+				return conn, nil
+			}
+			conn.Close()
+		default:
+			return p.redial(deadline)
+		}
+	}
+}
+
+// redial dials a new connection once the backoff after earlier failures has
+// passed, failing straight away if that is beyond the deadline
+func (p *connPool) redial(deadline time.Time) (*poolConn, error) {
+	p.mu.Lock()
+	wait := time.Until(p.retryAt)
+	p.mu.Unlock()
+
+	if wait > 0 {
+		if time.Now().Add(wait).After(deadline) {
+			return nil, fmt.Errorf("%s unreachable, retrying in %v: %w", p.addr, wait.Round(time.Millisecond), ErrPoolTimeout)
+		}
+		select {
+		case <-time.After(wait):
+		case <-p.closed:
+			return nil, ErrPoolClosed
+		}
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", p.addr, err)
+	}
+	return conn, nil
+}
+
+// dial opens a connection, tracking failures for the backoff
+func (p *connPool) dial() (*poolConn, error) {
+	conn, err := net.DialTimeout("tcp", p.addr, dialTimeout)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		atomic.AddInt64(&p.dialFailures, 1)
+		backoff := maxBackoff
+		if p.failures < 10 {
+			backoff = min(minBackoff<<p.failures, maxBackoff)
+		}
+		p.failures++
+		p.retryAt = time.Now().Add(backoff)
+		return nil, err
+	}
+	p.failures = 0
+	p.retryAt = time.Time{}
+	return &poolConn{Conn: conn}, nil
+}
+
+// put returns a connection checked out with get. err is the outcome of the
+// work done on it: unless it shows the connection is still in step with the
+// server, the connection is closed instead, like one that broke.
+func (p *connPool) put(conn *poolConn, err error) {
+	atomic.AddInt64(&p.inUse, -1)
+	defer func() { <-p.slots }()
+
+	select {
+	case <-p.closed:
+		conn.Close()
+		return
+	default:
+	}
+	if conn.broken.Load() {
+		atomic.StoreInt64(&p.brokenAt, time.Now().UnixNano())
+		conn.Close()
+		return
+	}
+	if !inSync(err) {
+		// Only this connection is affected, so the others stay trusted
+		conn.Close()
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+	conn.idleSince = time.Now()
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// inSync reports whether a connection can be reused after an operation that
+// failed with err. Error replies are read in full, and the other outcomes
+// listed are only decided between complete replies with no WATCH left set.
+// Any other error may have left a reply partly read, or a watch in place.
+func inSync(err error) bool {
+	var reply resp.ReplyError
+	return err == nil || errors.As(err, &reply) ||
+		errors.Is(err, ErrConditionFailed) || errors.Is(err, ErrConsumed) ||
+		errors.Is(err, ErrMemoryLimit) || errors.Is(err, ErrLockHeld) || errors.Is(err, ErrNotLockHolder) ||
+		errors.Is(err, ErrTxnAborted)
+}
+
+// close closes idle connections now and checked out ones as they are returned
+func (p *connPool) close() {
+	p.closeOnce.Do(func() { close(p.closed) })
+	for {
+		select {
+		case conn := <-p.idle:
+			if err := conn.Close(); err != nil {
+				fmt.Printf("[warning] error closing connection to %s: %v\n", p.addr, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *connPool) stats() PoolStats {
+	return PoolStats{
+		Addr:         p.addr,
+		MaxConns:     cap(p.slots),
+		InUse:        atomic.LoadInt64(&p.inUse),
+		Idle:         len(p.idle),
+		DialFailures: atomic.LoadInt64(&p.dialFailures),
+	}
+}
+
+// PoolStats reports the primary's connection pool followed by each replica's
+func (rs *RespServer) PoolStats() []PoolStats {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	stats := []PoolStats{rs.primaryPool.stats()}
+	for _, replica := range rs.replicas {
+		stats = append(stats, replica.stats())
+	}
+	return stats
+}
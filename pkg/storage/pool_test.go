@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// startBulkServer starts a RESP server that answers every command with the
+// same bulk string, counting the connections it accepts
+func startBulkServer(t *testing.T, accepted *atomic.Int64) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				reader := resp.NewReader(conn)
+				for {
+					if _, err := reader.ReadValue(); err != nil {
+						return
+					}
+					conn.Write([]byte("$5\r\nhello\r\n"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPoolDiscardsConnOutOfStep(t *testing.T) {
+	var accepted atomic.Int64
+	rs, err := NewRespServer(startBulkServer(t, &accepted), 1, nil)
+	if err != nil {
+		t.Fatalf("NewRespServer returned an error: %v", err)
+	}
+	defer rs.Close()
+
+	// Reading a bulk reply as an integer leaves the rest of it unread
+	if _, err := rs.doInt("GET", "key"); err == nil {
+		t.Fatalf("Expected reading a bulk reply as an integer to fail")
+	}
+
+	// so the next caller must get a fresh connection, not the leftovers
+	res, err := rs.do("GET", "key")
+	if err != nil || string(toBytes(res)) != "hello" {
+		t.Fatalf("Expected hello on a fresh connection, got %v, %v", res, err)
+	}
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("Expected 2 connections, got %d", n)
+	}
+	if stats := rs.primaryPool.stats(); stats.Idle != 1 || stats.InUse != 0 {
+		t.Errorf("Unexpected pool stats %+v", stats)
+	}
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// Message is a pub/sub message delivered to a pattern subscription
+type Message struct {
+	Pattern string // pattern that matched the channel
+	Channel string
+	Payload []byte
+}
+
+// Publish sends message to channel on the primary and forwards it to each
+// replica, so subscribers connected to other cluster nodes receive it too. It
+// returns the number of subscribers on the primary that received it.
+func (rs *RespServer) Publish(channel, message string) (int64, error) {
+	receivers, err := rs.doInt("PUBLISH", channel, message)
+	if err != nil {
+		return 0, fmt.Errorf("primary publish failed: %w", err)
+	}
+
+	rs.replicate([]string{"PUBLISH", channel, message})
+
+	return receivers, nil
+}
+
+// PublishBatch sends several messages in one pipeline to the primary and to
+// each replica
+func (rs *RespServer) PublishBatch(msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	cmds := make([][]string, len(msgs))
+	for i, msg := range msgs {
+		cmds[i] = []string{"PUBLISH", msg.Channel, string(msg.Payload)}
+	}
+
+	if _, err := rs.pipeline(cmds...); err != nil {
+		return fmt.Errorf("primary publish failed: %w", err)
+	}
+
+	rs.replicate(cmds...)
+
+	return nil
+}
+
+// EnableExpiryEvents turns on the primary's keyevent notifications for
+// expired keys, keeping any notification classes already enabled
+func (rs *RespServer) EnableExpiryEvents() error {
+	res, err := rs.do("CONFIG", "GET", "notify-keyspace-events")
+	if err != nil {
+		return fmt.Errorf("failed to read notification config: %w", err)
+	}
+
+	var flags string
+	if values, ok := res.([]interface{}); ok && len(values) == 2 {
+		flags = string(toBytes(values[1]))
+	}
+
+	// E enables keyevent channels; x (or A, all classes) covers expirations
+	enabled := flags
+	if !strings.Contains(enabled, "E") {
+		enabled += "E"
+	}
+	if !strings.ContainsAny(enabled, "xA") {
+		enabled += "x"
+	}
+	if enabled == flags {
+		return nil
+	}
+
+	if _, err := rs.do("CONFIG", "SET", "notify-keyspace-events", enabled); err != nil {
+		return fmt.Errorf("failed to enable expiry notifications: %w", err)
+	}
+	return nil
+}
+
+// Subscriber holds a dedicated primary connection in subscribe mode. Pooled
+// connections cannot be used because a subscribed connection only accepts
+// subscription commands.
+type Subscriber struct {
+	conn     net.Conn
+	mu       sync.Mutex // serializes subscription changes
+	messages chan Message
+	acks     chan struct{}
+	done     chan struct{}
+}
+
+// NewSubscriber opens a dedicated connection to the primary for pattern
+// subscriptions
+func (rs *RespServer) NewSubscriber() (*Subscriber, error) {
+	conn, err := net.DialTimeout("tcp", rs.primaryPool.addr, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open subscriber connection: %w", err)
+	}
+
+	sub := &Subscriber{
+		conn:     conn,
+		messages: make(chan Message, 256),
+		acks:     make(chan struct{}, 16),
+		done:     make(chan struct{}),
+	}
+	go sub.readLoop()
+	return sub, nil
+}
+
+// PSubscribe subscribes the connection to the given channel patterns. It
+// returns once the primary has confirmed every pattern, so messages published
+// afterwards are guaranteed to be received.
+func (sub *Subscriber) PSubscribe(patterns ...string) error {
+	return sub.send("PSUBSCRIBE", patterns)
+}
+
+// PUnsubscribe removes the given channel patterns from the connection
+func (sub *Subscriber) PUnsubscribe(patterns ...string) error {
+	return sub.send("PUNSUBSCRIBE", patterns)
+}
+
+func (sub *Subscriber) send(cmd string, patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if _, err := resp.WritePipeline(sub.conn, append([]string{cmd}, patterns...)); err != nil {
+		return fmt.Errorf("write error: %w", err)
+	}
+
+	// The primary confirms each pattern separately
+	for range patterns {
+		select {
+		case <-sub.acks:
+		case <-sub.done:
+			return fmt.Errorf("subscriber connection closed")
+		}
+	}
+	return nil
+}
+
+// Messages returns the channel of received messages. It is closed when the
+// connection fails or the subscriber is closed.
+func (sub *Subscriber) Messages() <-chan Message {
+	return sub.messages
+}
+
+// Close closes the subscriber connection
+func (sub *Subscriber) Close() error {
+	return sub.conn.Close()
+}
+
+func (sub *Subscriber) readLoop() {
+	defer close(sub.messages)
+	defer close(sub.done)
+
+	reader := resp.NewReader(sub.conn)
+	for {
+		value, err := reader.ReadValue()
+		if err != nil {
+			return
+		}
+
+		// Pattern messages arrive as [pmessage, pattern, channel, payload] and
+		// confirmations as [psubscribe|punsubscribe, pattern, count]
+		push, ok := value.([]interface{})
+		if !ok || len(push) == 0 {
+			continue
+		}
+		switch kind := string(toBytes(push[0])); {
+		case kind == "psubscribe" || kind == "punsubscribe":
+			sub.acks <- struct{}{}
+			continue
+		case kind != "pmessage" || len(push) != 4:
+			continue
+		}
+
+		sub.messages <- Message{
+			Pattern: string(toBytes(push[1])),
+			Channel: string(toBytes(push[2])),
+			Payload: toBytes(push[3]),
+		}
+	}
+}
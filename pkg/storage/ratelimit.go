@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// rateLimitRetries bounds how often RateLimit retries after losing a race with
+// a concurrent caller on the same key
+const rateLimitRetries = 16
+
+// RateLimitResult is the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int64         // requests of cost 1 still allowed right now
+	ResetAfter time.Duration // until the limit is fully replenished
+	RetryAfter time.Duration // until the request would be allowed; 0 if it was
+}
+
+// RateLimit charges cost against a token bucket at key that holds up to limit
+// tokens and refills completely over window. The bucket is stored as the
+// theoretical arrival time of the next request (GCRA), read and written under
+// WATCH using the primary's clock, so every node sharing the primary enforces
+// the same limit. Denied requests are not charged.
+func (rs *RespServer) RateLimit(key string, limit int64, window time.Duration, cost int64) (RateLimitResult, error) {
+	for i := 0; i < rateLimitRetries; i++ {
+		result, tat, err := rs.rateLimitOnce(key, limit, window, cost)
+		if err == ErrConditionFailed {
+			continue
+		}
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+
+		if result.Allowed {
+			rs.replicate(rateLimitCmd(key, tat, result.ResetAfter))
+		}
+		return result, nil
+	}
+	return RateLimitResult{}, fmt.Errorf("rate limit for %s too contended", key)
+}
+
+// rateLimitOnce evaluates the limit once, returning ErrConditionFailed if the
+// bucket changed before the update could be written. On success it also
+// returns the new arrival time in microseconds.
+func (rs *RespServer) rateLimitOnce(key string, limit int64, window time.Duration, cost int64) (_ RateLimitResult, _ int64, err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return RateLimitResult{}, 0, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	reader := resp.NewReader(conn)
+	read := resp.NewPipeline(
+		[]string{"WATCH", key},
+		[]string{"GET", key},
+		[]string{"TIME"},
+	)
+	if _, err := read.Execute(conn); err != nil {
+		return RateLimitResult{}, 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if !reader.IsOK() {
+		reader.ReadValue()
+		reader.ReadValue()
+		return RateLimitResult{}, 0, fmt.Errorf("primary watch not OK")
+	}
+	stored, err := reader.ReadValue()
+	clock, clockErr := reader.ReadValue()
+	if err == nil {
+		err = clockErr
+	}
+	var now int64
+	if err == nil {
+		now, err = parseTime(clock)
+	}
+	if err != nil {
+		return RateLimitResult{}, 0, unwatch(conn, reader, fmt.Errorf("primary read failed: %w", err))
+	}
+
+	// Each token is worth interval; a full bucket spans the window
+	windowUs := window.Microseconds()
+	interval := windowUs / limit
+	if interval == 0 {
+		interval = 1
+	}
+
+	// A missing bucket is full; a stale arrival time counts from now
+	tat := parseVersion(stored)
+	if tat < now {
+		tat = now
+	}
+	next := tat + cost*interval
+
+	if next-now > windowUs {
+		return RateLimitResult{
+			Remaining:  max(windowUs-(tat-now), 0) / interval,
+			ResetAfter: time.Duration(tat-now) * time.Microsecond,
+			RetryAfter: time.Duration(next-windowUs-now) * time.Microsecond,
+		}, 0, unwatch(conn, reader, nil)
+	}
+
+	result := RateLimitResult{
+		Allowed:    true,
+		Remaining:  (windowUs - (next - now)) / interval,
+		ResetAfter: time.Duration(next-now) * time.Microsecond,
+	}
+
+	cmds := [][]string{rateLimitCmd(key, next, result.ResetAfter)}
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return RateLimitResult{}, 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return RateLimitResult{}, 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if results == nil {
+		return RateLimitResult{}, 0, ErrConditionFailed
+	}
+	if err := firstError(results); err != nil {
+		return RateLimitResult{}, 0, err
+	}
+
+	return result, next, nil
+}
+
+// rateLimitCmd stores a bucket's arrival time until the bucket is full again
+func rateLimitCmd(key string, tat int64, ttl time.Duration) []string {
+	ms := (ttl + time.Millisecond - 1) / time.Millisecond
+	if ms < 1 {
+		ms = 1
+	}
+	return []string{"SET", key, strconv.FormatInt(tat, 10), "PX", strconv.FormatInt(int64(ms), 10)}
+}
+
+// parseTime converts a TIME reply into microseconds since the epoch
+func parseTime(value interface{}) (int64, error) {
+	parts, ok := value.([]interface{})
+	if !ok || len(parts) != 2 {
+		return 0, fmt.Errorf("unexpected TIME reply %T", value)
+	}
+	sec, err := strconv.ParseInt(string(toBytes(parts[0])), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected TIME reply: %w", err)
+	}
+	usec, err := strconv.ParseInt(string(toBytes(parts[1])), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected TIME reply: %w", err)
+	}
+	return sec*1e6 + usec, nil
+}
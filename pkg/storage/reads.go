@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// consumeRetries bounds how often a read of a read-limited key retries after
+// losing a race with a concurrent reader
+const consumeRetries = 16
+
+// ErrConsumed is returned when reading a read-limited key whose permitted
+// reads have all been used
+var ErrConsumed = errors.New("value already consumed")
+
+// readsKey holds the reads left for a read-limited key. Once the last read
+// deletes the value it stays behind at 0 until the value would have expired,
+// so later reads report ErrConsumed rather than a missing key.
+func readsKey(key string) string {
+	return metaPrefix + "reads:" + key
+}
+
+// readLimitCmds returns the commands that limit a freshly written value to
+// maxReads reads, or nothing if maxReads is not positive
+func readLimitCmds(key string, ttl int, maxReads int) [][]string {
+	if maxReads <= 0 {
+		return nil
+	}
+	return [][]string{{"SET", readsKey(key), strconv.Itoa(maxReads), "EX", strconv.Itoa(ttl)}}
+}
+
+// replicaSetExLimitedCmds is replicaSetExCmds followed by the read limit
+func replicaSetExLimitedCmds(key string, ttl int, value string, version int64, maxReads int) [][]string {
+	return append(replicaSetExCmds(key, ttl, value, version), readLimitCmds(key, ttl, maxReads)...)
+}
+
+// consume reads a read-limited key and spends one of its reads. The reads
+// counter is watched between the read and the MULTI that decrements it, or
+// deletes the value on the last read, so concurrent readers can never share
+// a read. Replicas receive the resulting counter rather than the decrement.
+func (rs *RespServer) consume(key string) (Item, error) {
+	for i := 0; i < consumeRetries; i++ {
+		item, err := rs.consumeOnce(key)
+		if err == ErrConditionFailed {
+			continue
+		}
+		return item, err
+	}
+	return Item{}, fmt.Errorf("reads of %s too contended", key)
+}
+
+func (rs *RespServer) consumeOnce(key string) (_ Item, err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return Item{}, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	reader := resp.NewReader(conn)
+	watch := resp.NewPipeline(
+		[]string{"WATCH", key, readsKey(key)},
+		[]string{"MGET", key, versionKey(key), readsKey(key)},
+	)
+	if _, err := watch.Execute(conn); err != nil {
+		return Item{}, fmt.Errorf("primary read failed: %w", err)
+	}
+	if !reader.IsOK() {
+		reader.ReadValue()
+		return Item{}, fmt.Errorf("primary watch not OK")
+	}
+	res, err := reader.ReadValue()
+	if err != nil {
+		return Item{}, unwatch(conn, reader, fmt.Errorf("primary read failed: %w", err))
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 3 {
+		return Item{}, unwatch(conn, reader, fmt.Errorf("unexpected MGET reply %T", res))
+	}
+
+	item := Item{Value: values[0], Version: parseVersion(values[1]), Limited: true}
+	reads := toBytes(values[2])
+	left, err := strconv.ParseInt(string(reads), 10, 64)
+	switch {
+	case reads == nil:
+		// The limit was lifted by a write since the key was first read
+		item.Limited = false
+	case err != nil:
+		return Item{}, unwatch(conn, reader, fmt.Errorf("invalid read limit for %s", key))
+	case left <= 0:
+		return Item{}, unwatch(conn, reader, ErrConsumed)
+	}
+	if !item.Limited || toBytes(item.Value) == nil {
+		return item, unwatch(conn, reader, nil)
+	}
+
+	item.ReadsLeft = left - 1
+	var cmds [][]string
+	if item.ReadsLeft == 0 {
+		cmds = [][]string{
+			{"DEL", key},
+			{"SET", readsKey(key), "0", "KEEPTTL"},
+		}
+	} else {
+		cmds = [][]string{{"SET", readsKey(key), strconv.FormatInt(item.ReadsLeft, 10), "KEEPTTL"}}
+	}
+
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return Item{}, fmt.Errorf("primary write failed: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return Item{}, fmt.Errorf("primary write failed: %w", err)
+	}
+	if results == nil {
+		// Another reader or a writer got there first
+		return Item{}, ErrConditionFailed
+	}
+	if err := firstError(results); err != nil {
+		return Item{}, fmt.Errorf("primary write failed: %w", err)
+	}
+
+	rs.replicate(wrapMulti(cmds)...)
+
+	return item, nil
+}
@@ -2,40 +2,66 @@ package storage
 
 import (
 	"fmt"
-	"net"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/we-be/tritium/internal/resp"
 )
 
-type connPool struct {
-	conns chan net.Conn
-	addr  string
+// metaPrefix marks keys that hold Tritium's own bookkeeping rather than user data
+const metaPrefix = "__tritium:"
+
+// IsMetaKey reports whether key is reserved for Tritium's bookkeeping, such as
+// versions, read counts and lock owners. Clients must never reach these keys.
+func IsMetaKey(key string) bool {
+	return strings.HasPrefix(key, metaPrefix)
 }
 
-func newConnPool(addr string, maxConn int) (*connPool, error) {
-	pool := &connPool{
-		conns: make(chan net.Conn, maxConn),
-		addr:  addr,
+// metaKeys returns the bookkeeping keys that must follow keys on delete and
+// expiry changes. Version keys are not among them, as they outlive the value.
+func metaKeys(keys ...string) []string {
+	meta := make([]string, 0, 5*len(keys))
+	for _, key := range keys {
+		meta = append(meta, inflightKey(key), leaseKey(key), deadlineKey(key), readsKey(key), historyKey(key))
 	}
+	return meta
+}
 
-	// Initialize connections
-	for i := 0; i < maxConn; i++ {
-		conn, err := net.Dial("tcp", addr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create connection %d: %w", i, err)
-		}
-		pool.conns <- conn
-	}
+// Entry is a single key/value write used by batch operations
+type Entry struct {
+	Key   string
+	Value string
+	TTL   int // TTL in seconds
+}
+
+// Item is a value read from the store along with its version. Value is nil
+// when the key does not exist.
+type Item struct {
+	Value   interface{}
+	Version int64
 
-	return pool, nil
+	Limited   bool  // whether the value has a read limit
+	ReadsLeft int64 // reads left after this one, for read-limited values
+	Err       error // ErrConsumed if a read-limited value was used up
+}
+
+// WriteResult is the outcome of a single write in a batch
+type WriteResult struct {
+	Version int64
+	Err     error
 }
 
 type RespServer struct {
 	primaryPool *connPool
 	replicas    []*connPool
 	mu          sync.RWMutex
+
+	memoryLimit    int64 // as last set with SetMemoryLimit
+	evictionPolicy EvictionPolicy
+	sealer         Sealer        // nil if values are stored in plaintext
+	autoPipeline   *autoPipeline // nil unless pipelining is enabled
+	ordered        keyLocks      // keys whose replication must follow the primary's order
 }
 
 func NewRespServer(addr string, maxConn int, replicaAddrs []string) (*RespServer, error) {
@@ -62,31 +88,510 @@ func NewRespServer(addr string, maxConn int, replicaAddrs []string) (*RespServer
 	return rs, nil
 }
 
-func (rs *RespServer) SetEx(key string, ttl int, value string) (int, error) {
-	// Get connection from pool
-	conn := <-rs.primaryPool.conns
-	defer func() { rs.primaryPool.conns <- conn }()
+// SetEx writes value with a TTL in seconds and bumps the key's version in the
+// same transaction, returning the new version
+func (rs *RespServer) SetEx(key string, ttl int, value string) (int64, error) {
+	value, err := rs.seal(key, value)
+	if err != nil {
+		return 0, err
+	}
 
-	reader := resp.NewReader(conn)
-	cmd := resp.NewCommand("SETEX", key, strconv.Itoa(ttl), value)
+	results, err := rs.multi(setExCmds(key, ttl, value)...)
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+
+	version, err := versionResult(results)
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+
+	rs.replicate(replicaSetExCmds(key, ttl, value, version)...)
+
+	return version, nil
+}
+
+// Get reads a key and its version from the primary
+func (rs *RespServer) Get(key string) (Item, error) {
+	items, err := rs.MGet(key)
+	if err != nil {
+		return Item{}, err
+	}
+	return items[0], items[0].Err
+}
+
+// MGet fetches several keys and their versions from the primary in a single
+// MGET. The result has one item per key, with a nil value for missing keys.
+// Read-limited keys are then read one by one, each spending one of its reads.
+func (rs *RespServer) MGet(keys ...string) ([]Item, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	args := make([]string, 0, 3*len(keys)+1)
+	args = append(args, "MGET")
+	for _, key := range keys {
+		args = append(args, key, versionKey(key), readsKey(key))
+	}
+
+	res, err := rs.do(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 3*len(keys) {
+		return nil, fmt.Errorf("unexpected MGET reply %T", res)
+	}
+
+	items := make([]Item, len(keys))
+	for i, key := range keys {
+		if toBytes(values[3*i+2]) == nil {
+			items[i] = Item{Value: values[3*i], Version: parseVersion(values[3*i+1])}
+		} else if items[i], err = rs.consume(key); err != nil {
+			// Reads already spent on other keys must not be lost to an error here
+			items[i] = Item{Err: err}
+			continue
+		}
+
+		if items[i].Value, err = rs.open(key, items[i].Value); err != nil {
+			items[i] = Item{Err: err}
+		}
+	}
+	return items, nil
+}
+
+// MSetEx writes every entry with its own TTL as one MULTI/EXEC block, pipelined
+// to the primary and then to each replica. The returned slice holds the
+// per-entry version or error.
+func (rs *RespServer) MSetEx(entries []Entry) ([]WriteResult, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	sealed := make([]Entry, len(entries))
+	var cmds [][]string
+	for i, e := range entries {
+		value, err := rs.seal(e.Key, e.Value)
+		if err != nil {
+			return nil, err
+		}
+		sealed[i] = Entry{Key: e.Key, Value: value, TTL: e.TTL}
+		cmds = append(cmds, setExCmds(e.Key, e.TTL, value)...)
+	}
+	entries = sealed
+	span := len(cmds) / len(entries)
+
+	results, err := rs.multi(cmds...)
+	if err != nil {
+		return nil, fmt.Errorf("primary write failed: %w", err)
+	}
 
-	// Write to primary
-	nBytes, err := cmd.Execute(conn)
+	writes := make([]WriteResult, len(entries))
+	replicaCmds := make([][]string, 0, len(entries)*2)
+	for i, e := range entries {
+		version, err := versionResult(results[span*i : span*(i+1)])
+		if err != nil {
+			writes[i].Err = err
+			continue
+		}
+		writes[i].Version = version
+		replicaCmds = append(replicaCmds, replicaSetExCmds(e.Key, e.TTL, e.Value, version)...)
+	}
+
+	if len(replicaCmds) > 0 {
+		rs.replicate(wrapMulti(replicaCmds)...)
+	}
+
+	return writes, nil
+}
+
+// IncrBy atomically adds delta to the integer stored at key and returns the new
+// value. If ttl is positive and the key does not exist yet, the counter is
+// created with that TTL in the same transaction; an existing counter keeps its
+// TTL. Each increment bumps the key's version like any other write. Replicas
+// receive the resulting value and version rather than the increment so they
+// cannot drift, in the order the primary applied the increments.
+func (rs *RespServer) IncrBy(key string, delta int64, ttl int) (int64, error) {
+	if err := rs.checkSealable(); err != nil {
+		return 0, err
+	}
+
+	unlock := rs.lockReplication(key)
+	defer unlock()
+
+	results, err := rs.multi(incrByCmds(key, delta, ttl)...)
 	if err != nil {
 		return 0, fmt.Errorf("primary write failed: %w", err)
 	}
+	value, version, created, err := incrByResult(results, ttl)
+	if err != nil {
+		return 0, fmt.Errorf("primary increment failed: %w", err)
+	}
+
+	rs.replicate(wrapMulti(replicaIncrByCmds(key, ttl, value, version, created))...)
+
+	return value, nil
+}
+
+// incrByCmds returns the commands that add delta to the counter at key and
+// bump its version. With a positive ttl a missing counter is created with that
+// TTL first, and the version is kept at least as long.
+func incrByCmds(key string, delta int64, ttl int) [][]string {
+	cmds := [][]string{
+		{"INCRBY", key, strconv.FormatInt(delta, 10)},
+		{"INCR", versionKey(key)},
+	}
+	if ttl > 0 {
+		// NX leaves existing counters and their TTL alone
+		create := []string{"SET", key, "0", "EX", strconv.Itoa(ttl), "NX"}
+		cmds = append([][]string{create}, cmds...)
+		cmds = append(cmds, []string{"EXPIRE", versionKey(key), versionTTL(ttl)})
+	}
+	return cmds
+}
+
+// incrByResult extracts the new value and version from the EXEC results of
+// incrByCmds, and whether the counter was created
+func incrByResult(results []interface{}, ttl int) (value, version int64, created bool, err error) {
+	if err := firstError(results); err != nil {
+		return 0, 0, false, err
+	}
+	if ttl > 0 {
+		created = results[0] == "OK"
+		results = results[1:]
+	}
+	value, ok := results[0].(int64)
+	if !ok {
+		return 0, 0, false, fmt.Errorf("unexpected INCRBY reply %T", results[0])
+	}
+	version, ok = results[1].(int64)
+	if !ok {
+		return 0, 0, false, fmt.Errorf("unexpected version reply %T", results[1])
+	}
+	return value, version, created, nil
+}
+
+// replicaIncrByCmds returns the commands that set a replica's counter and
+// version to the primary's, with the counter's TTL only if it was created
+func replicaIncrByCmds(key string, ttl int, value, version int64, created bool) [][]string {
+	set := []string{"SET", key, strconv.FormatInt(value, 10), "KEEPTTL"}
+	if created {
+		set = []string{"SET", key, strconv.FormatInt(value, 10), "EX", strconv.Itoa(ttl)}
+	}
+	setVersion := []string{"SET", versionKey(key), strconv.FormatInt(version, 10), "KEEPTTL"}
+	if ttl > 0 {
+		setVersion = []string{"SET", versionKey(key), strconv.FormatInt(version, 10), "EX", versionTTL(ttl)}
+	}
+	return [][]string{set, setVersion}
+}
+
+// Delete removes keys from the primary and every replica, returning the keys
+// the primary actually removed. The chunks of streamed values are deleted in
+// the same transaction, with the manifests watched so a concurrent commit
+// cannot leave chunks behind.
+func (rs *RespServer) Delete(keys ...string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	for i := 0; i < streamRetries; i++ {
+		deleted, err := rs.deleteOnce(keys)
+		if err == ErrConditionFailed {
+			continue
+		}
+		return deleted, err
+	}
+	return nil, fmt.Errorf("deletes of %d keys too contended", len(keys))
+}
+
+func (rs *RespServer) deleteOnce(keys []string) (_ []string, err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	reader := resp.NewReader(conn)
+	manifests, err := watchManifests(conn, reader, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("primary delete failed: %w", err)
+	}
+
+	// One DEL per key so the results show which keys existed
+	cmds := make([][]string, 0, 2*len(keys)+1)
+	for _, key := range keys {
+		cmds = append(cmds, []string{"DEL", key})
+	}
+	cmds = append(cmds, append([]string{"DEL"}, metaKeys(keys...)...))
+	for i, key := range keys {
+		cmds = append(cmds, []string{"EXPIRE", versionKey(key), strconv.Itoa(versionTombstone)})
+		if manifests[i] != nil {
+			cmds = append(cmds, append([]string{"DEL"}, chunkKeys(key, *manifests[i])...))
+		}
+	}
+
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return nil, fmt.Errorf("primary delete failed: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return nil, fmt.Errorf("primary delete failed: %w", err)
+	}
+	if results == nil {
+		// A stream was committed since its manifest was read
+		return nil, ErrConditionFailed
+	}
+
+	var deleted []string
+	for i, key := range keys {
+		n, ok := results[i].(int64)
+		if !ok {
+			return nil, fmt.Errorf("primary delete failed: unexpected reply %v", results[i])
+		}
+		if n > 0 {
+			deleted = append(deleted, key)
+		}
+	}
+
+	rs.replicate(wrapMulti(cmds)...)
+
+	return deleted, nil
+}
+
+// Scan runs one SCAN iteration on the primary starting at cursor and returns
+// the next cursor along with the matching keys. Tritium's bookkeeping keys are
+// never returned. A returned cursor of 0 means the iteration is complete.
+func (rs *RespServer) Scan(cursor uint64, pattern string, count int) (uint64, []string, error) {
+	args := []string{"SCAN", strconv.FormatUint(cursor, 10), "MATCH", pattern}
+	if count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(count))
+	}
+
+	res, err := rs.do(args...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	reply, ok := res.([]interface{})
+	if !ok || len(reply) != 2 {
+		return 0, nil, fmt.Errorf("unexpected SCAN reply %T", res)
+	}
+	next, err := strconv.ParseUint(string(toBytes(reply[0])), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid SCAN cursor: %w", err)
+	}
+	found, _ := reply[1].([]interface{})
+
+	keys := make([]string, 0, len(found))
+	for _, k := range found {
+		key := string(toBytes(k))
+		if strings.HasPrefix(key, metaPrefix) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return next, keys, nil
+}
+
+// TTL returns the remaining lifetime of key in seconds, -1 if the key has no
+// expiry and -2 if it does not exist
+func (rs *RespServer) TTL(key string) (int64, error) {
+	return rs.doInt("TTL", key)
+}
+
+// Expire sets a new TTL in seconds on key, reporting whether the key existed
+func (rs *RespServer) Expire(key string, ttl int) (bool, error) {
+	return rs.updateExpiry(key,
+		[]string{"EXPIRE", strconv.Itoa(ttl)},
+		[]string{"EXPIRE", versionTTL(ttl)})
+}
+
+// ExpireAt makes key expire at the given unix timestamp, reporting whether the
+// key existed
+func (rs *RespServer) ExpireAt(key string, unixTime int64) (bool, error) {
+	return rs.updateExpiry(key,
+		[]string{"EXPIREAT", strconv.FormatInt(unixTime, 10)},
+		[]string{"EXPIREAT", strconv.FormatInt(unixTime+versionTombstone, 10)})
+}
+
+// Persist removes the TTL from key, reporting whether a TTL was removed
+func (rs *RespServer) Persist(key string) (bool, error) {
+	return rs.updateExpiry(key, []string{"PERSIST"}, []string{"PERSIST"})
+}
+
+// updateExpiry runs the expiry command expiry against key and its metadata,
+// and versionExpiry against its version, on the primary and, if it took
+// effect, on every replica. Each command is given without its key.
+func (rs *RespServer) updateExpiry(key string, expiry, versionExpiry []string) (bool, error) {
+	cmd := expiry[0]
+	cmds := [][]string{append([]string{cmd, key}, expiry[1:]...)}
+	for _, meta := range metaKeys(key) {
+		cmds = append(cmds, append([]string{cmd, meta}, expiry[1:]...))
+	}
+	cmds = append(cmds, append([]string{versionExpiry[0], versionKey(key)}, versionExpiry[1:]...))
+
+	results, err := rs.multi(cmds...)
+	if err != nil {
+		return false, fmt.Errorf("primary %s failed: %w", cmd, err)
+	}
+	if updated, ok := results[0].(int64); !ok || updated == 0 {
+		return false, nil
+	}
+
+	rs.replicate(wrapMulti(cmds)...)
+
+	return true, nil
+}
+
+// toBytes converts a bulk or simple string reply to bytes
+func toBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return nil
+	}
+}
+
+// do executes a single command on the primary and returns the parsed reply
+func (rs *RespServer) do(args ...string) (interface{}, error) {
+	return rs.roundTrip([][]string{args}, func(reader *resp.Reader) (interface{}, error) {
+		res, err := reader.ReadValue()
+		return res, memoryError(err)
+	})
+}
+
+// multi runs cmds as one MULTI/EXEC transaction on the primary, written in a
+// single pipeline, and returns the EXEC results. Commands that failed inside the
+// transaction appear as error values in the result.
+func (rs *RespServer) multi(cmds ...[]string) ([]interface{}, error) {
+	res, err := rs.roundTrip(wrapMulti(cmds), func(reader *resp.Reader) (interface{}, error) {
+		results, err := readMulti(reader, len(cmds))
+		if err == nil && results == nil {
+			// Nothing here set a WATCH, so one was left on the connection
+			return nil, fmt.Errorf("transaction aborted by a stale WATCH")
+		}
+		return results, err
+	})
+	results, _ := res.([]interface{})
+	return results, err
+}
+
+// pipeline writes cmds to the primary in one call and returns their replies,
+// or the first error reply
+func (rs *RespServer) pipeline(cmds ...[]string) ([]interface{}, error) {
+	res, err := rs.roundTrip(cmds, func(reader *resp.Reader) (interface{}, error) {
+		// Read every reply even after an error so the connection stays in sync
+		var firstErr error
+		results := make([]interface{}, len(cmds))
+		for i := range cmds {
+			value, err := reader.ReadValue()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			results[i] = value
+		}
+		return results, memoryError(firstErr)
+	})
+	results, _ := res.([]interface{})
+	return results, err
+}
+
+// roundTrip writes cmds to the primary and consumes their replies with read,
+// on a shared connection when pipelining is enabled and on a pooled one
+// otherwise
+func (rs *RespServer) roundTrip(cmds [][]string, read func(*resp.Reader) (interface{}, error)) (_ interface{}, err error) {
+	if rs.autoPipeline != nil {
+		return rs.autoPipeline.send(cmds, read)
+	}
+
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	if _, err := conn.writePipeline(cmds...); err != nil {
+		return nil, fmt.Errorf("write error: %w", err)
+	}
+	return read(resp.NewReader(conn))
+}
+
+// wrapMulti surrounds cmds with MULTI and EXEC
+func wrapMulti(cmds [][]string) [][]string {
+	wrapped := make([][]string, 0, len(cmds)+2)
+	wrapped = append(wrapped, []string{"MULTI"})
+	wrapped = append(wrapped, cmds...)
+	return append(wrapped, []string{"EXEC"})
+}
+
+// readMulti consumes the replies to a MULTI block of n commands and returns the
+// EXEC results. A nil slice with no error means the transaction was aborted by WATCH.
+func readMulti(reader *resp.Reader, n int) ([]interface{}, error) {
+	// MULTI, then one QUEUED per command; a queueing error aborts the EXEC
+	var queueErr error
+	for i := 0; i <= n; i++ {
+		if _, err := reader.ReadValue(); err != nil && queueErr == nil {
+			queueErr = err
+		}
+	}
+
+	res, err := reader.ReadValue()
+	if queueErr != nil {
+		return nil, memoryError(queueErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected EXEC reply %T", res)
+	}
+	if results != nil && len(results) != n {
+		return nil, fmt.Errorf("expected %d EXEC results, got %d", n, len(results))
+	}
+	return results, nil
+}
+
+// unwatch clears the WATCH an operation set on conn before it gives up with
+// err, and returns err. A connection out of step with the server is not sent
+// UNWATCH, as put discards it instead.
+func unwatch(conn *poolConn, reader *resp.Reader, err error) error {
+	if inSync(err) {
+		resp.NewCommand("UNWATCH").ExecuteWithResponse(conn, reader)
+	}
+	return err
+}
+
+// doInt executes a single command on the primary that replies with an integer
+func (rs *RespServer) doInt(args ...string) (_ int64, err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
 
-	if !reader.IsOK() {
-		return 0, fmt.Errorf("primary write not OK")
+	reader := resp.NewReader(conn)
+	if _, err := conn.writePipeline(args); err != nil {
+		return 0, fmt.Errorf("write error: %w", err)
 	}
+	return reader.ReadInt()
+}
 
-	// Replicate to replicas asynchronously
+// replicate writes the given commands to every replica and waits for their
+// replies. Replica failures are logged rather than returned, since the primary
+// is the source of truth.
+func (rs *RespServer) replicate(cmds ...[]string) {
 	var wg sync.WaitGroup
 
 	// Use RLock when accessing replicas slice
 	rs.mu.RLock()
-	replicaCount := len(rs.replicas)
-	replicas := make([]*connPool, replicaCount)
+	replicas := make([]*connPool, len(rs.replicas))
 	copy(replicas, rs.replicas)
 	rs.mu.RUnlock()
 
@@ -95,56 +600,51 @@ func (rs *RespServer) SetEx(key string, ttl int, value string) (int, error) {
 		go func(pool *connPool) {
 			defer wg.Done()
 
-			replicaConn := <-pool.conns
-			defer func() { pool.conns <- replicaConn }()
-
-			replicaReader := resp.NewReader(replicaConn)
-			replicaCmd := resp.NewCommand("SETEX", key, strconv.Itoa(ttl), value)
-
-			if _, err := replicaCmd.Execute(replicaConn); err != nil {
+			replicaConn, err := pool.get()
+			if err != nil {
 				fmt.Printf("[warning] replica write failed on %s: %v\n", pool.addr, err)
 				return
 			}
+			// The first failure that may leave the connection out of step
+			var lost error
+			defer func() { pool.put(replicaConn, lost) }()
 
-			if !replicaReader.IsOK() {
-				fmt.Printf("[warning] replica write not OK on %s\n", pool.addr)
+			replicaReader := resp.NewReader(replicaConn)
+			for _, args := range cmds {
+				if _, err := replicaConn.writePipeline(args); err != nil {
+					fmt.Printf("[warning] replica write failed on %s: %v\n", pool.addr, err)
+					lost = err
+					return
+				}
+			}
+
+			// Drain every reply so the connection is clean for the next caller
+			for _, args := range cmds {
+				if _, err := replicaReader.ReadValue(); err != nil {
+					fmt.Printf("[warning] replica %s failed on %s: %v\n", args[0], pool.addr, err)
+					if inSync(lost) {
+						lost = err
+					}
+				}
 			}
 		}(replica)
 	}
 
 	// Wait for replicas to complete
 	wg.Wait()
-
-	return nBytes, nil
-}
-
-func (rs *RespServer) Get(key string) (interface{}, error) {
-	// Get connection from pool
-	conn := <-rs.primaryPool.conns
-	defer func() { rs.primaryPool.conns <- conn }()
-
-	reader := resp.NewReader(conn)
-	return resp.NewCommand("GET", key).ExecuteWithResponse(conn, reader)
 }
 
 func (rs *RespServer) Close() error {
-	// Close primary connections
-	for i := 0; i < cap(rs.primaryPool.conns); i++ {
-		conn := <-rs.primaryPool.conns
-		if err := conn.Close(); err != nil {
-			fmt.Printf("[warning] error closing primary connection: %v\n", err)
-		}
+	if rs.autoPipeline != nil {
+		rs.autoPipeline.close()
 	}
+	rs.primaryPool.close()
 
-	// Close replica connections
+	rs.mu.RLock()
 	for _, replica := range rs.replicas {
-		for i := 0; i < cap(replica.conns); i++ {
-			conn := <-replica.conns
-			if err := conn.Close(); err != nil {
-				fmt.Printf("[warning] error closing replica connection: %v\n", err)
-			}
-		}
+		replica.close()
 	}
+	rs.mu.RUnlock()
 
 	return nil
 }
@@ -158,8 +658,14 @@ func (rs *RespServer) AddReplica(addr string, maxConn int) error {
 
 	rs.mu.Lock()
 	rs.replicas = append(rs.replicas, replicaPool)
+	limit, limited := rs.memoryLimit, rs.evictionPolicy != ""
 	rs.mu.Unlock()
 
+	// Setting the limit again is harmless on the replicas that have it already
+	if limited {
+		rs.replicate(memoryLimitCmds(limit)...)
+	}
+
 	return nil
 }
 
@@ -170,13 +676,7 @@ func (rs *RespServer) RemoveReplica(addr string) error {
 
 	for i, replica := range rs.replicas {
 		if replica.addr == addr {
-			// Close all connections in the pool
-			for j := 0; j < cap(replica.conns); j++ {
-				conn := <-replica.conns
-				if err := conn.Close(); err != nil {
-					fmt.Printf("[warning] error closing replica connection: %v\n", err)
-				}
-			}
+			replica.close()
 
 			// Remove from slice
 			rs.replicas = append(rs.replicas[:i], rs.replicas[i+1:]...)
@@ -189,5 +689,5 @@ func (rs *RespServer) RemoveReplica(addr string) error {
 
 // GetMaxConnections returns the size of the connection pool
 func (rs *RespServer) GetMaxConnections() int {
-	return cap(rs.primaryPool.conns)
+	return cap(rs.primaryPool.slots)
 }
@@ -1,20 +1,574 @@
 package storage
 
 type SetArgs struct {
-	Key   string
-	Value []byte
-	TTL   *int // optional TTL in seconds
+	Namespace string // optional namespace declared in the server config; the same in every Args type below
+	Key       string
+	Value     []byte
+	TTL       *int // optional TTL in seconds
+
+	// Optional preconditions, checked atomically on the primary. A failed
+	// check is reported as ErrConditionFailed in SetReply.Error.
+	Condition SetCondition
+	IfValue   []byte // compare-and-swap on the current value
+	IfVersion *int64 // compare-and-swap on the current version
+
+	// Optional read limit. After MaxReads successful reads the value is
+	// deleted and further reads fail with ErrConsumed until it would have
+	// expired. Read-limited values are not kept in version history.
+	MaxReads int
 }
 
 type SetReply struct {
-	Error string
+	Version int64 // version of the key after the write
+	Error   string
 }
 
 type GetArgs struct {
-	Key string
+	Namespace string
+	Key       string
 }
 
 type GetReply struct {
+	Value     []byte
+	Version   int64
+	Limited   bool  // whether the value has a read limit
+	ReadsLeft int64 // reads left after this one, if Limited
+	Error     string
+}
+
+type MGetArgs struct {
+	Namespace string
+	Keys      []string
+}
+
+type MGetReply struct {
+	Values []GetReply // one result per requested key, in order
+	Error  string
+}
+
+type MSetArgs struct {
+	Entries []SetArgs
+}
+
+type MSetReply struct {
+	Results []SetReply // one result per entry, in order
+	Error   string
+}
+
+type IncrByArgs struct {
+	Namespace string
+	Key       string
+	Delta     int64
+	TTL       *int // optional TTL in seconds, applied only when the counter is created
+}
+
+type IncrByReply struct {
+	Value int64 // value after the increment
+	Error string
+}
+
+type DeleteArgs struct {
+	Namespace string
+	Keys      []string
+}
+
+type DeleteReply struct {
+	Deleted int // number of keys removed from the primary
+	Error   string
+}
+
+type TTLArgs struct {
+	Namespace string
+	Key       string
+}
+
+type TTLReply struct {
+	TTL   int // remaining seconds, -1 if the key never expires
+	Error string
+}
+
+type ExpireArgs struct {
+	Namespace string
+	Key       string
+	TTL       int // new TTL in seconds
+}
+
+type ExpireAtArgs struct {
+	Namespace string
+	Key       string
+	Timestamp int64 // unix time in seconds
+}
+
+type PersistArgs struct {
+	Namespace string
+	Key       string
+}
+
+type ExpireReply struct {
+	Updated bool
+	Error   string
+}
+
+type ScanArgs struct {
+	Namespace string
+	Pattern   string // glob pattern, e.g. "session:*"; empty matches every key
+	Cursor    uint64 // 0 to start a new iteration
+	Count     int    // optional hint for keys examined per call
+}
+
+type ScanReply struct {
+	Cursor uint64 // next cursor, 0 once the iteration is complete
+	Keys   []string
+	Error  string
+}
+
+// NamespaceInfo describes a declared namespace and its usage on the node
+type NamespaceInfo struct {
+	Name       string
+	DefaultTTL int
+	MaxTTL     int
+	MaxKeys    int64
+	MaxBytes   int64
+	History    int
+	Keys       int64 // keys written through this node and not yet expired
+	Bytes      int64 // bytes written through this node and not yet expired
+}
+
+type NamespacesReply struct {
+	Namespaces []NamespaceInfo
+	Error      string
+}
+
+type HSetArgs struct {
+	Namespace string
+	Key       string
+	Fields    map[string][]byte
+	TTL       *int // optional TTL in seconds for the whole hash
+}
+
+type HSetReply struct {
+	Added int // number of fields that did not exist before
+	Error string
+}
+
+type HGetArgs struct {
+	Namespace string
+	Key       string
+	Field     string
+}
+
+type HGetReply struct {
 	Value []byte
 	Error string
 }
+
+type HGetAllArgs struct {
+	Namespace string
+	Key       string
+}
+
+type HGetAllReply struct {
+	Fields map[string][]byte
+	Error  string
+}
+
+type HDelArgs struct {
+	Namespace string
+	Key       string
+	Fields    []string
+}
+
+type HDelReply struct {
+	Deleted int // number of fields removed
+	Error   string
+}
+
+type HIncrByArgs struct {
+	Namespace string
+	Key       string
+	Field     string
+	Delta     int64
+	TTL       *int // optional TTL in seconds for the whole hash
+}
+
+type PushArgs struct {
+	Namespace string
+	Key       string
+	Values    [][]byte
+	Front     bool // push to the head instead of the tail
+	TTL       *int // optional TTL in seconds for the whole list
+}
+
+type PushReply struct {
+	Length int // length of the list after the push
+	Error  string
+}
+
+type PopArgs struct {
+	Namespace string
+	Key       string
+	Back      bool // pop from the tail instead of the head
+	Timeout   int  // seconds BPop waits for an item; ignored by Pop
+
+	// If positive, the item is moved to an in-flight list and must be acked
+	// within this many seconds or it is returned to the queue
+	VisibilityTimeout int
+}
+
+type PopReply struct {
+	Value   []byte
+	Receipt string // set in reliable mode; pass to Ack
+	Error   string
+}
+
+type AckArgs struct {
+	Namespace string
+	Key       string
+	Receipt   string
+}
+
+type AckReply struct {
+	Error string
+}
+
+type LRangeArgs struct {
+	Namespace string
+	Key       string
+	Start     int64
+	Stop      int64 // inclusive; -1 for the last element
+}
+
+type LRangeReply struct {
+	Values [][]byte
+	Error  string
+}
+
+type LLenArgs struct {
+	Namespace string
+	Key       string
+}
+
+type LLenReply struct {
+	Length int
+	Error  string
+}
+
+// ScoredMember is a sorted set member with its score
+type ScoredMember struct {
+	Member []byte
+	Score  float64
+}
+
+type SAddArgs struct {
+	Namespace string
+	Key       string
+	Members   [][]byte
+	TTL       *int // optional TTL in seconds for the whole set
+}
+
+type SAddReply struct {
+	Added int // number of members that were not already in the set
+	Error string
+}
+
+type SRemArgs struct {
+	Namespace string
+	Key       string
+	Members   [][]byte
+}
+
+type SRemReply struct {
+	Removed int
+	Error   string
+}
+
+type SMembersArgs struct {
+	Namespace string
+	Key       string
+}
+
+type SMembersReply struct {
+	Members [][]byte
+	Error   string
+}
+
+type SIsMemberArgs struct {
+	Namespace string
+	Key       string
+	Member    []byte
+}
+
+type SIsMemberReply struct {
+	IsMember bool
+	Error    string
+}
+
+type ZAddArgs struct {
+	Namespace string
+	Key       string
+	Members   []ScoredMember
+	TTL       *int // optional TTL in seconds for the whole sorted set
+}
+
+type ZAddReply struct {
+	Added int // number of members that were not already in the set
+	Error string
+}
+
+type ZRemArgs struct {
+	Namespace string
+	Key       string
+	Members   [][]byte
+}
+
+type ZRemReply struct {
+	Removed int
+	Error   string
+}
+
+type ZIncrByArgs struct {
+	Namespace string
+	Key       string
+	Member    []byte
+	Delta     float64
+	TTL       *int // optional TTL in seconds for the whole sorted set
+}
+
+type ZIncrByReply struct {
+	Score float64 // score after the increment
+	Error string
+}
+
+type ZRangeArgs struct {
+	Namespace string
+	Key       string
+	Start     int64
+	Stop      int64 // inclusive; -1 for the last member
+	Reverse   bool  // highest score first
+}
+
+type ZRangeByScoreArgs struct {
+	Namespace string
+	Key       string
+	Min       float64 // inclusive; math.Inf(-1) for no lower bound
+	Max       float64 // inclusive; math.Inf(1) for no upper bound
+	Offset    int
+	Count     int // optional limit on returned members
+}
+
+type ZRangeReply struct {
+	Members []ScoredMember
+	Error   string
+}
+
+type PublishArgs struct {
+	Namespace string
+	Channel   string
+	Message   []byte
+}
+
+type PublishReply struct {
+	Receivers int // subscribers on the receiving node's backend
+	Error     string
+}
+
+type SubscribeArgs struct {
+	Namespace string
+	Patterns  []string // glob-style channel patterns, e.g. "orders.*"
+}
+
+type SubscribeReply struct {
+	SubscriptionID string
+	Error          string
+}
+
+type ReceiveArgs struct {
+	SubscriptionID string
+	Timeout        int // seconds to wait for a message before returning empty
+}
+
+type ReceiveReply struct {
+	Messages []Message
+	Error    string
+}
+
+type UnsubscribeArgs struct {
+	SubscriptionID string
+}
+
+type UnsubscribeReply struct {
+	Error string
+}
+
+// Watch event types, delivered as the payload of watch subscription messages
+// whose channel is the changed key
+const (
+	EventSet    = "set"
+	EventDelete = "delete"
+	EventExpire = "expire"
+	EventTTL    = "ttl"
+	EventPop    = "pop"
+)
+
+type WatchArgs struct {
+	Namespace string
+	Key       string // key to watch, or key prefix when Prefix is set
+	Prefix    bool
+}
+
+type TxnOpArgs struct {
+	Type  TxnOpType
+	Key   string
+	Value []byte // for TxnSet
+	Delta int64  // for TxnIncrBy
+	TTL   *int   // optional TTL in seconds for TxnSet, or for counters created by TxnIncrBy
+}
+
+type TxnWatchArgs struct {
+	Key     string
+	Version *int64 // optional expected version; 0 for never written
+}
+
+type TxnArgs struct {
+	Namespace string
+	Watch     []TxnWatchArgs
+	Ops       []TxnOpArgs
+}
+
+type TxnOpReply struct {
+	Version int64 // new version after a TxnSet
+	Value   int64 // new value after a TxnIncrBy
+	Deleted bool  // whether a TxnDelete removed an existing key
+	Error   string
+}
+
+type TxnReply struct {
+	Committed bool         // false if a watched key changed and nothing was applied
+	Results   []TxnOpReply // one per op when committed
+	Error     string
+}
+
+type LockArgs struct {
+	Namespace string
+	Key       string
+	Lease     int // lease in milliseconds
+}
+
+type LockReply struct {
+	Owner string // token required to renew or release the lock
+	Fence int64  // fencing token, higher than any issued for the lock before
+	Error string
+}
+
+type RenewArgs struct {
+	Namespace string
+	Key       string
+	Owner     string
+	Lease     int // new lease in milliseconds, counted from now
+}
+
+type RenewReply struct {
+	Error string
+}
+
+type UnlockArgs struct {
+	Namespace string
+	Key       string
+	Owner     string
+}
+
+type UnlockReply struct {
+	Error string
+}
+
+type RateLimitArgs struct {
+	Namespace string
+	Key       string
+	Limit     int // requests allowed per window
+	Window    int // window in milliseconds over which the limit fully replenishes
+	Cost      int // optional cost of this request; defaults to 1
+}
+
+type RateLimitReply struct {
+	Allowed    bool
+	Remaining  int // further requests of cost 1 allowed right now
+	ResetAfter int // milliseconds until the limit is fully replenished
+	RetryAfter int // milliseconds until this request would be allowed; 0 if it was
+	Error      string
+}
+
+type StreamChunkArgs struct {
+	Namespace string
+	Key       string
+	UploadID  string // hex ID chosen by the client, shared by all chunks of an upload
+	Index     int
+	Data      []byte
+	TTL       *int // optional TTL in seconds for the stream
+}
+
+type StreamChunkReply struct {
+	Error string
+}
+
+type StreamCommitArgs struct {
+	Namespace string
+	Key       string
+	UploadID  string
+	Chunks    int
+	Size      int64
+	Checksum  string // hex SHA-256 of the whole value
+	TTL       *int   // optional TTL in seconds for the stream
+}
+
+type StreamOpenReply struct {
+	UploadID string
+	Chunks   int
+	Size     int64
+	Checksum string // hex SHA-256 of the whole value
+	Version  int64
+	Error    string
+}
+
+type StreamReadArgs struct {
+	Namespace string
+	Key       string
+	UploadID  string // from StreamOpenReply
+	Index     int
+}
+
+type StreamReadReply struct {
+	Data  []byte
+	Error string
+}
+
+type GetVersionArgs struct {
+	Namespace string
+	Key       string
+	Version   int64
+}
+
+type GetVersionReply struct {
+	Value     []byte
+	Timestamp int64 // unix milliseconds when the version was written
+	TTL       int   // seconds left; -1 if the version never expires
+	Error     string
+}
+
+// VersionInfo describes one kept version of a key
+type VersionInfo struct {
+	Version   int64
+	Timestamp int64 // unix milliseconds when the version was written
+	TTL       int   // seconds left; -1 if the version never expires
+}
+
+type ListVersionsReply struct {
+	Versions []VersionInfo // newest first
+	Error    string
+}
+
+type RollbackArgs struct {
+	Namespace string
+	Key       string
+	Version   int64 // kept version whose value becomes current again
+	TTL       *int  // optional TTL in seconds
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// ErrNotSealable is returned for writes of data types that cannot be stored
+// sealed while a sealer is set
+var ErrNotSealable = errors.New("data type cannot be stored with sealed values")
+
+// Sealer encrypts values before they are written to the RESP server and
+// decrypts them after they are read. Each value is bound to the key it is
+// stored under, so a value copied to another key fails to open.
+type Sealer interface {
+	Seal(key string, value []byte) ([]byte, error)
+	Open(key string, sealed []byte) ([]byte, error)
+	// Overhead is how many bytes sealing adds to a value
+	Overhead() int
+}
+
+// SetSealer makes the server seal the values of keys, their kept versions,
+// stream chunks and lock owners, so the RESP server and its replicas only ever
+// hold ciphertext. Hashes, lists, sets, sorted sets and counters are operated
+// on by the RESP server itself and cannot be sealed, so writes to them fail
+// with ErrNotSealable. It must be called before the server is used.
+func (rs *RespServer) SetSealer(sealer Sealer) {
+	rs.sealer = sealer
+}
+
+// seal encrypts a value for key, or returns it as is without a sealer
+func (rs *RespServer) seal(key, value string) (string, error) {
+	if rs.sealer == nil {
+		return value, nil
+	}
+	// The sealer only reads the plaintext, so share its memory
+	plaintext := unsafe.Slice(unsafe.StringData(value), len(value))
+	sealed, err := rs.sealer.Seal(key, plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to seal value: %w", err)
+	}
+	return string(sealed), nil
+}
+
+// checkSealable rejects writes of data types that would be stored unsealed
+func (rs *RespServer) checkSealable() error {
+	if rs.sealer != nil {
+		return ErrNotSealable
+	}
+	return nil
+}
+
+// sealOverhead returns how many bytes sealing adds to each stored value
+func (rs *RespServer) sealOverhead() int64 {
+	if rs.sealer == nil {
+		return 0
+	}
+	return int64(rs.sealer.Overhead())
+}
+
+// open decrypts a value read from key, leaving missing values nil
+func (rs *RespServer) open(key string, value interface{}) (interface{}, error) {
+	sealed := toBytes(value)
+	if rs.sealer == nil || sealed == nil {
+		return value, nil
+	}
+	plaintext, err := rs.sealer.Open(key, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open value of %s: %w", key, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// SAdd adds members to the set at key, refreshing its TTL when ttl is
+// positive, and returns how many members were new
+func (rs *RespServer) SAdd(key string, members []string, ttl int) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	return rs.addMembers(append([]string{"SADD", key}, members...), key, ttl)
+}
+
+// SRem removes members from the set at key and returns how many were present
+func (rs *RespServer) SRem(key string, members ...string) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	return rs.removeMembers(append([]string{"SREM", key}, members...))
+}
+
+// SMembers returns every member of the set at key
+func (rs *RespServer) SMembers(key string) ([][]byte, error) {
+	res, err := rs.do("SMEMBERS", key)
+	if err != nil {
+		return nil, err
+	}
+
+	elems, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected SMEMBERS reply %T", res)
+	}
+
+	members := make([][]byte, len(elems))
+	for i, elem := range elems {
+		members[i] = toBytes(elem)
+	}
+	return members, nil
+}
+
+// SIsMember reports whether member belongs to the set at key
+func (rs *RespServer) SIsMember(key, member string) (bool, error) {
+	n, err := rs.doInt("SISMEMBER", key, member)
+	return n == 1, err
+}
+
+// ZAdd adds members with their scores to the sorted set at key, updating the
+// scores of existing members, and returns how many members were new
+func (rs *RespServer) ZAdd(key string, members []ScoredMember, ttl int) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	args := make([]string, 0, 2*len(members)+2)
+	args = append(args, "ZADD", key)
+	for _, m := range members {
+		args = append(args, formatScore(m.Score), string(m.Member))
+	}
+	return rs.addMembers(args, key, ttl)
+}
+
+// ZRem removes members from the sorted set at key and returns how many were present
+func (rs *RespServer) ZRem(key string, members ...string) (int64, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	return rs.removeMembers(append([]string{"ZREM", key}, members...))
+}
+
+// ZIncrBy atomically adds delta to the score of member in the sorted set at
+// key and returns the new score. If ttl is positive the set's TTL is
+// refreshed. Replicas receive the resulting score so they cannot drift, in the
+// order the primary applied the increments.
+func (rs *RespServer) ZIncrBy(key, member string, delta float64, ttl int) (float64, error) {
+	if err := rs.checkSealable(); err != nil {
+		return 0, err
+	}
+
+	unlock := rs.lockReplication(key)
+	defer unlock()
+
+	cmds := [][]string{{"ZINCRBY", key, formatScore(delta), member}}
+	if ttl > 0 {
+		cmds = append(cmds, []string{"EXPIRE", key, strconv.Itoa(ttl)})
+	}
+
+	results, err := rs.multi(cmds...)
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if err := firstError(results); err != nil {
+		return 0, fmt.Errorf("primary increment failed: %w", err)
+	}
+
+	score, err := strconv.ParseFloat(string(toBytes(results[0])), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ZINCRBY reply: %w", err)
+	}
+
+	replicaCmds := [][]string{{"ZADD", key, formatScore(score), member}}
+	replicaCmds = append(replicaCmds, cmds[1:]...)
+	rs.replicate(wrapMulti(replicaCmds)...)
+
+	return score, nil
+}
+
+// ZRange returns the members of the sorted set at key ranked between start and
+// stop inclusive, lowest score first or highest first if reverse is set
+func (rs *RespServer) ZRange(key string, start, stop int64, reverse bool) ([]ScoredMember, error) {
+	cmd := "ZRANGE"
+	if reverse {
+		cmd = "ZREVRANGE"
+	}
+	return rs.scoredMembers(cmd, key, strconv.FormatInt(start, 10), strconv.FormatInt(stop, 10), "WITHSCORES")
+}
+
+// ZRangeByScore returns the members of the sorted set at key with scores
+// between min and max inclusive, lowest first. A positive count limits the
+// result to count members after skipping offset.
+func (rs *RespServer) ZRangeByScore(key string, min, max float64, offset, count int) ([]ScoredMember, error) {
+	args := []string{key, formatScore(min), formatScore(max), "WITHSCORES"}
+	if count > 0 {
+		args = append(args, "LIMIT", strconv.Itoa(offset), strconv.Itoa(count))
+	}
+	return rs.scoredMembers("ZRANGEBYSCORE", args...)
+}
+
+// addMembers runs a member-adding command with an optional TTL refresh in one
+// transaction and replicates it
+func (rs *RespServer) addMembers(add []string, key string, ttl int) (int64, error) {
+	if err := rs.checkSealable(); err != nil {
+		return 0, err
+	}
+
+	cmds := [][]string{add}
+	if ttl > 0 {
+		cmds = append(cmds, []string{"EXPIRE", key, strconv.Itoa(ttl)})
+	}
+
+	results, err := rs.multi(cmds...)
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if err := firstError(results); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+
+	rs.replicate(wrapMulti(cmds)...)
+
+	added, _ := results[0].(int64)
+	return added, nil
+}
+
+// removeMembers runs a member-removing command and replicates it if it took effect
+func (rs *RespServer) removeMembers(args []string) (int64, error) {
+	removed, err := rs.doInt(args...)
+	if err != nil {
+		return 0, fmt.Errorf("primary delete failed: %w", err)
+	}
+
+	if removed > 0 {
+		rs.replicate(args)
+	}
+
+	return removed, nil
+}
+
+// scoredMembers runs a WITHSCORES range query and parses the member/score pairs
+func (rs *RespServer) scoredMembers(cmd string, args ...string) ([]ScoredMember, error) {
+	res, err := rs.do(append([]string{cmd}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	elems, ok := res.([]interface{})
+	if !ok || len(elems)%2 != 0 {
+		return nil, fmt.Errorf("unexpected %s reply %T", cmd, res)
+	}
+
+	members := make([]ScoredMember, 0, len(elems)/2)
+	for i := 0; i < len(elems); i += 2 {
+		score, err := strconv.ParseFloat(string(toBytes(elems[i+1])), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid score in %s reply: %w", cmd, err)
+		}
+		members = append(members, ScoredMember{Member: toBytes(elems[i]), Score: score})
+	}
+	return members, nil
+}
+
+// formatScore renders a score the way RESP servers parse it
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "+inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(score, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// MaxStreamChunks bounds the chunks of one streamed value, and with them the
+// commands that commit or delete it
+const MaxStreamChunks = 1 << 16
+
+// streamRetries bounds how often a commit or delete retries after the stream
+// it replaces changed under its WATCH
+const streamRetries = 16
+
+// Manifest describes a value stored as a sequence of chunk keys
+type Manifest struct {
+	UploadID string // identifies the chunk keys of this upload
+	Chunks   int
+	Size     int64
+	Checksum string // hex SHA-256 of the whole value
+}
+
+// validate checks that the chunk count is one an upload of m.Size bytes can
+// have, before anything is sized by it
+func (m Manifest) validate() error {
+	if m.Chunks <= 0 || m.Chunks > MaxStreamChunks || int64(m.Chunks) > m.Size {
+		return fmt.Errorf("invalid chunk count %d for %d bytes", m.Chunks, m.Size)
+	}
+	return nil
+}
+
+// chunkKey returns the key holding one chunk of an upload to key. Chunks are
+// written under a fresh upload ID so an upload never disturbs the chunks of
+// the manifest currently being read.
+func chunkKey(key, uploadID string, index int) string {
+	return metaPrefix + "chunk:" + key + ":" + uploadID + ":" + strconv.Itoa(index)
+}
+
+// chunkKeys returns the keys of every chunk of a manifest stored at key
+func chunkKeys(key string, m Manifest) []string {
+	keys := make([]string, m.Chunks)
+	for i := range keys {
+		keys[i] = chunkKey(key, m.UploadID, i)
+	}
+	return keys
+}
+
+// PutChunk stages one chunk of an upload with a TTL in seconds, so abandoned
+// uploads expire on their own
+func (rs *RespServer) PutChunk(key, uploadID string, index int, data string, ttl int) error {
+	ck := chunkKey(key, uploadID, index)
+	data, err := rs.seal(ck, data)
+	if err != nil {
+		return err
+	}
+
+	cmd := []string{"SETEX", ck, strconv.Itoa(ttl), data}
+	res, err := rs.do(cmd...)
+	if err != nil {
+		return fmt.Errorf("primary write failed: %w", err)
+	}
+	if res != "OK" {
+		return fmt.Errorf("primary write failed: unexpected reply %v", res)
+	}
+
+	rs.replicate(cmd)
+
+	return nil
+}
+
+// CommitStream checks that every chunk of an upload is present and adds up to
+// m.Size, then makes it the value of key by writing the manifest and bumping
+// the version in one transaction. The chunks of the manifest it replaces are
+// deleted in the same transaction.
+func (rs *RespServer) CommitStream(key string, m Manifest, ttl int) (int64, error) {
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+
+	cmds := make([][]string, m.Chunks)
+	for i := range cmds {
+		cmds[i] = []string{"STRLEN", chunkKey(key, m.UploadID, i)}
+	}
+	lengths, err := rs.pipeline(cmds...)
+	if err != nil {
+		return 0, fmt.Errorf("primary read failed: %w", err)
+	}
+
+	var size int64
+	for i, length := range lengths {
+		n, _ := length.(int64)
+		if n == 0 {
+			return 0, fmt.Errorf("chunk %d of upload %s is missing", i, m.UploadID)
+		}
+		size += n - rs.sealOverhead()
+	}
+	if size != m.Size {
+		return 0, fmt.Errorf("upload %s holds %d bytes, expected %d", m.UploadID, size, m.Size)
+	}
+
+	for i := 0; i < streamRetries; i++ {
+		version, err := rs.commitStreamOnce(key, m, ttl)
+		if err == ErrConditionFailed {
+			continue
+		}
+		return version, err
+	}
+	return 0, fmt.Errorf("commits to %s too contended", key)
+}
+
+func (rs *RespServer) commitStreamOnce(key string, m Manifest, ttl int) (_ int64, err error) {
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	reader := resp.NewReader(conn)
+	previous, err := watchManifests(conn, reader, key)
+	if err != nil {
+		return 0, fmt.Errorf("primary read failed: %w", err)
+	}
+
+	ttlArg := strconv.Itoa(ttl)
+	manifest := []string{
+		"HSET", key,
+		"upload", m.UploadID,
+		"chunks", strconv.Itoa(m.Chunks),
+		"size", strconv.FormatInt(m.Size, 10),
+		"checksum", m.Checksum,
+	}
+	write := [][]string{
+		{"DEL", key},
+		manifest,
+		{"EXPIRE", key, ttlArg},
+		{"INCR", versionKey(key)},
+		{"EXPIRE", versionKey(key), versionTTL(ttl)},
+	}
+	// Chunks were staged over time; align them with the manifest's expiry
+	for i := 0; i < m.Chunks; i++ {
+		write = append(write, []string{"EXPIRE", chunkKey(key, m.UploadID, i), ttlArg})
+	}
+	if previous[0] != nil && previous[0].UploadID != m.UploadID {
+		write = append(write, append([]string{"DEL"}, chunkKeys(key, *previous[0])...))
+	}
+
+	if _, err := conn.writePipeline(wrapMulti(write)...); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	results, err := readMulti(reader, len(write))
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if results == nil {
+		// The key changed since its manifest was read
+		return 0, ErrConditionFailed
+	}
+	if err := firstError(results); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	version, ok := results[3].(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected version reply %T", results[3])
+	}
+
+	replicaCmds := append([][]string{}, write[:3]...)
+	replicaCmds = append(replicaCmds, []string{"SET", versionKey(key), strconv.FormatInt(version, 10), "EX", versionTTL(ttl)})
+	replicaCmds = append(replicaCmds, write[5:]...)
+	rs.replicate(wrapMulti(replicaCmds)...)
+
+	return version, nil
+}
+
+// watchManifests WATCHes keys on conn and reads the upload and chunk count of
+// each, so a transaction that follows fails if any of them changes. Keys that
+// do not hold a stream get a nil manifest. On error the WATCH is cleared.
+func watchManifests(conn *poolConn, reader *resp.Reader, keys ...string) ([]*Manifest, error) {
+	cmds := [][]string{append([]string{"WATCH"}, keys...)}
+	for _, key := range keys {
+		cmds = append(cmds, []string{"HMGET", key, "upload", "chunks"})
+	}
+	if _, err := conn.writePipeline(cmds...); err != nil {
+		return nil, err
+	}
+
+	// Read every reply even after an error so the connection stays in sync
+	var firstErr error
+	manifests := make([]*Manifest, len(keys))
+	for i := range cmds {
+		res, err := reader.ReadValue()
+		var reply resp.ReplyError
+		switch {
+		case i > 0 && errors.As(err, &reply) && strings.HasPrefix(string(reply), "WRONGTYPE"):
+			// Plain values are not streams
+		case err != nil:
+			if firstErr == nil {
+				firstErr = err
+			}
+		case i > 0:
+			manifests[i-1] = parseChunks(res)
+		}
+	}
+	if firstErr != nil {
+		return nil, unwatch(conn, reader, firstErr)
+	}
+	return manifests, nil
+}
+
+// parseChunks converts an HMGET of a manifest's upload and chunks fields into a
+// manifest, or nil if they do not describe chunks this key could own
+func parseChunks(res interface{}) *Manifest {
+	fields, ok := res.([]interface{})
+	if !ok || len(fields) != 2 {
+		return nil
+	}
+	uploadID := string(toBytes(fields[0]))
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return nil
+	}
+	chunks, err := strconv.Atoi(string(toBytes(fields[1])))
+	if err != nil || chunks <= 0 || chunks > MaxStreamChunks {
+		return nil
+	}
+	return &Manifest{UploadID: uploadID, Chunks: chunks}
+}
+
+// GetManifest reads the manifest stored at key and its version, returning a
+// nil manifest if key does not hold a stream
+func (rs *RespServer) GetManifest(key string) (*Manifest, int64, error) {
+	results, err := rs.multi(
+		[]string{"HGETALL", key},
+		[]string{"GET", versionKey(key)},
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("primary read failed: %w", err)
+	}
+	if err, ok := results[0].(error); ok {
+		// Plain values are not streams
+		return nil, 0, fmt.Errorf("key does not hold a stream: %w", err)
+	}
+
+	pairs, _ := results[0].([]interface{})
+	if len(pairs) == 0 {
+		return nil, 0, nil
+	}
+
+	fields := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fields[string(toBytes(pairs[i]))] = string(toBytes(pairs[i+1]))
+	}
+
+	m := &Manifest{UploadID: fields["upload"], Checksum: fields["checksum"]}
+	m.Chunks, err = strconv.Atoi(fields["chunks"])
+	if err != nil || m.UploadID == "" {
+		return nil, 0, fmt.Errorf("key does not hold a stream")
+	}
+	m.Size, err = strconv.ParseInt(fields["size"], 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("key does not hold a stream")
+	}
+
+	return m, parseVersion(results[1]), nil
+}
+
+// GetChunk reads one chunk of an upload, returning nil if it does not exist
+func (rs *RespServer) GetChunk(key, uploadID string, index int) ([]byte, error) {
+	ck := chunkKey(key, uploadID, index)
+	res, err := rs.do("GET", ck)
+	if err != nil {
+		return nil, fmt.Errorf("primary read failed: %w", err)
+	}
+	data, err := rs.open(ck, res)
+	if err != nil {
+		return nil, err
+	}
+	return toBytes(data), nil
+}
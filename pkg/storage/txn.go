@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// ErrTxnAborted is returned when a watched key changed, or did not have its
+// expected version, before a transaction could commit
+var ErrTxnAborted = errors.New("transaction aborted")
+
+// TxnOpType selects what a transaction operation does
+type TxnOpType int
+
+const (
+	TxnSet    TxnOpType = iota // write Value with TTL and bump the version
+	TxnDelete                  // delete the key
+	TxnIncrBy                  // add Delta to the integer at the key
+)
+
+// TxnOp is one operation in a transaction
+type TxnOp struct {
+	Type  TxnOpType
+	Key   string
+	Value string // for TxnSet
+	Delta int64  // for TxnIncrBy
+	TTL   int    // seconds; required for TxnSet, applied to new counters for TxnIncrBy
+}
+
+// TxnWatch guards a transaction on a key. The transaction aborts if the key is
+// written before it commits, or if Version is set and the key's version does
+// not match it when the transaction starts.
+type TxnWatch struct {
+	Key     string
+	Version *int64 // expected version; 0 for never written
+}
+
+// TxnResult is the outcome of one transaction operation
+type TxnResult struct {
+	Version int64 // new version after a TxnSet
+	Value   int64 // new value after a TxnIncrBy
+	Deleted bool  // whether a TxnDelete removed an existing key
+	Err     error
+}
+
+// txnCheck is a key read under WATCH that must hold for the transaction to run
+type txnCheck struct {
+	key     string
+	version *int64 // expected version, or nil for a counter that must be an integer
+}
+
+// reads returns the keys MGET reads for the check
+func (c txnCheck) reads() []string {
+	if c.version != nil {
+		return []string{c.key, versionKey(c.key)}
+	}
+	return []string{c.key}
+}
+
+// Txn runs ops in order as one MULTI/EXEC block on the primary and replicates
+// the resulting state to each replica as a single block. Watched keys are held
+// under WATCH from before the version checks until EXEC, so a concurrent write
+// aborts the transaction with ErrTxnAborted and nothing is applied. Keys being
+// incremented are watched too, so a non-integer counter is rejected before
+// anything is written. Keys being deleted are watched so that the chunks of a
+// streamed value are deleted with it; a stream committed to one of them
+// meanwhile aborts the transaction.
+func (rs *RespServer) Txn(watches []TxnWatch, ops []TxnOp) (_ []TxnResult, err error) {
+	if len(ops) == 0 {
+		return nil, nil
+	}
+
+	sealed := make([]TxnOp, len(ops))
+	copy(sealed, ops)
+	for i, op := range sealed {
+		if op.Type == TxnIncrBy {
+			if err := rs.checkSealable(); err != nil {
+				return nil, err
+			}
+		}
+		if op.Type != TxnSet {
+			continue
+		}
+		value, err := rs.seal(op.Key, op.Value)
+		if err != nil {
+			return nil, err
+		}
+		sealed[i].Value = value
+	}
+	ops = sealed
+
+	opCmds := make([][][]string, len(ops))
+	var deletes []string
+	for i, op := range ops {
+		opCmds[i], err = txnCmds(op)
+		if err != nil {
+			return nil, err
+		}
+		if op.Type == TxnDelete {
+			deletes = append(deletes, op.Key)
+		}
+	}
+
+	// Counters are replicated as their resulting values, so keep them in order
+	var counters []string
+	for _, op := range ops {
+		if op.Type == TxnIncrBy {
+			counters = append(counters, op.Key)
+		}
+	}
+	if len(counters) > 0 {
+		unlock := rs.lockReplication(counters...)
+		defer unlock()
+	}
+
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	reader := resp.NewReader(conn)
+
+	// Deleting a streamed value removes its chunks too, so hold its manifest
+	if len(deletes) > 0 {
+		manifests, err := watchManifests(conn, reader, deletes...)
+		if err != nil {
+			return nil, fmt.Errorf("primary write failed: %w", err)
+		}
+		for i, op := range ops {
+			if op.Type != TxnDelete {
+				continue
+			}
+			if m := manifests[0]; m != nil {
+				opCmds[i] = append(opCmds[i], append([]string{"DEL"}, chunkKeys(op.Key, *m)...))
+			}
+			manifests = manifests[1:]
+		}
+	}
+
+	var cmds [][]string
+	spans := make([]int, len(ops))
+	for i := range ops {
+		cmds = append(cmds, opCmds[i]...)
+		spans[i] = len(opCmds[i])
+	}
+
+	watch := []string{"WATCH"}
+	var checks []txnCheck
+	for _, w := range watches {
+		watch = append(watch, w.Key, versionKey(w.Key))
+		if w.Version != nil {
+			checks = append(checks, txnCheck{key: w.Key, version: w.Version})
+		}
+	}
+	for _, op := range ops {
+		if op.Type == TxnIncrBy {
+			watch = append(watch, op.Key)
+			checks = append(checks, txnCheck{key: op.Key})
+		}
+	}
+
+	if len(watch) > 1 {
+		if err := checkWatched(conn, reader, watch, checks); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return nil, fmt.Errorf("primary write failed: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return nil, fmt.Errorf("primary write failed: %w", err)
+	}
+	if results == nil {
+		return nil, ErrTxnAborted
+	}
+
+	txnResults := make([]TxnResult, len(ops))
+	var replicaCmds [][]string
+	for i, op := range ops {
+		opResults := results[:spans[i]]
+		results = results[spans[i]:]
+
+		if err := firstError(opResults); err != nil {
+			txnResults[i].Err = err
+			continue
+		}
+
+		switch op.Type {
+		case TxnSet:
+			version, err := versionResult(opResults)
+			if err != nil {
+				txnResults[i].Err = err
+				continue
+			}
+			txnResults[i].Version = version
+			replicaCmds = append(replicaCmds, replicaSetExCmds(op.Key, op.TTL, op.Value, version)...)
+		case TxnDelete:
+			txnResults[i].Deleted = opResults[0] == int64(1)
+			replicaCmds = append(replicaCmds, opCmds[i]...)
+		case TxnIncrBy:
+			value, version, created, err := incrByResult(opResults, op.TTL)
+			if err != nil {
+				txnResults[i].Err = err
+				continue
+			}
+			txnResults[i].Value = value
+			replicaCmds = append(replicaCmds, replicaIncrByCmds(op.Key, op.TTL, value, version, created)...)
+		}
+	}
+
+	if len(replicaCmds) > 0 {
+		rs.replicate(wrapMulti(replicaCmds)...)
+	}
+
+	return txnResults, nil
+}
+
+// checkWatched sends the WATCH command, reads the checked keys and verifies
+// each check. The connection is left watching only if every check holds.
+func checkWatched(conn *poolConn, reader *resp.Reader, watch []string, checks []txnCheck) error {
+	cmds := [][]string{watch}
+	mget := []string{"MGET"}
+	for _, c := range checks {
+		mget = append(mget, c.reads()...)
+	}
+	if len(checks) > 0 {
+		cmds = append(cmds, mget)
+	}
+
+	if _, err := conn.writePipeline(cmds...); err != nil {
+		return fmt.Errorf("primary write failed: %w", err)
+	}
+	if !reader.IsOK() {
+		if len(checks) > 0 {
+			reader.ReadValue()
+		}
+		return fmt.Errorf("primary watch not OK")
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	res, err := reader.ReadValue()
+	if err != nil {
+		return unwatch(conn, reader, fmt.Errorf("primary read failed: %w", err))
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != len(mget)-1 {
+		return unwatch(conn, reader, fmt.Errorf("unexpected MGET reply %T", res))
+	}
+
+	for _, c := range checks {
+		var err error
+		value, _ := values[0].([]byte)
+		if c.version != nil {
+			// A missing key is at version 0, as for conditional writes
+			version := parseVersion(values[1])
+			if value == nil {
+				version = 0
+			}
+			if version != *c.version {
+				err = ErrTxnAborted
+			}
+		} else if value != nil {
+			if _, parseErr := strconv.ParseInt(string(value), 10, 64); parseErr != nil {
+				err = fmt.Errorf("value at %s is not an integer", c.key)
+			}
+		}
+
+		if err != nil {
+			return unwatch(conn, reader, err)
+		}
+		values = values[len(c.reads()):]
+	}
+	return nil
+}
+
+// txnCmds returns the commands queued for op inside the transaction
+func txnCmds(op TxnOp) ([][]string, error) {
+	switch op.Type {
+	case TxnSet:
+		return setExCmds(op.Key, op.TTL, op.Value), nil
+	case TxnDelete:
+		return deleteCmds(op.Key), nil
+	case TxnIncrBy:
+		return incrByCmds(op.Key, op.Delta, op.TTL), nil
+	default:
+		return nil, fmt.Errorf("unknown transaction operation %d", op.Type)
+	}
+}
+
+// deleteCmds returns the commands that delete key and its bookkeeping keys,
+// leaving its version behind as a tombstone
+func deleteCmds(key string) [][]string {
+	return [][]string{
+		{"DEL", key},
+		append([]string{"DEL"}, metaKeys(key)...),
+		{"EXPIRE", versionKey(key), strconv.Itoa(versionTombstone)},
+	}
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+// ErrConditionFailed is returned when a conditional write's precondition does
+// not hold, including when a concurrent writer changed the key mid-check
+var ErrConditionFailed = errors.New("condition failed")
+
+// versionTombstone is how long, in seconds, a key's version outlives its
+// value. A key deleted or expired and then written again continues from its
+// old version, so versions a client still holds are never issued twice.
+const versionTombstone = 24 * 60 * 60
+
+// versionKey returns the key holding the write version of key. Versions are
+// bumped on every Set and kept for versionTombstone after the value is gone.
+func versionKey(key string) string {
+	return metaPrefix + "ver:" + key
+}
+
+// versionTTL returns the TTL of the version key of a value written with ttl
+func versionTTL(ttl int) string {
+	return strconv.Itoa(ttl + versionTombstone)
+}
+
+// SetCondition selects when a conditional write is applied
+type SetCondition int
+
+const (
+	SetAlways    SetCondition = iota // write unconditionally
+	SetIfAbsent                      // write only if the key does not exist (NX)
+	SetIfPresent                     // write only if the key exists (XX)
+)
+
+// Condition is a precondition evaluated atomically on the primary before a write
+type Condition struct {
+	Mode      SetCondition
+	IfValue   *string // current value must equal this
+	IfVersion *int64  // current version must equal this; 0 for never written
+}
+
+// IsZero reports whether the condition imposes no check
+func (c Condition) IsZero() bool {
+	return c.Mode == SetAlways && c.IfValue == nil && c.IfVersion == nil
+}
+
+// holds reports whether the condition is met by the current item. A missing
+// key is at version 0: its version only lives on to continue the numbering.
+func (c Condition) holds(current Item) bool {
+	value, exists := current.Value.([]byte)
+	exists = exists && value != nil
+	if !exists {
+		current.Version = 0
+	}
+
+	switch c.Mode {
+	case SetIfAbsent:
+		if exists {
+			return false
+		}
+	case SetIfPresent:
+		if !exists {
+			return false
+		}
+	}
+
+	if c.IfValue != nil && (!exists || string(value) != *c.IfValue) {
+		return false
+	}
+	if c.IfVersion != nil && current.Version != *c.IfVersion {
+		return false
+	}
+	return true
+}
+
+// SetExIf writes value only if cond holds for the key's current value and
+// version. The check and write happen under WATCH, so a concurrent writer makes
+// the write fail with ErrConditionFailed instead of being overwritten. A
+// positive maxReads limits how often the value can be read; see Get.
+func (rs *RespServer) SetExIf(key string, ttl int, value string, cond Condition, maxReads int) (_ int64, err error) {
+	if cond.IsZero() && maxReads == 0 {
+		return rs.SetEx(key, ttl, value)
+	}
+
+	value, err = rs.seal(key, value)
+	if err != nil {
+		return 0, err
+	}
+	cmds := append(setExCmds(key, ttl, value), readLimitCmds(key, ttl, maxReads)...)
+	if cond.IsZero() {
+		results, err := rs.multi(cmds...)
+		if err != nil {
+			return 0, fmt.Errorf("primary write failed: %w", err)
+		}
+		version, err := versionResult(results)
+		if err != nil {
+			return 0, fmt.Errorf("primary write failed: %w", err)
+		}
+		rs.replicate(wrapMulti(replicaSetExLimitedCmds(key, ttl, value, version, maxReads))...)
+		return version, nil
+	}
+
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { rs.primaryPool.put(conn, err) }()
+
+	reader := resp.NewReader(conn)
+	watch := resp.NewPipeline(
+		[]string{"WATCH", key, versionKey(key)},
+		[]string{"MGET", key, versionKey(key)},
+	)
+	if _, err := watch.Execute(conn); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if !reader.IsOK() {
+		reader.ReadValue()
+		return 0, fmt.Errorf("primary watch not OK")
+	}
+	res, err := reader.ReadValue()
+	if err != nil {
+		return 0, unwatch(conn, reader, fmt.Errorf("primary read failed: %w", err))
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, unwatch(conn, reader, fmt.Errorf("unexpected MGET reply %T", res))
+	}
+
+	current, err := rs.open(key, values[0])
+	if err != nil {
+		return 0, unwatch(conn, reader, err)
+	}
+	if !cond.holds(Item{Value: current, Version: parseVersion(values[1])}) {
+		return 0, unwatch(conn, reader, ErrConditionFailed)
+	}
+
+	if _, err := conn.writePipeline(wrapMulti(cmds)...); err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	results, err := readMulti(reader, len(cmds))
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+	if results == nil {
+		// A watched key changed between the check and the write
+		return 0, ErrConditionFailed
+	}
+
+	version, err := versionResult(results)
+	if err != nil {
+		return 0, fmt.Errorf("primary write failed: %w", err)
+	}
+
+	rs.replicate(wrapMulti(replicaSetExLimitedCmds(key, ttl, value, version, maxReads))...)
+
+	return version, nil
+}
+
+// setExCmds returns the commands that write a value and bump its version. A
+// plain write lifts any read limit left by a previous value.
+func setExCmds(key string, ttl int, value string) [][]string {
+	return [][]string{
+		{"SETEX", key, strconv.Itoa(ttl), value},
+		{"INCR", versionKey(key)},
+		{"EXPIRE", versionKey(key), versionTTL(ttl)},
+		{"DEL", readsKey(key)},
+	}
+}
+
+// replicaSetExCmds returns the commands that bring a replica to the primary's
+// state after a versioned write
+func replicaSetExCmds(key string, ttl int, value string, version int64) [][]string {
+	return [][]string{
+		{"SETEX", key, strconv.Itoa(ttl), value},
+		{"SET", versionKey(key), strconv.FormatInt(version, 10), "EX", versionTTL(ttl)},
+		{"DEL", readsKey(key)},
+	}
+}
+
+// versionResult extracts the new version from the EXEC results of setExCmds
+func versionResult(results []interface{}) (int64, error) {
+	if err := firstError(results); err != nil {
+		return 0, err
+	}
+	if len(results) < 2 {
+		return 0, fmt.Errorf("expected at least 2 results, got %d", len(results))
+	}
+	version, ok := results[1].(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected version reply %T", results[1])
+	}
+	return version, nil
+}
+
+// parseVersion converts a version key's value into a version number, treating
+// missing or malformed versions as 0
+func parseVersion(value interface{}) int64 {
+	b, ok := value.([]byte)
+	if !ok {
+		return 0
+	}
+	version, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return version
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/we-be/tritium/internal/resp"
+)
+
+func TestStaleWatchDoesNotPanic(t *testing.T) {
+	rs, err := NewRespServer(benchAddr, 1, nil)
+	if err != nil {
+		t.Skipf("RESP server unavailable: %v", err)
+	}
+	defer rs.Close()
+
+	// Leave a WATCH on the only pooled connection, then touch the key
+	conn, err := rs.primaryPool.get()
+	if err != nil {
+		t.Fatalf("Failed to check out a connection: %v", err)
+	}
+	if _, err := resp.NewCommand("WATCH", "test-stale-watch").ExecuteWithResponse(conn, resp.NewReader(conn)); err != nil {
+		t.Fatalf("WATCH failed: %v", err)
+	}
+	rs.primaryPool.put(conn, nil)
+	other, err := newConnPool(benchAddr, 1)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer other.close()
+	conn, _ = other.get()
+	resp.NewCommand("SET", "test-stale-watch", "x").ExecuteWithResponse(conn, resp.NewReader(conn))
+	other.put(conn, nil)
+
+	// The aborted EXEC fails the write and the connection is replaced
+	if _, err := rs.SetEx("test-stale-watch", 10, "v"); err == nil {
+		t.Fatalf("Expected the write on a stale WATCH to fail")
+	}
+	if _, err := rs.SetEx("test-stale-watch", 10, "v"); err != nil {
+		t.Fatalf("Expected the write on a fresh connection to succeed, got %v", err)
+	}
+	rs.Delete("test-stale-watch")
+}
+
+func TestVersionResultShortReply(t *testing.T) {
+	if _, err := versionResult(nil); err == nil {
+		t.Errorf("Expected an error for missing results")
+	}
+}
@@ -10,13 +10,29 @@ import (
 
 // Client represents a Tritium RPC client
 type Client struct {
-	rpc *rpc.Client
+	rpc       *rpc.Client
+	namespace string
+}
+
+// Entry is a single key/value write for MSet
+type Entry struct {
+	Key   string
+	Value []byte
+	TTL   *int // optional TTL in seconds
+}
+
+// Result is the outcome for one key of a batch operation
+type Result struct {
+	Key   string
+	Value []byte
+	Err   error
 }
 
 // ClientOptions contains options for creating a new client
 type ClientOptions struct {
-	Address string
-	Timeout time.Duration
+	Address   string
+	Timeout   time.Duration
+	Namespace string // optional namespace applied to every key
 }
 
 // NewClient creates a new Tritium client
@@ -34,42 +50,321 @@ func NewClient(opts *ClientOptions) (*Client, error) {
 	}
 
 	return &Client{
-		rpc: client,
+		rpc:       client,
+		namespace: opts.Namespace,
 	}, nil
 }
 
+var (
+	// ErrConditionFailed is returned by conditional writes whose precondition did not hold
+	ErrConditionFailed = storage.ErrConditionFailed
+	// ErrConsumed is returned when reading a read-limited value after its last
+	// permitted read
+	ErrConsumed = storage.ErrConsumed
+	// ErrMemoryLimit is returned by writes the server rejected because its
+	// memory limit was reached and nothing could be evicted
+	ErrMemoryLimit = storage.ErrMemoryLimit
+)
+
 // Set stores a value with an optional TTL
 func (c *Client) Set(key string, value []byte, ttl *int) error {
-	args := &storage.SetArgs{
-		Key:   key,
-		Value: value,
-		TTL:   ttl,
-	}
+	_, err := c.set(&storage.SetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Value:     value,
+		TTL:       ttl,
+	})
+	return err
+}
+
+// SetMaxReads stores a value that can be read at most maxReads times. The
+// read that uses it up deletes the value, and later reads return ErrConsumed.
+func (c *Client) SetMaxReads(key string, value []byte, maxReads int, ttl *int) error {
+	_, err := c.set(&storage.SetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Value:     value,
+		TTL:       ttl,
+		MaxReads:  maxReads,
+	})
+	return err
+}
+
+// SetNX stores a value only if the key does not exist, reporting whether it was written
+func (c *Client) SetNX(key string, value []byte, ttl *int) (bool, error) {
+	return c.setIf(&storage.SetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Value:     value,
+		TTL:       ttl,
+		Condition: storage.SetIfAbsent,
+	})
+}
+
+// SetXX stores a value only if the key already exists, reporting whether it was written
+func (c *Client) SetXX(key string, value []byte, ttl *int) (bool, error) {
+	return c.setIf(&storage.SetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Value:     value,
+		TTL:       ttl,
+		Condition: storage.SetIfPresent,
+	})
+}
+
+// CompareAndSwap replaces the value of key only if it currently equals old.
+// It returns the new version, or ErrConditionFailed if the value differed.
+func (c *Client) CompareAndSwap(key string, old, value []byte, ttl *int) (int64, error) {
+	return c.set(&storage.SetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Value:     value,
+		TTL:       ttl,
+		IfValue:   old,
+	})
+}
+
+// CompareAndSwapVersion replaces the value of key only if its current version,
+// as returned by GetWithVersion or a previous write, equals version. It returns
+// the new version, or ErrConditionFailed if the key was modified in between.
+func (c *Client) CompareAndSwapVersion(key string, version int64, value []byte, ttl *int) (int64, error) {
+	return c.set(&storage.SetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Value:     value,
+		TTL:       ttl,
+		IfVersion: &version,
+	})
+}
+
+func (c *Client) set(args *storage.SetArgs) (int64, error) {
 	var reply storage.SetReply
 	if err := c.rpc.Call("Store.Set", args, &reply); err != nil {
-		return fmt.Errorf("failed to set value: %w", err)
+		return 0, fmt.Errorf("failed to set value: %w", err)
+	}
+	if reply.Error == ErrConditionFailed.Error() {
+		return 0, ErrConditionFailed
+	}
+	if reply.Error == ErrMemoryLimit.Error() {
+		return 0, ErrMemoryLimit
 	}
 	if reply.Error != "" {
-		return fmt.Errorf("server error: %s", reply.Error)
+		return 0, fmt.Errorf("server error: %s", reply.Error)
 	}
-	return nil
+	return reply.Version, nil
+}
+
+func (c *Client) setIf(args *storage.SetArgs) (bool, error) {
+	_, err := c.set(args)
+	if err == ErrConditionFailed {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 // Get retrieves a value
 func (c *Client) Get(key string) ([]byte, error) {
+	value, _, err := c.GetWithVersion(key)
+	return value, err
+}
+
+// GetWithVersion retrieves a value along with its current version, for use
+// with CompareAndSwapVersion
+func (c *Client) GetWithVersion(key string) ([]byte, int64, error) {
 	args := &storage.GetArgs{
-		Key: key,
+		Namespace: c.namespace,
+		Key:       key,
 	}
 	var reply storage.GetReply
 	if err := c.rpc.Call("Store.Get", args, &reply); err != nil {
-		return nil, fmt.Errorf("failed to get value: %w", err)
+		return nil, 0, fmt.Errorf("failed to get value: %w", err)
+	}
+	if reply.Error == ErrConsumed.Error() {
+		return nil, 0, ErrConsumed
+	}
+	if reply.Error != "" {
+		return nil, 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Value, reply.Version, nil
+}
+
+// MGet retrieves several values in a single round trip. Results are returned
+// in the same order as keys, with a per-key error for missing values.
+func (c *Client) MGet(keys ...string) ([]Result, error) {
+	args := &storage.MGetArgs{
+		Namespace: c.namespace,
+		Keys:      keys,
+	}
+	var reply storage.MGetReply
+	if err := c.rpc.Call("Store.MGet", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to get values: %w", err)
 	}
 	if reply.Error != "" {
 		return nil, fmt.Errorf("server error: %s", reply.Error)
 	}
+
+	results := make([]Result, len(reply.Values))
+	for i, v := range reply.Values {
+		results[i] = Result{Key: keys[i], Value: v.Value}
+		if v.Error == ErrConsumed.Error() {
+			results[i].Err = ErrConsumed
+		} else if v.Error != "" {
+			results[i].Err = fmt.Errorf("server error: %s", v.Error)
+		}
+	}
+	return results, nil
+}
+
+// MSet stores several values in a single round trip. Results are returned in
+// the same order as entries, with a per-key error for failed writes.
+func (c *Client) MSet(entries []Entry) ([]Result, error) {
+	args := &storage.MSetArgs{
+		Entries: make([]storage.SetArgs, len(entries)),
+	}
+	for i, e := range entries {
+		args.Entries[i] = storage.SetArgs{Namespace: c.namespace, Key: e.Key, Value: e.Value, TTL: e.TTL}
+	}
+	var reply storage.MSetReply
+	if err := c.rpc.Call("Store.MSet", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to set values: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+
+	results := make([]Result, len(reply.Results))
+	for i, r := range reply.Results {
+		results[i] = Result{Key: entries[i].Key}
+		if r.Error != "" {
+			results[i].Err = fmt.Errorf("server error: %s", r.Error)
+		}
+	}
+	return results, nil
+}
+
+// Incr atomically increments the counter at key by one
+func (c *Client) Incr(key string) (int64, error) {
+	return c.IncrBy(key, 1, nil)
+}
+
+// Decr atomically decrements the counter at key by one
+func (c *Client) Decr(key string) (int64, error) {
+	return c.IncrBy(key, -1, nil)
+}
+
+// IncrBy atomically adds delta to the counter at key and returns the new value.
+// The optional TTL is only applied when the counter is created.
+func (c *Client) IncrBy(key string, delta int64, ttl *int) (int64, error) {
+	args := &storage.IncrByArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Delta:     delta,
+		TTL:       ttl,
+	}
+	var reply storage.IncrByReply
+	if err := c.rpc.Call("Store.IncrBy", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to increment value: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
 	return reply.Value, nil
 }
 
+// Delete removes one or more keys and returns how many existed
+func (c *Client) Delete(keys ...string) (int, error) {
+	args := &storage.DeleteArgs{
+		Namespace: c.namespace,
+		Keys:      keys,
+	}
+	var reply storage.DeleteReply
+	if err := c.rpc.Call("Store.Delete", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to delete keys: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Deleted, nil
+}
+
+// TTL returns the remaining lifetime of a key in seconds, or -1 if it never expires
+func (c *Client) TTL(key string) (int, error) {
+	args := &storage.TTLArgs{
+		Namespace: c.namespace,
+		Key:       key,
+	}
+	var reply storage.TTLReply
+	if err := c.rpc.Call("Store.TTL", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to get ttl: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.TTL, nil
+}
+
+// Expire sets a new TTL in seconds on an existing key
+func (c *Client) Expire(key string, ttl int) error {
+	args := &storage.ExpireArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		TTL:       ttl,
+	}
+	var reply storage.ExpireReply
+	if err := c.rpc.Call("Store.Expire", args, &reply); err != nil {
+		return fmt.Errorf("failed to set expiry: %w", err)
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("server error: %s", reply.Error)
+	}
+	return nil
+}
+
+// ExpireAt makes an existing key expire at the given time
+func (c *Client) ExpireAt(key string, at time.Time) error {
+	args := &storage.ExpireAtArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Timestamp: at.Unix(),
+	}
+	var reply storage.ExpireReply
+	if err := c.rpc.Call("Store.ExpireAt", args, &reply); err != nil {
+		return fmt.Errorf("failed to set expiry: %w", err)
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("server error: %s", reply.Error)
+	}
+	return nil
+}
+
+// Persist removes the TTL from a key, reporting whether it had one
+func (c *Client) Persist(key string) (bool, error) {
+	args := &storage.PersistArgs{
+		Namespace: c.namespace,
+		Key:       key,
+	}
+	var reply storage.ExpireReply
+	if err := c.rpc.Call("Store.Persist", args, &reply); err != nil {
+		return false, fmt.Errorf("failed to persist key: %w", err)
+	}
+	if reply.Error != "" {
+		return false, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Updated, nil
+}
+
+// Namespaces lists the namespaces declared on the server with their usage
+func (c *Client) Namespaces() ([]storage.NamespaceInfo, error) {
+	var reply storage.NamespacesReply
+	if err := c.rpc.Call("Store.Namespaces", struct{}{}, &reply); err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Namespaces, nil
+}
+
 // Close closes the client connection
 func (c *Client) Close() error {
 	return c.rpc.Close()
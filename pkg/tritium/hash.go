@@ -0,0 +1,96 @@
+package tritium
+
+import (
+	"fmt"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// HSet writes fields into the hash at key, creating it if needed, and returns
+// the number of new fields. The optional TTL applies to the whole hash.
+func (c *Client) HSet(key string, fields map[string][]byte, ttl *int) (int, error) {
+	args := &storage.HSetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Fields:    fields,
+		TTL:       ttl,
+	}
+	var reply storage.HSetReply
+	if err := c.rpc.Call("Store.HSet", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to set hash fields: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Added, nil
+}
+
+// HGet retrieves a single field of the hash at key
+func (c *Client) HGet(key, field string) ([]byte, error) {
+	args := &storage.HGetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Field:     field,
+	}
+	var reply storage.HGetReply
+	if err := c.rpc.Call("Store.HGet", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to get hash field: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Value, nil
+}
+
+// HGetAll retrieves every field of the hash at key
+func (c *Client) HGetAll(key string) (map[string][]byte, error) {
+	args := &storage.HGetAllArgs{
+		Namespace: c.namespace,
+		Key:       key,
+	}
+	var reply storage.HGetAllReply
+	if err := c.rpc.Call("Store.HGetAll", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to get hash: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Fields, nil
+}
+
+// HDel removes fields from the hash at key and returns how many existed
+func (c *Client) HDel(key string, fields ...string) (int, error) {
+	args := &storage.HDelArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Fields:    fields,
+	}
+	var reply storage.HDelReply
+	if err := c.rpc.Call("Store.HDel", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to delete hash fields: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Deleted, nil
+}
+
+// HIncrBy atomically adds delta to an integer field of the hash at key and
+// returns the new value. The optional TTL applies to the whole hash.
+func (c *Client) HIncrBy(key, field string, delta int64, ttl *int) (int64, error) {
+	args := &storage.HIncrByArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Field:     field,
+		Delta:     delta,
+		TTL:       ttl,
+	}
+	var reply storage.IncrByReply
+	if err := c.rpc.Call("Store.HIncrBy", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to increment hash field: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Value, nil
+}
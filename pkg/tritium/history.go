@@ -0,0 +1,92 @@
+package tritium
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// ErrVersionNotFound is returned for versions that were never written, have
+// expired or are no longer kept
+var ErrVersionNotFound = storage.ErrVersionNotFound
+
+// Version is one kept version of a key in a namespace with version history
+type Version struct {
+	Version   int64
+	Value     []byte // only set by GetVersion
+	Timestamp time.Time
+	TTL       int // seconds left; -1 if the version never expires
+}
+
+// GetVersion returns a kept version of key
+func (c *Client) GetVersion(key string, version int64) (*Version, error) {
+	args := &storage.GetVersionArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Version:   version,
+	}
+	var reply storage.GetVersionReply
+	if err := c.rpc.Call("Store.GetVersion", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+	if reply.Error == ErrVersionNotFound.Error() {
+		return nil, ErrVersionNotFound
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return &Version{
+		Version:   version,
+		Value:     reply.Value,
+		Timestamp: time.UnixMilli(reply.Timestamp),
+		TTL:       reply.TTL,
+	}, nil
+}
+
+// ListVersions returns the kept versions of key, newest first, without values
+func (c *Client) ListVersions(key string) ([]Version, error) {
+	args := &storage.GetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+	}
+	var reply storage.ListVersionsReply
+	if err := c.rpc.Call("Store.ListVersions", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+
+	versions := make([]Version, len(reply.Versions))
+	for i, v := range reply.Versions {
+		versions[i] = Version{
+			Version:   v.Version,
+			Timestamp: time.UnixMilli(v.Timestamp),
+			TTL:       v.TTL,
+		}
+	}
+	return versions, nil
+}
+
+// Rollback makes the value of a kept version current again by writing it as
+// a new version, and returns that version
+func (c *Client) Rollback(key string, version int64, ttl *int) (int64, error) {
+	args := &storage.RollbackArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Version:   version,
+		TTL:       ttl,
+	}
+	var reply storage.SetReply
+	if err := c.rpc.Call("Store.Rollback", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to roll back: %w", err)
+	}
+	if reply.Error == ErrVersionNotFound.Error() {
+		return 0, ErrVersionNotFound
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Version, nil
+}
@@ -0,0 +1,227 @@
+package tritium
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+var (
+	// ErrLockHeld is returned when a lock is already held by another owner
+	ErrLockHeld = storage.ErrLockHeld
+	// ErrNotLockHolder is returned when renewing or releasing a lock that is no
+	// longer held, usually because its lease expired
+	ErrNotLockHolder = storage.ErrNotLockHolder
+)
+
+const (
+	// lockRetryMin and lockRetryMax bound how often Mutex.Lock retries a held lock
+	lockRetryMin = 10 * time.Millisecond
+	lockRetryMax = 250 * time.Millisecond
+)
+
+// Lease is a held lock
+type Lease struct {
+	Key   string
+	Owner string // token identifying this holder
+	Fence int64  // fencing token; pass to the protected resource to reject stale holders
+}
+
+// Lock tries once to acquire the lock at key for the given lease. It returns
+// ErrLockHeld if another owner holds it.
+func (c *Client) Lock(key string, lease time.Duration) (*Lease, error) {
+	args := &storage.LockArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Lease:     int(lease.Milliseconds()),
+	}
+	var reply storage.LockReply
+	if err := c.rpc.Call("Store.Lock", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	if reply.Error == ErrLockHeld.Error() {
+		return nil, ErrLockHeld
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return &Lease{Key: key, Owner: reply.Owner, Fence: reply.Fence}, nil
+}
+
+// RenewLock extends a held lock so it expires lease from now. It returns
+// ErrNotLockHolder if the lock was lost.
+func (c *Client) RenewLock(l *Lease, lease time.Duration) error {
+	args := &storage.RenewArgs{
+		Namespace: c.namespace,
+		Key:       l.Key,
+		Owner:     l.Owner,
+		Lease:     int(lease.Milliseconds()),
+	}
+	var reply storage.RenewReply
+	if err := c.rpc.Call("Store.Renew", args, &reply); err != nil {
+		return fmt.Errorf("failed to renew lock: %w", err)
+	}
+	if reply.Error == ErrNotLockHolder.Error() {
+		return ErrNotLockHolder
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("server error: %s", reply.Error)
+	}
+	return nil
+}
+
+// Unlock releases a held lock. It returns ErrNotLockHolder if the lock was lost.
+func (c *Client) Unlock(l *Lease) error {
+	args := &storage.UnlockArgs{
+		Namespace: c.namespace,
+		Key:       l.Key,
+		Owner:     l.Owner,
+	}
+	var reply storage.UnlockReply
+	if err := c.rpc.Call("Store.Unlock", args, &reply); err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	if reply.Error == ErrNotLockHolder.Error() {
+		return ErrNotLockHolder
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("server error: %s", reply.Error)
+	}
+	return nil
+}
+
+// Mutex is a distributed lock that renews its lease in the background while
+// held, so work protected by it may outlast a single lease
+type Mutex struct {
+	c     *Client
+	key   string
+	lease time.Duration
+
+	mu   sync.Mutex
+	held *hold
+}
+
+// hold is one acquisition of a Mutex and its renewal goroutine
+type hold struct {
+	lease *Lease
+	stop  chan struct{}
+	done  chan struct{} // closed when renewal stops; err is set before
+	lost  chan struct{}
+	err   error
+}
+
+// NewMutex returns a mutex for the lock at key. The lease bounds how long the
+// lock outlives a holder that dies without unlocking.
+func (c *Client) NewMutex(key string, lease time.Duration) *Mutex {
+	return &Mutex{c: c, key: key, lease: lease}
+}
+
+// Lock blocks until the lock is acquired
+func (m *Mutex) Lock() error {
+	interval := lockRetryMin
+	for {
+		ok, err := m.TryLock()
+		if ok || err != nil {
+			return err
+		}
+
+		time.Sleep(interval)
+		if interval *= 2; interval > lockRetryMax {
+			interval = lockRetryMax
+		}
+	}
+}
+
+// TryLock tries once to acquire the lock, reporting whether it did
+func (m *Mutex) TryLock() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held != nil {
+		return false, fmt.Errorf("mutex %s already locked", m.key)
+	}
+
+	l, err := m.c.Lock(m.key, m.lease)
+	if err == ErrLockHeld {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	m.held = &hold{
+		lease: l,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		lost:  make(chan struct{}),
+	}
+	go m.renewLoop(m.held)
+	return true, nil
+}
+
+// Fence returns the fencing token of the current hold, or 0 if not locked
+func (m *Mutex) Fence() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held == nil {
+		return 0
+	}
+	return m.held.lease.Fence
+}
+
+// Lost returns a channel that is closed if the lease could not be renewed and
+// the lock may now be held by someone else. It is nil if not locked.
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held == nil {
+		return nil
+	}
+	return m.held.lost
+}
+
+// Unlock stops renewing and releases the lock. It returns ErrNotLockHolder if
+// the lock was lost while held.
+func (m *Mutex) Unlock() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h := m.held
+	if h == nil {
+		return fmt.Errorf("mutex %s not locked", m.key)
+	}
+	m.held = nil
+
+	close(h.stop)
+	<-h.done
+	if h.err != nil {
+		return h.err
+	}
+	return m.c.Unlock(h.lease)
+}
+
+// renewLoop renews the lease at a third of its length until stopped or the
+// lock is lost. Transient failures are retried at the next tick.
+func (m *Mutex) renewLoop(h *hold) {
+	defer close(h.done)
+
+	ticker := time.NewTicker(m.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			if err := m.c.RenewLock(h.lease, m.lease); err == ErrNotLockHolder {
+				h.err = err
+				close(h.lost)
+				return
+			}
+		}
+	}
+}
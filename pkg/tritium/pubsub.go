@@ -0,0 +1,138 @@
+package tritium
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// receiveTimeout is how long each long-poll for subscription messages waits
+// on the server, in seconds
+const receiveTimeout = 30
+
+// Message is a message received on a subscription
+type Message = storage.Message
+
+// Subscription delivers messages published to channels matching its patterns
+type Subscription struct {
+	c    *Client
+	id   string
+	ch   chan *Message
+	done chan struct{}
+
+	closeOnce sync.Once
+	mu        sync.Mutex
+	err       error
+}
+
+// Publish sends message to every subscriber of channel across the cluster and
+// returns the number of subscribers on the receiving node
+func (c *Client) Publish(channel string, message []byte) (int, error) {
+	args := &storage.PublishArgs{
+		Namespace: c.namespace,
+		Channel:   channel,
+		Message:   message,
+	}
+	var reply storage.PublishReply
+	if err := c.rpc.Call("Store.Publish", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to publish: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Receivers, nil
+}
+
+// Subscribe subscribes to channels matching the given glob-style patterns,
+// e.g. "orders.*". Messages are delivered on the subscription's Channel until
+// it is closed or the connection fails.
+func (c *Client) Subscribe(patterns ...string) (*Subscription, error) {
+	args := &storage.SubscribeArgs{
+		Namespace: c.namespace,
+		Patterns:  patterns,
+	}
+	return c.subscribe("Store.Subscribe", args)
+}
+
+// subscribe registers a subscription through the given RPC and starts
+// collecting its messages
+func (c *Client) subscribe(method string, args interface{}) (*Subscription, error) {
+	var reply storage.SubscribeReply
+	if err := c.rpc.Call(method, args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+
+	sub := &Subscription{
+		c:    c,
+		id:   reply.SubscriptionID,
+		ch:   make(chan *Message, 64),
+		done: make(chan struct{}),
+	}
+	go sub.receiveLoop()
+	return sub, nil
+}
+
+// Channel returns the channel messages are delivered on. It is closed when the
+// subscription ends; Err reports why.
+func (s *Subscription) Channel() <-chan *Message {
+	return s.ch
+}
+
+// Err returns the error that ended the subscription, if any
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		var reply storage.UnsubscribeReply
+		if callErr := s.c.rpc.Call("Store.Unsubscribe", &storage.UnsubscribeArgs{SubscriptionID: s.id}, &reply); callErr != nil {
+			err = fmt.Errorf("failed to unsubscribe: %w", callErr)
+		}
+	})
+	return err
+}
+
+func (s *Subscription) receiveLoop() {
+	defer close(s.ch)
+
+	args := &storage.ReceiveArgs{SubscriptionID: s.id, Timeout: receiveTimeout}
+	for {
+		var reply storage.ReceiveReply
+		err := s.c.rpc.Call("Store.Receive", args, &reply)
+
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		if err == nil && reply.Error != "" {
+			err = fmt.Errorf("server error: %s", reply.Error)
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+			return
+		}
+
+		for i := range reply.Messages {
+			select {
+			case s.ch <- &reply.Messages[i]:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package tritium
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// ErrQueueEmpty is returned by Pop when no item was available before the timeout
+var ErrQueueEmpty = storage.ErrQueueEmpty
+
+// QueueItem is a value popped from a queue
+type QueueItem struct {
+	Value   []byte
+	Receipt string // set when popped with a visibility timeout; pass to Ack
+}
+
+// PopOptions controls how Pop takes an item from a queue
+type PopOptions struct {
+	// Timeout is how long to wait for an item; zero returns immediately.
+	// It is rounded up to whole seconds.
+	Timeout time.Duration
+
+	// Visibility enables reliable mode: the item is hidden from other
+	// consumers and returned to the queue unless acked within this duration.
+	// It is rounded up to whole seconds.
+	Visibility time.Duration
+
+	// FromBack pops from the tail of the list instead of the head
+	FromBack bool
+}
+
+// Push appends values to the tail of the queue at key and returns its new length
+func (c *Client) Push(key string, values ...[]byte) (int, error) {
+	args := &storage.PushArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Values:    values,
+	}
+	var reply storage.PushReply
+	if err := c.rpc.Call("Store.Push", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to push values: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Length, nil
+}
+
+// Pop takes the next item from the queue at key, waiting up to opts.Timeout
+// for one to arrive. It returns ErrQueueEmpty if none did.
+func (c *Client) Pop(key string, opts *PopOptions) (*QueueItem, error) {
+	if opts == nil {
+		opts = &PopOptions{}
+	}
+
+	args := &storage.PopArgs{
+		Namespace:         c.namespace,
+		Key:               key,
+		Back:              opts.FromBack,
+		Timeout:           ceilSeconds(opts.Timeout),
+		VisibilityTimeout: ceilSeconds(opts.Visibility),
+	}
+	method := "Store.Pop"
+	if args.Timeout > 0 {
+		method = "Store.BPop"
+	}
+
+	var reply storage.PopReply
+	if err := c.rpc.Call(method, args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to pop value: %w", err)
+	}
+	if reply.Error == ErrQueueEmpty.Error() {
+		return nil, ErrQueueEmpty
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return &QueueItem{Value: reply.Value, Receipt: reply.Receipt}, nil
+}
+
+// Ack confirms that an item popped in reliable mode was processed so it is
+// not redelivered
+func (c *Client) Ack(key, receipt string) error {
+	args := &storage.AckArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Receipt:   receipt,
+	}
+	var reply storage.AckReply
+	if err := c.rpc.Call("Store.Ack", args, &reply); err != nil {
+		return fmt.Errorf("failed to ack item: %w", err)
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("server error: %s", reply.Error)
+	}
+	return nil
+}
+
+// LRange returns the elements of the list at key between start and stop
+// inclusive; negative indexes count from the tail
+func (c *Client) LRange(key string, start, stop int64) ([][]byte, error) {
+	args := &storage.LRangeArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Start:     start,
+		Stop:      stop,
+	}
+	var reply storage.LRangeReply
+	if err := c.rpc.Call("Store.LRange", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to read list: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Values, nil
+}
+
+// LLen returns the length of the list at key
+func (c *Client) LLen(key string) (int, error) {
+	args := &storage.LLenArgs{
+		Namespace: c.namespace,
+		Key:       key,
+	}
+	var reply storage.LLenReply
+	if err := c.rpc.Call("Store.LLen", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to read list length: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Length, nil
+}
+
+// ceilSeconds converts d to whole seconds, rounding up
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,48 @@
+package tritium
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// RateLimitResult is the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int           // further requests of cost 1 allowed right now
+	ResetAfter time.Duration // until the limit is fully replenished
+	RetryAfter time.Duration // until the request would be allowed; 0 if it was
+}
+
+// RateLimit charges one request against a limit of limit requests per window
+// for key. The limit is a token bucket shared by every client and node using
+// the same key.
+func (c *Client) RateLimit(key string, limit int, window time.Duration) (*RateLimitResult, error) {
+	return c.RateLimitN(key, limit, window, 1)
+}
+
+// RateLimitN charges a request costing cost tokens against the limit for key.
+// Denied requests are not charged.
+func (c *Client) RateLimitN(key string, limit int, window time.Duration, cost int) (*RateLimitResult, error) {
+	args := &storage.RateLimitArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Limit:     limit,
+		Window:    int(window.Milliseconds()),
+		Cost:      cost,
+	}
+	var reply storage.RateLimitReply
+	if err := c.rpc.Call("Store.RateLimit", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return &RateLimitResult{
+		Allowed:    reply.Allowed,
+		Remaining:  reply.Remaining,
+		ResetAfter: time.Duration(reply.ResetAfter) * time.Millisecond,
+		RetryAfter: time.Duration(reply.RetryAfter) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package tritium
+
+import (
+	"fmt"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// Scanner iterates over the keys matching a pattern, fetching them from the
+// server in pages as needed. Keys written or deleted during the iteration may
+// or may not be returned, and a key may be returned more than once.
+//
+//	it := client.Scan("session:*", 100)
+//	for it.Next() {
+//		fmt.Println(it.Key())
+//	}
+//	if err := it.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+type Scanner struct {
+	client  *Client
+	pattern string
+	count   int
+	cursor  uint64
+	keys    []string
+	key     string
+	started bool
+	err     error
+}
+
+// Scan returns an iterator over the keys matching the glob pattern. count is a
+// hint for how many keys the server examines per round trip; 0 uses the default.
+func (c *Client) Scan(pattern string, count int) *Scanner {
+	return &Scanner{
+		client:  c,
+		pattern: pattern,
+		count:   count,
+	}
+}
+
+// Next advances to the next key, returning false when the iteration is
+// exhausted or an error occurred
+func (s *Scanner) Next() bool {
+	for len(s.keys) == 0 {
+		if s.err != nil || (s.started && s.cursor == 0) {
+			return false
+		}
+		s.fetch()
+	}
+
+	s.key, s.keys = s.keys[0], s.keys[1:]
+	return true
+}
+
+// Key returns the current key
+func (s *Scanner) Key() string {
+	return s.key
+}
+
+// Err returns the first error encountered during the iteration
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+func (s *Scanner) fetch() {
+	args := &storage.ScanArgs{
+		Namespace: s.client.namespace,
+		Pattern:   s.pattern,
+		Cursor:    s.cursor,
+		Count:     s.count,
+	}
+	var reply storage.ScanReply
+	if err := s.client.rpc.Call("Store.Scan", args, &reply); err != nil {
+		s.err = fmt.Errorf("failed to scan keys: %w", err)
+		return
+	}
+	if reply.Error != "" {
+		s.err = fmt.Errorf("server error: %s", reply.Error)
+		return
+	}
+
+	s.started = true
+	s.cursor = reply.Cursor
+	s.keys = reply.Keys
+}
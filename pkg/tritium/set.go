@@ -0,0 +1,178 @@
+package tritium
+
+import (
+	"fmt"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// ScoredMember is a sorted set member with its score
+type ScoredMember = storage.ScoredMember
+
+// SAdd adds members to the set at key and returns how many were new. The
+// optional TTL applies to the whole set.
+func (c *Client) SAdd(key string, members [][]byte, ttl *int) (int, error) {
+	args := &storage.SAddArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Members:   members,
+		TTL:       ttl,
+	}
+	var reply storage.SAddReply
+	if err := c.rpc.Call("Store.SAdd", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to add set members: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Added, nil
+}
+
+// SRem removes members from the set at key and returns how many were present
+func (c *Client) SRem(key string, members ...[]byte) (int, error) {
+	args := &storage.SRemArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Members:   members,
+	}
+	var reply storage.SRemReply
+	if err := c.rpc.Call("Store.SRem", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to remove set members: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Removed, nil
+}
+
+// SMembers returns every member of the set at key
+func (c *Client) SMembers(key string) ([][]byte, error) {
+	args := &storage.SMembersArgs{
+		Namespace: c.namespace,
+		Key:       key,
+	}
+	var reply storage.SMembersReply
+	if err := c.rpc.Call("Store.SMembers", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to get set members: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Members, nil
+}
+
+// SIsMember reports whether member belongs to the set at key
+func (c *Client) SIsMember(key string, member []byte) (bool, error) {
+	args := &storage.SIsMemberArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Member:    member,
+	}
+	var reply storage.SIsMemberReply
+	if err := c.rpc.Call("Store.SIsMember", args, &reply); err != nil {
+		return false, fmt.Errorf("failed to check set membership: %w", err)
+	}
+	if reply.Error != "" {
+		return false, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.IsMember, nil
+}
+
+// ZAdd adds members to the sorted set at key, updating the scores of existing
+// members, and returns how many were new. The optional TTL applies to the
+// whole sorted set.
+func (c *Client) ZAdd(key string, members []ScoredMember, ttl *int) (int, error) {
+	args := &storage.ZAddArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Members:   members,
+		TTL:       ttl,
+	}
+	var reply storage.ZAddReply
+	if err := c.rpc.Call("Store.ZAdd", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to add sorted set members: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Added, nil
+}
+
+// ZRem removes members from the sorted set at key and returns how many were present
+func (c *Client) ZRem(key string, members ...[]byte) (int, error) {
+	args := &storage.ZRemArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Members:   members,
+	}
+	var reply storage.ZRemReply
+	if err := c.rpc.Call("Store.ZRem", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to remove sorted set members: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Removed, nil
+}
+
+// ZIncrBy atomically adds delta to the score of member in the sorted set at
+// key and returns the new score. The optional TTL applies to the whole sorted set.
+func (c *Client) ZIncrBy(key string, member []byte, delta float64, ttl *int) (float64, error) {
+	args := &storage.ZIncrByArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Member:    member,
+		Delta:     delta,
+		TTL:       ttl,
+	}
+	var reply storage.ZIncrByReply
+	if err := c.rpc.Call("Store.ZIncrBy", args, &reply); err != nil {
+		return 0, fmt.Errorf("failed to increment score: %w", err)
+	}
+	if reply.Error != "" {
+		return 0, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Score, nil
+}
+
+// ZRange returns the members of the sorted set at key ranked between start and
+// stop inclusive, lowest score first or highest first if reverse is set
+func (c *Client) ZRange(key string, start, stop int64, reverse bool) ([]ScoredMember, error) {
+	args := &storage.ZRangeArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Start:     start,
+		Stop:      stop,
+		Reverse:   reverse,
+	}
+	var reply storage.ZRangeReply
+	if err := c.rpc.Call("Store.ZRange", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to read sorted set: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Members, nil
+}
+
+// ZRangeByScore returns the members of the sorted set at key with scores
+// between min and max inclusive, lowest first. A positive count limits the
+// result to count members after skipping offset.
+func (c *Client) ZRangeByScore(key string, min, max float64, offset, count int) ([]ScoredMember, error) {
+	args := &storage.ZRangeByScoreArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Min:       min,
+		Max:       max,
+		Offset:    offset,
+		Count:     count,
+	}
+	var reply storage.ZRangeReply
+	if err := c.rpc.Call("Store.ZRangeByScore", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to read sorted set: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	return reply.Members, nil
+}
@@ -0,0 +1,189 @@
+package tritium
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// StreamChunkSize is the size of the chunks PutStream splits values into
+const StreamChunkSize = 1 << 20
+
+// ErrStreamCorrupt is returned by a stream reader whose data does not match
+// the checksum recorded when it was written
+var ErrStreamCorrupt = errors.New("stream checksum mismatch")
+
+// PutStream uploads everything read from r as the value of key in chunks, so
+// neither side holds the whole value in memory. The value only becomes visible
+// once every chunk is stored; until then readers see the previous value.
+func (c *Client) PutStream(key string, r io.Reader, ttl *int) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	uploadID := hex.EncodeToString(id)
+
+	sum := sha256.New()
+	buf := make([]byte, StreamChunkSize)
+	var size int64
+	chunks := 0
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum.Write(buf[:n])
+			size += int64(n)
+
+			args := &storage.StreamChunkArgs{
+				Namespace: c.namespace,
+				Key:       key,
+				UploadID:  uploadID,
+				Index:     chunks,
+				Data:      buf[:n],
+				TTL:       ttl,
+			}
+			var reply storage.StreamChunkReply
+			if err := c.rpc.Call("Store.StreamChunk", args, &reply); err != nil {
+				return fmt.Errorf("failed to upload chunk %d: %w", chunks, err)
+			}
+			if reply.Error != "" {
+				return fmt.Errorf("server error: %s", reply.Error)
+			}
+			chunks++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+	}
+
+	if chunks == 0 {
+		return fmt.Errorf("cannot store an empty stream")
+	}
+
+	args := &storage.StreamCommitArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		UploadID:  uploadID,
+		Chunks:    chunks,
+		Size:      size,
+		Checksum:  hex.EncodeToString(sum.Sum(nil)),
+		TTL:       ttl,
+	}
+	var reply storage.SetReply
+	if err := c.rpc.Call("Store.StreamCommit", args, &reply); err != nil {
+		return fmt.Errorf("failed to commit stream: %w", err)
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("server error: %s", reply.Error)
+	}
+	return nil
+}
+
+// GetStream opens the value of key written with PutStream. Chunks are fetched
+// as the reader is consumed, and the final Read returns ErrStreamCorrupt
+// instead of io.EOF if the data does not match its checksum.
+func (c *Client) GetStream(key string) (io.ReadCloser, error) {
+	args := &storage.GetArgs{
+		Namespace: c.namespace,
+		Key:       key,
+	}
+	var reply storage.StreamOpenReply
+	if err := c.rpc.Call("Store.StreamOpen", args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+
+	checksum, err := hex.DecodeString(reply.Checksum)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream checksum: %w", err)
+	}
+
+	return &streamReader{
+		c:        c,
+		key:      key,
+		manifest: reply,
+		checksum: checksum,
+		sum:      sha256.New(),
+	}, nil
+}
+
+// streamReader reads a streamed value chunk by chunk
+type streamReader struct {
+	c        *Client
+	key      string
+	manifest storage.StreamOpenReply
+	checksum []byte
+
+	next int // index of the next chunk to fetch
+	buf  []byte
+	read int64
+	sum  hash.Hash
+	err  error
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 && s.err == nil {
+		if s.next == s.manifest.Chunks {
+			s.err = s.verify()
+			break
+		}
+		s.err = s.fetch()
+	}
+
+	if len(s.buf) == 0 {
+		return 0, s.err
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *streamReader) fetch() error {
+	args := &storage.StreamReadArgs{
+		Namespace: s.c.namespace,
+		Key:       s.key,
+		UploadID:  s.manifest.UploadID,
+		Index:     s.next,
+	}
+	var reply storage.StreamReadReply
+	if err := s.c.rpc.Call("Store.StreamRead", args, &reply); err != nil {
+		return fmt.Errorf("failed to read chunk %d: %w", s.next, err)
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("server error: %s", reply.Error)
+	}
+
+	s.next++
+	s.read += int64(len(reply.Data))
+	s.sum.Write(reply.Data)
+	s.buf = reply.Data
+	return nil
+}
+
+// verify checks the whole value once every chunk has been read
+func (s *streamReader) verify() error {
+	if s.read != s.manifest.Size || !bytes.Equal(s.sum.Sum(nil), s.checksum) {
+		return ErrStreamCorrupt
+	}
+	return io.EOF
+}
+
+func (s *streamReader) Close() error {
+	s.buf = nil
+	if s.err == nil {
+		s.err = errors.New("stream closed")
+	}
+	return nil
+}
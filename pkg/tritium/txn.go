@@ -0,0 +1,93 @@
+package tritium
+
+import (
+	"fmt"
+
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// ErrTxnAborted is returned by Txn.Commit when a watched key changed before the
+// transaction could commit. Nothing was applied; the transaction may be retried.
+var ErrTxnAborted = storage.ErrTxnAborted
+
+// Txn collects operations that are applied together or not at all. Build one
+// with Client.Txn, add operations and call Commit.
+type Txn struct {
+	c    *Client
+	args storage.TxnArgs
+}
+
+// TxnResult is the outcome of one transaction operation, in the order the
+// operations were added
+type TxnResult struct {
+	Version int64 // new version after a Set
+	Value   int64 // new value after an IncrBy
+	Deleted bool  // whether a Delete removed an existing key
+	Err     error
+}
+
+// Txn starts a new transaction
+func (c *Client) Txn() *Txn {
+	return &Txn{
+		c:    c,
+		args: storage.TxnArgs{Namespace: c.namespace},
+	}
+}
+
+// Watch aborts the transaction if key is written by anyone else before it commits
+func (t *Txn) Watch(keys ...string) *Txn {
+	for _, key := range keys {
+		t.args.Watch = append(t.args.Watch, storage.TxnWatchArgs{Key: key})
+	}
+	return t
+}
+
+// WatchVersion aborts the transaction unless key is still at version when it
+// starts and is not written by anyone else before it commits
+func (t *Txn) WatchVersion(key string, version int64) *Txn {
+	t.args.Watch = append(t.args.Watch, storage.TxnWatchArgs{Key: key, Version: &version})
+	return t
+}
+
+// Set stores a value with an optional TTL
+func (t *Txn) Set(key string, value []byte, ttl *int) *Txn {
+	t.args.Ops = append(t.args.Ops, storage.TxnOpArgs{Type: storage.TxnSet, Key: key, Value: value, TTL: ttl})
+	return t
+}
+
+// Delete removes a key
+func (t *Txn) Delete(key string) *Txn {
+	t.args.Ops = append(t.args.Ops, storage.TxnOpArgs{Type: storage.TxnDelete, Key: key})
+	return t
+}
+
+// IncrBy adds delta to the integer stored at key. The optional TTL applies
+// only if the counter is created by this increment.
+func (t *Txn) IncrBy(key string, delta int64, ttl *int) *Txn {
+	t.args.Ops = append(t.args.Ops, storage.TxnOpArgs{Type: storage.TxnIncrBy, Key: key, Delta: delta, TTL: ttl})
+	return t
+}
+
+// Commit applies every operation atomically, returning ErrTxnAborted if a
+// watched key changed
+func (t *Txn) Commit() ([]TxnResult, error) {
+	var reply storage.TxnReply
+	if err := t.c.rpc.Call("Store.Txn", &t.args, &reply); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("server error: %s", reply.Error)
+	}
+	if !reply.Committed {
+		return nil, ErrTxnAborted
+	}
+
+	results := make([]TxnResult, len(reply.Results))
+	for i, r := range reply.Results {
+		results[i] = TxnResult{Version: r.Version, Value: r.Value, Deleted: r.Deleted}
+		if r.Error != "" {
+			results[i].Err = fmt.Errorf("server error: %s", r.Error)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,90 @@
+package tritium
+
+import (
+	"github.com/we-be/tritium/pkg/storage"
+)
+
+// EventType identifies the kind of change a watch event reports
+type EventType string
+
+const (
+	EventSet    EventType = storage.EventSet    // the key was written or modified
+	EventDelete EventType = storage.EventDelete // the key was deleted
+	EventExpire EventType = storage.EventExpire // the key's TTL ran out
+	EventTTL    EventType = storage.EventTTL    // the key's TTL was set, changed or removed
+	EventPop    EventType = storage.EventPop    // an item was popped from the queue at the key
+)
+
+// WatchEvent reports a change to a watched key
+type WatchEvent struct {
+	Type EventType
+	Key  string
+}
+
+// Watcher delivers change events for a key or key prefix
+type Watcher struct {
+	sub    *Subscription
+	events chan *WatchEvent
+}
+
+// Watch delivers set, delete, expire and TTL events for key, including changes
+// made through other nodes of the cluster
+func (c *Client) Watch(key string) (*Watcher, error) {
+	return c.watch(key, false)
+}
+
+// WatchPrefix delivers set, delete, expire and TTL events for every key starting
+// with prefix
+func (c *Client) WatchPrefix(prefix string) (*Watcher, error) {
+	return c.watch(prefix, true)
+}
+
+func (c *Client) watch(key string, prefix bool) (*Watcher, error) {
+	args := &storage.WatchArgs{
+		Namespace: c.namespace,
+		Key:       key,
+		Prefix:    prefix,
+	}
+	sub, err := c.subscribe("Store.Watch", args)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		sub:    sub,
+		events: make(chan *WatchEvent, cap(sub.ch)),
+	}
+	go w.convertLoop()
+	return w, nil
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// watcher ends; Err reports why.
+func (w *Watcher) Events() <-chan *WatchEvent {
+	return w.events
+}
+
+// Err returns the error that ended the watcher, if any
+func (w *Watcher) Err() error {
+	return w.sub.Err()
+}
+
+// Close stops the watcher
+func (w *Watcher) Close() error {
+	return w.sub.Close()
+}
+
+func (w *Watcher) convertLoop() {
+	defer close(w.events)
+
+	// The subscription closes its channel once it is closed, so this loop
+	// cannot outlive it
+	for msg := range w.sub.Channel() {
+		event := &WatchEvent{Type: EventType(msg.Payload), Key: msg.Channel}
+		select {
+		case w.events <- event:
+		case <-w.sub.done:
+			return
+		}
+	}
+}